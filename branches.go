@@ -0,0 +1,88 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import "strings"
+
+// The branching keywords and operators that are counted by default (see
+// Options.CountBranches), for languages that are not in languageBranches.
+var defaultBranches = []string{"if", "for", "while", "case", "&&", "||", "catch"}
+
+// The branching keywords and operators of the languages whose branches differ
+// from defaultBranches, per language name. Languages mapped to nil (e.g. those
+// of data or documentation) have no branches.
+var languageBranches = map[string][]string{
+	"Go":                      {"if", "for", "case", "&&", "||"},
+	"Python":                  {"if", "elif", "for", "while", "case", "except", "and", "or"},
+	"Ruby":                    {"if", "elsif", "unless", "while", "until", "for", "when", "rescue", "&&", "||", "and", "or"},
+	"Rust":                    {"if", "for", "while", "loop", "match", "&&", "||"},
+	"Shell":                   {"if", "elif", "for", "while", "until", "case", "&&", "||"},
+	"Lua":                     {"if", "elseif", "for", "while", "repeat", "and", "or"},
+	"Elixir":                  {"if", "unless", "cond", "case", "rescue", "&&", "||", "and", "or"},
+	"Erlang":                  {"if", "case", "receive", "catch", "andalso", "orelse"},
+	"Haskell":                 {"if", "case", "&&", "||"},
+	"OCaml":                   {"if", "for", "while", "match", "try", "&&", "||"},
+	"Standard ML":             {"if", "case", "while", "handle", "andalso", "orelse"},
+	"Lisp":                    {"if", "cond", "when", "unless", "case", "and", "or"},
+	"Clojure":                 {"if", "cond", "when", "case", "and", "or"},
+	"Scheme":                  {"if", "cond", "when", "unless", "case", "and", "or"},
+	"Assembly":                nil,
+	"Assembly (preprocessed)": nil,
+	"Makefile":                nil,
+}
+
+// Returns the branching keywords and operators of the given language, or nil
+// if branches are not counted for it.
+func branchesOf(lang language) []string {
+	if branches, exists := languageBranches[lang.name]; exists {
+		return branches
+	}
+	if lang.category != "" {
+		return nil
+	}
+	return defaultBranches
+}
+
+// Returns the number of occurrences of the given branching keywords and
+// operators in the given code. Keywords (i.e. those that start with a letter)
+// only match whole words, while operators match anywhere. This is merely a
+// heuristic: occurrences in string literals are counted all the same.
+func countBranches(code string, branches []string) int {
+	n := 0
+	for _, branch := range branches {
+		if !isWordByte(branch[0]) {
+			n += strings.Count(code, branch)
+			continue
+		}
+		for from := 0; ; {
+			idx := strings.Index(code[from:], branch)
+			if idx == -1 {
+				break
+			}
+			idx += from
+			end := idx + len(branch)
+			if (idx == 0 || !isWordByte(code[idx-1])) && (end == len(code) || !isWordByte(code[end])) {
+				n++
+			}
+			from = end
+		}
+	}
+	return n
+}
+
+// Reports whether the given byte may be part of an identifier.
+func isWordByte(b byte) bool {
+	return b == '_' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+}
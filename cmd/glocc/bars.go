@@ -0,0 +1,131 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/ckatsak/glocc"
+)
+
+// The width assumed for the bar chart when that of the terminal is unknown
+// (e.g. when the output is not a terminal).
+const defaultTerminalWidth = 80
+
+// The characters that fill the bars, by eighths of a cell.
+var barEighths = []string{"", "▏", "▎", "▍", "▌", "▋", "▊", "▉", "█"}
+
+// The (256-color) ANSI colors of the bars; each language is assigned one of
+// them, by the hash of its name, so that its color is stable across runs.
+var barColors = []int{33, 35, 37, 40, 64, 67, 99, 130, 135, 160, 166, 172, 178, 184, 197, 202, 208, 214}
+
+// Print the summary of the total results to the standard output as a
+// horizontal bar chart, with one bar per language, sorted by lines of code in
+// descending order, whose length is proportional to the share of the language
+// in the total lines of code, scaled to the width of the terminal. The bars are colored
+// according to -color. It falls back to displayYAML for results that have no
+// summary.
+func displayBars(res interface{}) {
+	var result glocc.DirResult
+	switch r := res.(type) {
+	case map[string]int:
+		result.Summary = r
+	case glocc.DirResult:
+		result = r
+	default:
+		displayYAML(res)
+		return
+	}
+	report := result.Report(glocc.ReportOptions{})
+	if len(report.Languages) == 0 {
+		return
+	}
+
+	nameWidth := 0
+	for _, lang := range report.Languages {
+		if n := utf8.RuneCountInString(lang.Name); n > nameWidth {
+			nameWidth = n
+		}
+	}
+	locWidth := len(strconv.Itoa(report.Total))
+	const percentWidth = len("100.0%")
+	width := terminalWidth()
+	if width <= 0 {
+		width = defaultTerminalWidth
+	}
+	barWidth := width - nameWidth - percentWidth - locWidth - 3*len("  ")
+	if barWidth < 10 {
+		barWidth = 10
+	}
+
+	colored := useColor()
+	for _, lang := range report.Languages {
+		bar := renderBar(lang.Loc, report.Total, barWidth)
+		padding := strings.Repeat(" ", barWidth-utf8.RuneCountInString(bar))
+		if colored {
+			bar = fmt.Sprintf("\x1b[38;5;%dm%s\x1b[0m", barColor(lang.Name), bar)
+		}
+		fmt.Printf("%-*s  %s%s  %*.1f%%  %*d\n", nameWidth, lang.Name, bar, padding,
+			percentWidth-1, lang.Percentage, locWidth, lang.Loc)
+	}
+}
+
+// Returns a bar of block characters, whose length is up to the given width (in
+// cells), proportional to loc over total. Any non-zero loc gets a visible bar.
+func renderBar(loc, total, width int) string {
+	if total <= 0 || loc <= 0 {
+		return ""
+	}
+	eighths := loc * width * 8 / total
+	if eighths == 0 {
+		eighths = 1
+	}
+	return strings.Repeat(barEighths[8], eighths/8) + barEighths[eighths%8]
+}
+
+// Returns the color of the bar of the language with the given name.
+func barColor(name string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return barColors[h.Sum32()%uint32(len(barColors))]
+}
+
+// Reports whether the output should be colored, according to -color: always,
+// never, or (by default) only if the standard output is a terminal, and the
+// NO_COLOR environment variable is not set.
+func useColor() bool {
+	switch strings.ToLower(*colorFlag) {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	if _, noColor := os.LookupEnv("NO_COLOR"); noColor {
+		return false
+	}
+	return isTerminal(os.Stdout)
+}
+
+// Reports whether the given file is a terminal (or, more precisely, a
+// character device).
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
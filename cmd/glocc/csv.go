@@ -0,0 +1,72 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ckatsak/glocc"
+)
+
+// The header of the rows printed by displayFileRows.
+var fileRowsHeader = []string{"path", "language", "code", "comment", "blank", "total"}
+
+// Print the results of every file in the given total results to the standard
+// output in CSV format, one row per file, flattening the tree: its path, its
+// language(s), and its lines of code, comment lines, blank lines and total
+// lines. The results must have been counted without Options.SummaryOnly set.
+func displayFileRows(result glocc.DirResult) error {
+	w := csv.NewWriter(os.Stdout)
+	w.Write(fileRowsHeader)
+	writeFileRows(w, result)
+	w.Flush()
+	return w.Error()
+}
+
+// Writes a row for each of the files of the given DirResult, and of all of its
+// subdirectories, recursively.
+func writeFileRows(w *csv.Writer, d glocc.DirResult) {
+	for _, fr := range d.Files {
+		path := filepath.Join(d.Name, fr.Name)
+		if d.Subdirs == nil && d.Name == fr.Name {
+			// A single file, counted as the root.
+			path = fr.Name
+		}
+		langs := make([]string, 0, len(fr.Loc))
+		code := 0
+		for lang, loc := range fr.Loc {
+			langs = append(langs, lang)
+			code += loc
+		}
+		sort.Strings(langs)
+		total := code + fr.Comment + fr.Blank + fr.Directives + fr.Excluded
+		w.Write([]string{
+			path,
+			strings.Join(langs, ";"),
+			strconv.Itoa(code),
+			strconv.Itoa(fr.Comment + fr.Directives),
+			strconv.Itoa(fr.Blank),
+			strconv.Itoa(total),
+		})
+	}
+	for _, sub := range d.Subdirs {
+		writeFileRows(w, sub)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ckatsak/glocc"
+)
+
+// Counts the tree of the given ref in the git repository at the given
+// directory, without checking it out. The returned result is named after both
+// the repository and the ref.
+func countGitRef(repo, ref string, opts glocc.Options) (glocc.DirResult, error) {
+	g, err := glocc.NewGitFS(repo, ref)
+	if err != nil {
+		return glocc.DirResult{Name: repo + "@" + ref}, err
+	}
+	defer g.Close()
+
+	result, err := glocc.CountLocFS(g, ".", opts)
+	result.Name = repo + "@" + ref
+	return result, err
+}
+
+// Counts the lines of code added between the given revisions (e.g.
+// "v1.0.0..HEAD", or any other revisions accepted by `git diff`) in the git
+// repository at the given directory. The returned result is named after both
+// the repository and the revisions.
+func countGitDiff(repo, revs string, opts glocc.Options) (glocc.DirResult, error) {
+	cmd := exec.Command("git", "-C", repo, "diff", "--no-color", "--no-ext-diff", "--no-renames", "-U0", revs)
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return glocc.DirResult{Name: repo + "@" + revs}, err
+	}
+	if err := cmd.Start(); err != nil {
+		return glocc.DirResult{Name: repo + "@" + revs}, fmt.Errorf("git diff %s: %w", revs, err)
+	}
+
+	result, err := glocc.CountDiff(stdout, opts)
+	result.Name = repo + "@" + revs
+	// CountDiff may have stopped reading early (e.g. on an error), but git
+	// cannot exit before all of its output is read.
+	io.Copy(io.Discard, stdout)
+	if waitErr := cmd.Wait(); waitErr != nil && err == nil {
+		err = fmt.Errorf("git diff %s: %w", revs, waitErr)
+	}
+	return result, err
+}
+
+// Returns the paths of the files tracked by git under the given directory,
+// relative to it, as listed by `git ls-files`.
+func gitTrackedFiles(dir string) ([]string, error) {
+	output, err := exec.Command("git", "-C", dir, "ls-files", "-z").Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %v", err)
+	}
+	paths := make([]string, 0)
+	for _, p := range strings.Split(string(output), "\x00") {
+		if p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths, nil
+}
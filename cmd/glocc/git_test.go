@@ -0,0 +1,77 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ckatsak/glocc"
+)
+
+// Runs git with the given arguments in the given repository.
+func runGit(t *testing.T, repo string, args ...string) {
+	t.Helper()
+	args = append([]string{"-C", repo, "-c", "user.name=glocc", "-c", "user.email=glocc@example.com"}, args...)
+	if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+	}
+}
+
+func TestCountGitDiff(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	t0 := time.Now()
+	writeFileAt(t, filepath.Join(repo, "a.go"), "package a\n", t0)
+	runGit(t, repo, "init", "-q")
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "-q", "-m", "First")
+	// Much more than fits in the buffer of a pipe.
+	writeFileAt(t, filepath.Join(repo, "b.go"), "package b\n"+strings.Repeat("var x = 1\n", 20000), t0)
+	runGit(t, repo, "add", "-A")
+	runGit(t, repo, "commit", "-q", "-m", "Second")
+
+	result, err := countGitDiff(repo, "HEAD~1..HEAD", glocc.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := result.Summary["Go"], 20001; got != want {
+		t.Errorf("countGitDiff() counted %d lines of Go; want %d", got, want)
+	}
+	if want := repo + "@HEAD~1..HEAD"; result.Name != want {
+		t.Errorf("countGitDiff() named the result %q; want %q", result.Name, want)
+	}
+
+	// If CountDiff fails without reading the whole diff, git must not be
+	// left blocked writing the rest of it.
+	done := make(chan error, 1)
+	go func() {
+		_, err := countGitDiff(repo, "HEAD~1..HEAD", glocc.Options{MaxDepth: -1})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("countGitDiff() with invalid options returned no error")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("countGitDiff() with invalid options did not return")
+	}
+}
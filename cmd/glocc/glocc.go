@@ -18,13 +18,22 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"regexp"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/ckatsak/glocc"
 	"gopkg.in/yaml.v2"
@@ -33,7 +42,60 @@ import (
 // Command line flags.
 var (
 	debugFlag, showAllFlag, showTimeFlag *bool
-	outFormatFlag                        *string
+	ignoreCaseFlag, duplicatesFlag       *bool
+	ignoreEdgeBlanksFlag, directivesFlag *bool
+	checkFlag, gomodFlag, mdFencesFlag   *bool
+	lockFilesFlag, noSkipGitFlag         *bool
+	markersFlag, sniffFlag               *bool
+	histogramFlag, histogramByLangFlag   *bool
+	modelinesFlag, gitAttributesFlag     *bool
+	progressFlag, fileInfoFlag           *bool
+	skipMinifiedFlag, separateDocsFlag   *bool
+	gunzipFlag, sequentialFlag           *bool
+	absPathsFlag, validateContentFlag    *bool
+	reclassifyFlag                       *bool
+	explainFlag                          *bool
+	highlightsFlag                       *bool
+	trackedFlag                          *bool
+	sniffShebangFlag                     *bool
+	bySubdirFlag                         *bool
+	branchesFlag                         *bool
+	strictUnknownFlag                    *bool
+	mergeFlag                            *bool
+	separateGeneratedFlag                *bool
+	htmlEmbeddedFlag                     *bool
+	excludeDataFlag                      *bool
+	licenseFlag                          *bool
+	densityStmtFlag                      *bool
+	skipHiddenFlag                       *bool
+	rawCountFlag                         *bool
+	dedupHardLinksFlag                   *bool
+	countFilesFlag                       *bool
+	pruneEmptyFlag                       *bool
+	noGitIgnoreFlag                      *bool
+	followSymlinksFlag                   *bool
+	dataExtsFlag                         *string
+	hiddenAllowFlag                      *string
+	rawExtsFlag                          *string
+	sourceExtsFlag                       *string
+	colorFlag                            *string
+	generatedPatternsFlag                *string
+	outFormatFlag, excludeLineFlag       *string
+	fallbackEncodingFlag, langFlag       *string
+	gitRefFlag, skipFilesFlag            *string
+	diffFlag, markerWordsFlag            *string
+	severityFlag, languagesFlag          *string
+	rootLabelFlag                        *string
+	outFileFlag                          *string
+	skipDirsFlag                         *string
+	onlyLangsFlag, excludeLangsFlag      *string
+	fileTimeoutFlag, watchFlag           *time.Duration
+	dirWorkersFlag, fileWorkersFlag      *int
+	minifiedLineLengthFlag               *int
+	scanBufferFlag                       *int
+	maxFileLocFlag, maxFilesPerDirFlag   *int
+	topFilesFlag                         *int
+	maxDepthFlag                         *int
 )
 
 // Print the total results to the standard output in raw Go map %#v format.
@@ -63,46 +125,455 @@ func displayYAML(res interface{}) {
 	}
 }
 
-// It receives a slice of strings, the command line arguments of glocc, and
-// returns the total results of counting using the glocc package.
-func gloccMain(args []string) glocc.DirResult {
-	totalResults := glocc.DirResult{
-		Name:    "TOTAL",
-		Subdirs: make(glocc.DirResults, 0),
-		Files:   make([]glocc.FileResult, 0),
-		Summary: make(map[string]int),
-	}
-	resultsChannel := make(chan glocc.DirResult)
+// The maximum number of files and directories previewed per argument, in
+// check mode.
+const checkSampleSize = 50
+
+// Returned to stop walking an argument once its sample is complete, in check
+// mode.
+var errSampleComplete = errors.New("sample complete")
+
+// Print, for a sample of the files and directories under each of the given
+// paths, whether they would be counted or skipped using the given options,
+// and why. It exits with a non-zero status if the options are invalid.
+func checkMain(args []string, opts glocc.Options) {
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	for _, root := range args {
+		sampled := 0
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return nil
+			}
+			if sampled++; sampled > checkSampleSize {
+				return errSampleComplete
+			}
+			counted, reason := opts.Preview(path)
+			if counted {
+				fmt.Printf("counted  %s: %s\n", path, reason)
+			} else {
+				fmt.Printf("skipped  %s: %s\n", path, reason)
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+			}
+			return nil
+		})
+	}
+}
+
+// Print each line of each of the given files, annotated with its
+// classification and whether it was counted, using the given options. It exits
+// with a non-zero status if any of the files could not be counted.
+func explainMain(args []string, opts glocc.Options) {
+	failed := false
 	for _, path := range args {
-		go func(path string) {
-			resultsChannel <- glocc.CountLoc(path)
-		}(path)
-	}
-	resultsCount := 0
-	for result := range resultsChannel {
-		resultsCount++
-		totalResults.Subdirs = append(totalResults.Subdirs, result)
-		for lang, loc := range result.Summary {
-			if _, exists := totalResults.Summary[lang]; exists {
-				totalResults.Summary[lang] += loc
+		lang, lines, err := glocc.ExplainFile(path, opts)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed = true
+			if lines == nil {
+				continue
+			}
+		}
+		fmt.Printf("==> %s (%s) <==\n", path, lang)
+		for _, line := range lines {
+			verdict := "-"
+			switch {
+			case line.Counted:
+				verdict = "counted"
+			case line.Excluded:
+				verdict = "excluded"
+			case line.Directive:
+				verdict = "directive"
+			}
+			fmt.Printf("%5d  %-7s  %-9s | %s\n", line.Number, line.State, verdict, line.Line)
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// Print the summary of the total results to the standard output as a plain
+// text table, with one line per language, sorted by lines of code in
+// descending order, along with their percentage, followed by their total. It
+// falls back to displayYAML for results that have no summary.
+func displayTable(res interface{}) {
+	var result glocc.DirResult
+	switch r := res.(type) {
+	case map[string]int:
+		result.Summary = r
+	case glocc.DirResult:
+		result = r
+	default:
+		displayYAML(res)
+		return
+	}
+	report := result.Report(glocc.ReportOptions{})
+
+	nameWidth := len("Language")
+	for _, lang := range report.Languages {
+		if n := utf8.RuneCountInString(lang.Name); n > nameWidth {
+			nameWidth = n
+		}
+	}
+	locWidth := len(strconv.Itoa(report.Total))
+	if locWidth < len("Lines") {
+		locWidth = len("Lines")
+	}
+
+	const percentWidth = len("100.0%")
+	rule := strings.Repeat("-", nameWidth+2+locWidth+2+percentWidth)
+	fmt.Printf("%-*s  %*s  %*s\n%s\n", nameWidth, "Language", locWidth, "Lines", percentWidth, "%", rule)
+	for _, lang := range report.Languages {
+		fmt.Printf("%-*s  %*d  %*.1f%%\n", nameWidth, lang.Name, locWidth, lang.Loc, percentWidth-1, lang.Percentage)
+	}
+	fmt.Printf("%s\n%-*s  %*d\n", rule, nameWidth, "TOTAL", locWidth, report.Total)
+}
+
+// Returns the sum of the given counts per language.
+func sumCounts(counts map[string]int) int {
+	sum := 0
+	for _, n := range counts {
+		sum += n
+	}
+	return sum
+}
+
+// Formats the given counts per language as a parenthesized list, sorted by
+// language, or returns an empty string if there are none.
+func formatCounts(counts map[string]int) string {
+	if len(counts) == 0 {
+		return ""
+	}
+	langs := make([]string, 0, len(counts))
+	for lang := range counts {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	for i, lang := range langs {
+		langs[i] = fmt.Sprintf("%s: %d", lang, counts[lang])
+	}
+	return " (" + strings.Join(langs, ", ") + ")"
+}
+
+// Print the lines of code of the total results per category of languages (e.g.
+// programming, data, or documentation) to the standard output in YAML format.
+func displayCategories(res interface{}) {
+	switch r := res.(type) {
+	case glocc.DirResult:
+		displayYAML(r.Categories())
+	default:
+		displayYAML(res)
+	}
+}
+
+// Returns the summaries of the immediate subdirectories of each argument in
+// the given total results, by their names, omitting those without any lines of
+// code (e.g. skipped .git directories). With -count-files, their numbers of
+// files are returned instead.
+func subdirSummaries(totalResults glocc.DirResult) map[string]map[string]int {
+	summaries := make(map[string]map[string]int)
+	for _, result := range totalResults.Subdirs {
+		for _, subdir := range result.Subdirs {
+			if len(subdir.Summary) == 0 {
+				continue
+			}
+			if *countFilesFlag {
+				summaries[subdir.Name] = subdir.FileCounts
+			} else {
+				summaries[subdir.Name] = subdir.Summary
+			}
+		}
+	}
+	return summaries
+}
+
+// Print the statements per line of code of each language of the given results,
+// or N/A for the languages whose statements are not counted, to the standard
+// error.
+func displayStatementDensity(result glocc.DirResult) {
+	density := result.StatementDensity()
+	langs := result.Report(glocc.ReportOptions{SortByName: true}).Languages
+	ratios := make([]string, len(langs))
+	for i, lang := range langs {
+		if d, counted := density[lang.Name]; counted {
+			ratios[i] = fmt.Sprintf("%s: %.2f", lang.Name, d)
+		} else {
+			ratios[i] = lang.Name + ": N/A"
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Statements per line of code: %s.\n", strings.Join(ratios, ", "))
+}
+
+// Print the largest files of each language, sorted by language, to the
+// standard error.
+func displayTopFiles(tf *glocc.TopFiles) {
+	langs := make([]string, 0, len(tf.Files))
+	for lang := range tf.Files {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	for _, lang := range langs {
+		fmt.Fprintf(os.Stderr, "Largest %s files:\n", lang)
+		for _, fl := range tf.Files[lang] {
+			fmt.Fprintf(os.Stderr, "  %s (%d lines of code)\n", fl.Path, fl.Loc)
+		}
+	}
+}
+
+// Print the summary of the total results, along with the number of files and
+// the average lines of code per file of each language, to the standard output
+// in JSON format.
+func displayDetailed(res interface{}) {
+	switch r := res.(type) {
+	case glocc.DirResult:
+		displayJSON(r.DetailedSummary())
+	default:
+		displayJSON(res)
+	}
+}
+
+// Print how many files fall in each bucket of the given histogram, optionally
+// broken down per language, to the standard error.
+func displayHistogram(histogram glocc.Histogram, byLang bool) {
+	fmt.Fprintln(os.Stderr, "Files by lines of code:")
+	for i, n := range histogram.Total() {
+		breakdown := ""
+		if byLang {
+			counts := make(map[string]int)
+			for lang, buckets := range histogram {
+				if buckets[i] > 0 {
+					counts[lang] = buckets[i]
+				}
+			}
+			breakdown = formatCounts(counts)
+		}
+		fmt.Fprintf(os.Stderr, "  %-9s %d%s\n", glocc.HistogramBuckets[i]+":", n, breakdown)
+	}
+}
+
+// Configures how gloccMain counts its arguments, beyond the glocc.Options (see
+// the corresponding command line flags).
+type countConfig struct {
+	diff      string // -diff
+	gitRef    string // -git-ref
+	tracked   bool   // -tracked
+	absPaths  bool   // -abs-paths
+	rootLabel string // -root-label
+	progress  bool   // -progress
+	showAll   bool   // -a
+}
+
+// Returns the countConfig given by the command line flags.
+func countConfigFromFlags() countConfig {
+	return countConfig{
+		diff:      *diffFlag,
+		gitRef:    *gitRefFlag,
+		tracked:   *trackedFlag,
+		absPaths:  *absPathsFlag,
+		rootLabel: *rootLabelFlag,
+		progress:  *progressFlag,
+		showAll:   *showAllFlag,
+	}
+}
+
+// It receives a slice of strings, the command line arguments of glocc, and
+// returns the total results of counting using the glocc package, configured
+// by the given options and countConfig.
+func gloccMain(args []string, opts glocc.Options, cfg countConfig) glocc.DirResult {
+	// Results are collected by the position of their argument, rather than
+	// in order of completion, to keep the output stable across runs.
+	type indexedResult struct {
+		index  int
+		result glocc.DirResult
+	}
+	resultsChannel := make(chan indexedResult)
+	for i, path := range args {
+		go func(i int, path string) {
+			var result glocc.DirResult
+			var err error
+			if cfg.diff != "" {
+				result, err = countGitDiff(path, cfg.diff, opts)
+			} else if cfg.gitRef != "" {
+				result, err = countGitRef(path, cfg.gitRef, opts)
+			} else if isTarball(path) {
+				result, err = countTarball(path, opts)
 			} else {
-				totalResults.Summary[lang] = loc
+				opts := opts
+				if info, statErr := os.Stat(path); cfg.tracked && statErr == nil && info.IsDir() {
+					if opts.OnlyPaths, err = gitTrackedFiles(path); err != nil {
+						fmt.Fprintln(os.Stderr, err)
+						resultsChannel <- indexedResult{i, glocc.DirResult{Name: path}}
+						return
+					}
+				}
+				result, err = glocc.CountLocWithOptions(path, opts)
+				if abs, absErr := filepath.Abs(path); absErr == nil && !cfg.absPaths {
+					relabel(&result, abs, filepath.Clean(path))
+				}
 			}
+			if err != nil && (opts.Context == nil || opts.Context.Err() == nil) {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			resultsChannel <- indexedResult{i, result}
+		}(i, path)
+	}
+	results := make(glocc.DirResults, len(args))
+	for done := range args {
+		ir := <-resultsChannel
+		results[ir.index] = ir.result
+		if cfg.progress {
+			// Report to the standard error, so as not to mix partial
+			// results with the (possibly machine-readable) output.
+			fmt.Fprintf(os.Stderr, "[%d/%d] %s: %d lines of code%s.\n", done+1, len(args),
+				ir.result.Name, sumCounts(ir.result.Summary), formatCounts(ir.result.Summary))
 		}
-		if resultsCount == len(args) {
-			break
+	}
+	totalResults := glocc.MergeResults(cfg.rootLabel, results...)
+	if !cfg.showAll {
+		for _, result := range results {
+			totalResults.Errors = append(totalResults.Errors, result.Errors...)
 		}
 	}
 	return totalResults
 }
 
+// Command line flags that are meant for debugging, and are thus omitted from
+// the usage message.
+var hiddenFlags = map[string]bool{"sequential": true}
+
+// Print the default values of all command line flags, except for the hidden
+// ones, to the standard error, like flag.PrintDefaults.
+func printDefaults() {
+	visible := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	visible.SetOutput(flag.CommandLine.Output())
+	flag.VisitAll(func(f *flag.Flag) {
+		if !hiddenFlags[f.Name] {
+			visible.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+	visible.PrintDefaults()
+}
+
+// Renames the directories of the given results (i.e. the DirResult itself, and
+// its subdirectories, recursively) that are under the path from, so that they
+// are under the path to instead; e.g. to name them after the argument that
+// they were counted for, rather than after their absolute path. The paths in
+// the Highlights and TopFiles of the results are renamed accordingly.
+func relabel(result *glocc.DirResult, from, to string) {
+	rename := func(name *string) {
+		if rel, err := filepath.Rel(from, *name); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			*name = filepath.Join(to, rel)
+		}
+	}
+	rename(&result.Name)
+	if h := result.Highlights; h != nil {
+		rename(&h.LargestFile)
+		rename(&h.DeepestDir)
+	}
+	if tf := result.TopFiles; tf != nil {
+		for _, files := range tf.Files {
+			for i := range files {
+				rename(&files[i].Path)
+			}
+		}
+	}
+	for i := range result.Subdirs {
+		relabel(&result.Subdirs[i], from, to)
+	}
+}
+
 func init() {
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage of %s:\n", os.Args[0])
+		printDefaults()
+	}
+	sequentialFlag = flag.Bool("sequential", false, "count the entries of each directory one at a time, in order, for deterministic results (for debugging)")
+
 	debugFlag = flag.Bool("debug", false, "enable verbose logging to standard error; useful for debugging")
 	showAllFlag = flag.Bool("a", false, "show extensive results instead of just a top-level summary (default is summary)")
-	outFormatFlag = flag.String("o", "yaml", "choose output format; YAML, JSON and \"raw\" are currently supported")
+	outFormatFlag = flag.String("o", "yaml", "choose output format; YAML, JSON, \"json-detailed\", \"table\", \"bars\" (a bar chart), \"categories\", \"raw\", \"csv-files\" (one row per file), \"protobuf\" (see cmd/glocc/glocc.proto) and \"prometheus\" (in the text exposition format) are currently supported, as well as \"sarif\" for findings about oversize files")
+	outFileFlag = flag.String("out", "", "with -o protobuf, the file to write the output to, instead of the standard output")
+	rootLabelFlag = flag.String("root-label", "TOTAL", "the name of the root of the results, under which those of each argument are")
+	absPathsFlag = flag.Bool("abs-paths", false, "name the directories counted after their absolute paths, rather than after the arguments they were found under")
+	pruneEmptyFlag = flag.Bool("prune-empty", false, "with -a, omit the directories that contain no counted lines of code (e.g. empty ones, or ones with only skipped files) from the results")
+	countFilesFlag = flag.Bool("count-files", false, "only count the files of each language, by their names, without reading them; much faster on huge trees")
+	bySubdirFlag = flag.Bool("by-subdir", false, "print the summary of each immediate subdirectory of the directories given, instead of the total summary")
 	showTimeFlag = flag.Bool("t", false, "print the total duration of counting all arguments")
+	excludeLineFlag = flag.String("exclude-line", "", "exclude lines matching the given regular expression from the count")
+	directivesFlag = flag.Bool("directives", false, "count common directives (e.g. //go:build) separately from comments, and print their total")
+	dedupHardLinksFlag = flag.Bool("dedup-hardlinks", false, "count the hard links of the same file only once (on Unix-like systems)")
+	duplicatesFlag = flag.Bool("dup", false, "detect lines of code that are exact duplicates of lines seen elsewhere, and print the duplication ratio")
+	fallbackEncodingFlag = flag.String("fallback-encoding", "", "decode files that are not valid UTF-8 using the given encoding; \"latin1\" and \"windows-1252\" are currently supported")
+	languagesFlag = flag.String("languages", "", "count the custom languages defined in the given JSON file, as an array of objects with the fields of glocc.Language (e.g. [{\"name\": \"Foo\", \"extensions\": [\"foo\"], \"inlineCommentTokens\": [\"#\"]}])")
+	langFlag = flag.String("lang", "", "override the language of extensions, as a comma-separated list of ext=Language pairs (e.g. \"v=Coq\")")
+	ignoreEdgeBlanksFlag = flag.Bool("ignore-edge-blanks", false, "do not count the blank lines at the very beginning and end of each file as blank lines")
+	mergeFlag = flag.Bool("merge", false, "merge the results saved by previous runs (using \"-o json\", along with -a to retain the tree) in the given JSON files, instead of counting")
+	explainFlag = flag.Bool("explain", false, "print each line of the given files annotated with its classification (code, comment, block, blank or data) and whether it was counted, without counting")
+	checkFlag = flag.Bool("check", false, "validate the options, and preview whether a sample of the files would be counted or skipped, without counting")
+	gomodFlag = flag.Bool("gomod", false, "count the dependencies of the Go modules in the given directories (or the current one), per module")
+	mdFencesFlag = flag.Bool("md-fences", false, "count the lines inside fenced code blocks of Markdown files as lines of the blocks' languages")
+	htmlEmbeddedFlag = flag.Bool("html-embedded", false, "count the lines inside <script> and <style> elements of HTML files as Javascript and CSS, respectively")
+	validateContentFlag = flag.Bool("validate-content", false, "warn (along with -debug) about files whose content strongly suggests another language than their extension (e.g. a .h file that is C++)")
+	reclassifyFlag = flag.Bool("reclassify", false, "count files whose content strongly suggests another language than their extension as that language")
+	gunzipFlag = flag.Bool("gunzip", false, "count gzip-compressed files (e.g. foo.go.gz) by their decompressed content, according to their name without the .gz suffix")
+	excludeDataFlag = flag.Bool("exclude-data", false, "count the lines of data files (as given by -data-exts) separately from code, and print their total")
+	colorFlag = flag.String("color", "auto", "whether to color the output of \"-o bars\"; \"always\", \"never\", or \"auto\" (only if it is a terminal)")
+	strictUnknownFlag = flag.Bool("strict-unknown", false, "report the files that look like source code (as given by -source-exts) but whose language is not supported, and exit with status 1 if any are found")
+	sourceExtsFlag = flag.String("source-exts", strings.Join(glocc.DefaultSourceExtensions(), ","), "the comma-separated extensions of source files, if -strict-unknown is set")
+	dataExtsFlag = flag.String("data-exts", strings.Join(glocc.DefaultDataExtensions(), ","), "the comma-separated extensions of data files, if -exclude-data is set")
+	separateGeneratedFlag = flag.Bool("separate-generated", false, "count the lines of generated files (as given by -generated-patterns, or by the standard header of generated Go files) separately from hand-written code, and print their total")
+	generatedPatternsFlag = flag.String("generated-patterns", strings.Join(glocc.DefaultGeneratedPatterns(), ","), "the comma-separated patterns of the names of generated files, if -separate-generated is set")
+	separateDocsFlag = flag.Bool("separate-docs", false, "count the lines of documentation (e.g. Markdown, plain text) separately from code, and print their total")
+	rawCountFlag = flag.Bool("raw-count", false, "bypass language detection, and only count the files with the extensions given by -ext, as plain text, under their extensions")
+	rawExtsFlag = flag.String("ext", "", "the comma-separated extensions of the files to count, if -raw-count is set (e.g. \"xyz,abc\")")
+	ignoreCaseFlag = flag.Bool("ignore-case", false, "match file extensions case-insensitively, unless registered exactly as they are (e.g. count .PY as Python, but .C as C++)")
+	lockFilesFlag = flag.Bool("lockfiles", false, "count lock files and similar generated manifests (e.g. package-lock.json, go.sum), which are skipped by default")
+	skipHiddenFlag = flag.Bool("skip-hidden", false, "skip hidden directories (e.g. .cache or .venv), except for those given by -hidden-allow")
+	hiddenAllowFlag = flag.String("hidden-allow", "", "the comma-separated names of hidden directories to count anyway, if -skip-hidden is set (e.g. \".github,.config\")")
+	noSkipGitFlag = flag.Bool("no-skip-git", false, "count the contents of .git directories, which are skipped by default")
+	followSymlinksFlag = flag.Bool("follow-symlinks", false, "follow symbolic links to files and directories outside the ones given, counting each target once")
+	noGitIgnoreFlag = flag.Bool("no-gitignore", false, "count the files and directories ignored by .gitignore files, which are skipped by default")
+	skipDirsFlag = flag.String("skip-dirs", "", "skip directories whose names match any of the given comma-separated patterns (e.g. \"vendor,node_modules\"), along with everything under them")
+	maxDepthFlag = flag.Int("max-depth", 0, "the maximum depth of the directories descended into (e.g. 1 to only count the files directly in the directories given); 0 means no limit")
+	onlyLangsFlag = flag.String("only-langs", "", "count only the files of the given comma-separated languages (e.g. \"Go,C++\")")
+	excludeLangsFlag = flag.String("exclude-langs", "", "skip the files of the given comma-separated languages (e.g. \"JSON,YAML\")")
+	skipFilesFlag = flag.String("skip-files", "", "skip files whose names match any of the given comma-separated patterns (e.g. \"*.pb.go,*_gen.go\")")
+	watchFlag = flag.Duration("watch", 0, "after counting, keep polling the directories given for changes every given interval (e.g. \"2s\"), re-counting only the changed directories and printing their updated summaries, until interrupted")
+	fileTimeoutFlag = flag.Duration("file-timeout", 0, "skip files that take longer than the given duration (e.g. \"10s\") to count; 0 means no timeout")
+	licenseFlag = flag.Bool("license", false, "detect the license of each directory given, by its top-level LICENSE or COPYING file, and print it")
+	topFilesFlag = flag.Int("top-files", 0, "print the given number of files with the most lines of code of each language")
+	highlightsFlag = flag.Bool("highlights", false, "print the file with the most lines of code and the most deeply nested directory")
+	histogramFlag = flag.Bool("histogram", false, "print how many files fall in each range of lines of code")
+	histogramByLangFlag = flag.Bool("histogram-by-lang", false, "break down the histogram printed by -histogram per language")
+	skipMinifiedFlag = flag.Bool("skip-minified", false, "skip minified files (e.g. *.min.js), and print how many were skipped")
+	minifiedLineLengthFlag = flag.Int("minified-line-length", 500, "with -skip-minified, also skip files whose lines are longer than that on average; 0 disables this check")
+	scanBufferFlag = flag.Int("scan-buffer-bytes", glocc.DefaultScanBufferBytes, "the maximum length of a line, in bytes; files with longer lines are reported, and only counted up to them")
+	maxFileLocFlag = flag.Int("max-file-loc", 1000, "with -o sarif, report the files that have more lines of code than that")
+	severityFlag = flag.String("severity", "warning", "with -o sarif, the level of the findings reported; \"note\", \"warning\" and \"error\" are supported")
+	dirWorkersFlag = flag.Int("dir-workers", 0, "the maximum number of directories read concurrently (e.g. a few dozens); 0 means no limit")
+	fileWorkersFlag = flag.Int("file-workers", 0, "the maximum number of files counted concurrently (e.g. 4 times the number of CPUs); 0 means no limit")
+	maxFilesPerDirFlag = flag.Int("max-files-per-dir", 0, "with -a, the maximum number of files listed per directory (the rest are still counted); 0 means no limit")
+	fileInfoFlag = flag.Bool("file-info", false, "include the size and modification time of each file in the extensive results")
+	progressFlag = flag.Bool("progress", false, "print the summary of each argument to standard error as soon as it has been counted")
+	gitAttributesFlag = flag.Bool("gitattributes", false, "skip files marked as linguist-vendored, -generated or -documentation, and honour linguist-language, in .gitattributes files")
+	modelinesFlag = flag.Bool("modelines", false, "detect the language of files from vim or emacs modelines, overriding their extensions")
+	sniffShebangFlag = flag.Bool("sniff-shebang", false, "detect the language of scripts by their shebang lines first, regardless of their extensions (e.g. count every Python script as such)")
+	sniffFlag = flag.Bool("sniff", false, "count files without an extension whose content looks like plain text as such, rather than skipping them")
+	markersFlag = flag.Bool("markers", false, "count the comment lines that contain markers like TODO or FIXME per language, and print their total")
+	branchesFlag = flag.Bool("branches", false, "count the branching keywords and operators (like if, for, case or &&) in the code per language, as a rough complexity metric, and print their total")
+	densityStmtFlag = flag.Bool("density-stmt", false, "count the statements (i.e. semicolons) in the code of languages that terminate statements with them, and print the statements per line of code per language")
+	markerWordsFlag = flag.String("marker-words", strings.Join(glocc.DefaultMarkers(), ","), "the comma-separated markers to look for in comments, if -markers is set")
+	diffFlag = flag.String("diff", "", "count only the lines of code added between the given revisions (e.g. \"v1.0.0..HEAD\") in the git repositories given (or the current one)")
+	trackedFlag = flag.Bool("tracked", false, "count only the files tracked by git (as listed by git ls-files) in the directories given")
+	gitRefFlag = flag.String("git-ref", "", "count the tree of the given ref (e.g. a commit hash) in the git repositories given (or the current one), without checking it out")
 }
 
 func main() {
@@ -113,6 +584,7 @@ func main() {
 	}
 
 	var displayFunc func(interface{})
+	sarifMode, fileRowsMode, protobufMode, prometheusMode := false, false, false, false
 	switch strings.ToLower(*outFormatFlag) {
 	case "json":
 		displayFunc = displayJSON
@@ -120,24 +592,352 @@ func main() {
 		displayFunc = displayYAML
 	case "raw":
 		displayFunc = displayRaw
+	case "table":
+		displayFunc = displayTable
+	case "bars":
+		displayFunc = displayBars
+	case "categories":
+		displayFunc = displayCategories
+	case "json-detailed":
+		displayFunc = displayDetailed
+	case "csv-files":
+		fileRowsMode = true
+	case "protobuf":
+		protobufMode = true
+	case "prometheus":
+		prometheusMode = true
+	case "sarif":
+		if !validSARIFLevel(*severityFlag) {
+			fmt.Fprintf(os.Stderr, "Invalid severity %q.\n", *severityFlag)
+			os.Exit(1)
+		}
+		sarifMode = true
+		displayFunc = displayJSON
 	default:
-		flag.PrintDefaults()
+		printDefaults()
+		os.Exit(1)
+	}
+	if *watchFlag < 0 {
+		fmt.Fprintf(os.Stderr, "Invalid watch interval %s.\n", *watchFlag)
+		os.Exit(1)
+	}
+	if *watchFlag > 0 && (displayFunc == nil || sarifMode || *gomodFlag || *mergeFlag || *diffFlag != "" || *gitRefFlag != "" || *checkFlag || *explainFlag) {
+		// Only the results of directories counted in place can be
+		// re-counted incrementally, and printed as summaries.
+		fmt.Fprintln(os.Stderr, "The -watch flag cannot be combined with -gomod, -merge, -diff, -git-ref, -check, -explain, or -o csv-files, protobuf, prometheus or sarif.")
+		os.Exit(1)
+	}
+	if *gomodFlag && (displayFunc == nil || sarifMode) {
+		// The results of -gomod are summaries per module, not a tree.
+		fmt.Fprintf(os.Stderr, "Output format %q is not supported with -gomod.\n", *outFormatFlag)
 		os.Exit(1)
 	}
 
 	setNoFilesHardLimit()
 
+	opts := glocc.Options{
+		CaseInsensitiveExtensions: *ignoreCaseFlag,
+		SummaryOnly:               !*showAllFlag && !sarifMode && !fileRowsMode && *watchFlag == 0,
+		SubdirSummaries:           *bySubdirFlag,
+		CountFilesOnly:            *countFilesFlag,
+		DetectDuplicates:          *duplicatesFlag,
+		DedupHardLinks:            *dedupHardLinksFlag,
+		FollowSymlinks:            *followSymlinksFlag,
+		IgnoreEdgeBlankLines:      *ignoreEdgeBlanksFlag,
+		CountMarkdownFences:       *mdFencesFlag,
+		CountHTMLEmbeddedCode:     *htmlEmbeddedFlag,
+		SeparateDocumentation:     *separateDocsFlag,
+		SeparateGenerated:         *separateGeneratedFlag,
+		CountLockFiles:            *lockFilesFlag,
+		CountGitDirs:              *noSkipGitFlag,
+		CountGitIgnored:           *noGitIgnoreFlag,
+		SkipHidden:                *skipHiddenFlag,
+		SniffContent:              *sniffFlag,
+		Histogram:                 *histogramFlag,
+		Highlights:                *highlightsFlag,
+		TopFiles:                  *topFilesFlag,
+		DetectLicense:             *licenseFlag,
+		CountBranches:             *branchesFlag,
+		CountStatements:           *densityStmtFlag,
+		FileTimeout:               *fileTimeoutFlag,
+		DetectModelines:           *modelinesFlag,
+		UseGitAttributes:          *gitAttributesFlag,
+		IncludeFileInfo:           *fileInfoFlag,
+		DirWorkers:                *dirWorkersFlag,
+		SkipMinified:              *skipMinifiedFlag,
+		FileWorkers:               *fileWorkersFlag,
+		MaxFilesPerDir:            *maxFilesPerDirFlag,
+		MaxDepth:                  *maxDepthFlag,
+		ScanBufferBytes:           *scanBufferFlag,
+		Sequential:                *sequentialFlag,
+		ValidateContent:           *validateContentFlag,
+		ReclassifyContent:         *reclassifyFlag,
+	}
+	if *duplicatesFlag {
+		// Detect duplicates across all arguments, too.
+		opts.Duplicates = glocc.NewDuplicateTracker()
+	}
+	if *dirWorkersFlag > 0 || *fileWorkersFlag > 0 {
+		// Share the limits among all arguments, which are counted
+		// concurrently.
+		opts.Workers = glocc.NewWorkerPool(*dirWorkersFlag, *fileWorkersFlag)
+	}
+	if *skipMinifiedFlag {
+		opts.MinifiedLineLength = *minifiedLineLengthFlag
+	}
+	if *separateGeneratedFlag {
+		opts.GeneratedPatterns = strings.Split(*generatedPatternsFlag, ",")
+	}
+	if *strictUnknownFlag {
+		opts.SourceExtensions = strings.Split(*sourceExtsFlag, ",")
+	}
+	if *hiddenAllowFlag != "" {
+		opts.HiddenAllowlist = strings.Split(*hiddenAllowFlag, ",")
+	}
+	if *rawCountFlag {
+		if *rawExtsFlag == "" {
+			fmt.Fprintln(os.Stderr, "No extensions to count given by -ext.")
+			os.Exit(1)
+		}
+		opts.RawCountExtensions = strings.Split(*rawExtsFlag, ",")
+	}
+	if *excludeDataFlag {
+		opts.DataExtensions = strings.Split(*dataExtsFlag, ",")
+	}
+	if *sniffShebangFlag {
+		opts.ContentSniffer = glocc.ShebangSniffer
+	}
+	if *gunzipFlag {
+		opts.ReaderDecorators = append(opts.ReaderDecorators, glocc.GzipDecorator())
+	}
+	if *skipFilesFlag != "" {
+		opts.SkipFilePatterns = strings.Split(*skipFilesFlag, ",")
+	}
+	if *skipDirsFlag != "" {
+		opts.SkipDirPatterns = strings.Split(*skipDirsFlag, ",")
+	}
+	if *onlyLangsFlag != "" {
+		opts.Languages = strings.Split(*onlyLangsFlag, ",")
+	}
+	if *excludeLangsFlag != "" {
+		opts.ExcludeLanguages = strings.Split(*excludeLangsFlag, ",")
+	}
+	switch strings.ToLower(*fallbackEncodingFlag) {
+	case "":
+	case "latin1", "latin-1", "iso-8859-1":
+		opts.FallbackEncoding = glocc.Latin1
+	case "windows-1252", "cp1252":
+		opts.FallbackEncoding = glocc.Windows1252
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown fallback encoding %q.\n", *fallbackEncodingFlag)
+		os.Exit(1)
+	}
+	if *languagesFlag != "" {
+		data, err := ioutil.ReadFile(*languagesFlag)
+		if err == nil {
+			err = json.Unmarshal(data, &opts.CustomLanguages)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid custom languages in %q: %v.\n", *languagesFlag, err)
+			os.Exit(1)
+		}
+	}
+	if *langFlag != "" {
+		opts.ExtensionOverrides = make(map[string]string)
+		for _, pair := range strings.Split(*langFlag, ",") {
+			kv := strings.SplitN(pair, "=", 2)
+			if len(kv) != 2 {
+				fmt.Fprintf(os.Stderr, "Invalid extension override %q.\n", pair)
+				os.Exit(1)
+			}
+			opts.ExtensionOverrides[strings.TrimPrefix(kv[0], ".")] = kv[1]
+		}
+	}
+	if *markersFlag {
+		opts.Markers = strings.Split(*markerWordsFlag, ",")
+	}
+	if *directivesFlag {
+		opts.DirectivePatterns = glocc.DefaultDirectivePatterns()
+	}
+	if *excludeLineFlag != "" {
+		pattern, err := regexp.Compile(*excludeLineFlag)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		opts.ExcludeLinePattern = pattern
+	}
+
+	if *checkFlag {
+		checkMain(flag.Args(), opts)
+		return
+	}
+	if *explainFlag {
+		explainMain(flag.Args(), opts)
+		return
+	}
+	if *gomodFlag {
+		displayFunc(gomodMain(flag.Args(), opts))
+		return
+	}
+
+	args := flag.Args()
+	if (*gitRefFlag != "" || *diffFlag != "") && len(args) == 0 {
+		args = []string{"."}
+	}
 	startTime := time.Now()
-	totalResults := gloccMain(flag.Args())
+	// On SIGINT, stop counting, and print the results gathered so far; a
+	// second SIGINT terminates the program as usual.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	opts.Context = ctx
+	var totalResults glocc.DirResult
+	if *mergeFlag {
+		totalResults = mergeMain(args)
+	} else {
+		totalResults = gloccMain(args, opts, countConfigFromFlags())
+	}
 	endTime := time.Since(startTime)
+	interrupted := ctx.Err() != nil
+	stop()
+	if interrupted {
+		fmt.Fprintln(os.Stderr, "Interrupted; the results are partial.")
+		// Exit with the conventional status, once the results are printed.
+		defer os.Exit(130)
+	} else if *strictUnknownFlag && len(totalResults.Unrecognized) > 0 {
+		// Report them last, once the results are printed.
+		defer func() {
+			fmt.Fprintf(os.Stderr, "Found %d source files of unsupported languages:\n", len(totalResults.Unrecognized))
+			for _, name := range totalResults.Unrecognized {
+				fmt.Fprintf(os.Stderr, "  %s\n", name)
+			}
+			os.Exit(1)
+		}()
+	}
 
-	if *showAllFlag {
+	if fileRowsMode {
+		for _, err := range totalResults.Errors {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if err := displayFileRows(totalResults); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if prometheusMode {
+		for _, err := range totalResults.Errors {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		displayPrometheus(totalResults)
+		return
+	}
+	if protobufMode {
+		for _, err := range totalResults.Errors {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		if err := writeProtobuf(totalResults, *outFileFlag); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if sarifMode {
+		for _, err := range totalResults.Errors {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		// The results of -merge were not counted for its arguments.
+		sarifArgs := args
+		if *mergeFlag {
+			sarifArgs = nil
+		}
+		if displaySARIF(totalResults, sarifArgs, *maxFileLocFlag, *severityFlag) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	if *pruneEmptyFlag {
+		totalResults.PruneEmpty()
+	}
+	if format := strings.ToLower(*outFormatFlag); *showAllFlag || format == "categories" || format == "json-detailed" {
 		displayFunc(totalResults)
+	} else if *bySubdirFlag {
+		displayFunc(subdirSummaries(totalResults))
+	} else if *countFilesFlag {
+		displayFunc(totalResults.FileCounts)
 	} else {
 		displayFunc(totalResults.Summary)
 	}
 
+	for _, err := range totalResults.Errors {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	// Print the extras to the standard error, so as not to mix them with the
+	// (possibly machine-readable) output.
+	if *excludeLineFlag != "" && !*showAllFlag {
+		fmt.Fprintf(os.Stderr, "Excluded %d lines matching %q.\n", totalResults.Excluded, *excludeLineFlag)
+	}
+	if *directivesFlag && !*showAllFlag {
+		fmt.Fprintf(os.Stderr, "Directives: %d lines.\n", totalResults.Directives)
+	}
+	if *markersFlag && !*showAllFlag {
+		fmt.Fprintf(os.Stderr, "Markers: %d comment lines%s.\n", sumCounts(totalResults.Markers), formatCounts(totalResults.Markers))
+	}
+	if *branchesFlag && !*showAllFlag {
+		fmt.Fprintf(os.Stderr, "Branches: %d%s.\n", sumCounts(totalResults.Branches), formatCounts(totalResults.Branches))
+	}
+	if *densityStmtFlag && !*showAllFlag {
+		displayStatementDensity(totalResults)
+	}
+	if *excludeDataFlag && !*showAllFlag {
+		fmt.Fprintf(os.Stderr, "Data: %d lines%s.\n", sumCounts(totalResults.Data), formatCounts(totalResults.Data))
+	}
+	if *separateGeneratedFlag && !*showAllFlag {
+		fmt.Fprintf(os.Stderr, "Generated: %d lines%s.\n", sumCounts(totalResults.Generated), formatCounts(totalResults.Generated))
+	}
+	if *separateDocsFlag && !*showAllFlag {
+		fmt.Fprintf(os.Stderr, "Documentation: %d lines%s.\n", sumCounts(totalResults.Documentation), formatCounts(totalResults.Documentation))
+	}
+	if *skipMinifiedFlag && !*showAllFlag {
+		fmt.Fprintf(os.Stderr, "Skipped %d minified files.\n", totalResults.Minified)
+	}
+	if *licenseFlag && !*showAllFlag {
+		for _, result := range totalResults.Subdirs {
+			switch {
+			case result.LicenseFile == "":
+				fmt.Fprintf(os.Stderr, "License of %s: no license file found.\n", result.Name)
+			case result.License == "":
+				fmt.Fprintf(os.Stderr, "License of %s: unrecognized (see %s).\n", result.Name, result.LicenseFile)
+			default:
+				fmt.Fprintf(os.Stderr, "License of %s: %s (see %s).\n", result.Name, result.License, result.LicenseFile)
+			}
+		}
+	}
+	if h := totalResults.Highlights; h != nil && !*showAllFlag {
+		if h.LargestFile != "" {
+			fmt.Fprintf(os.Stderr, "Largest file: %s (%d lines of code).\n", h.LargestFile, h.LargestFileLoc)
+		}
+		if h.DeepestDir != "" {
+			fmt.Fprintf(os.Stderr, "Deepest directory: %s (%d levels deep).\n", h.DeepestDir, h.DeepestDirDepth)
+		}
+	}
+	if tf := totalResults.TopFiles; tf != nil && !*showAllFlag {
+		displayTopFiles(tf)
+	}
+	if *histogramFlag && !*showAllFlag {
+		displayHistogram(totalResults.Histogram, *histogramByLangFlag)
+	}
+	if *duplicatesFlag && !*showAllFlag {
+		fmt.Fprintf(os.Stderr, "Duplication ratio: %.2f%% (%d duplicate lines of code).\n",
+			100*totalResults.DuplicationRatio(), totalResults.Duplicates)
+	}
 	if *showTimeFlag {
 		fmt.Printf("Counting completed in %s.\n", endTime)
 	}
+	if *watchFlag > 0 && !interrupted {
+		watchMain(args, opts, totalResults, displayFunc, *watchFlag)
+	}
 }
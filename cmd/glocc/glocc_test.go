@@ -0,0 +1,71 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ckatsak/glocc"
+)
+
+func TestGloccMainDuplicatesAcrossRoots(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Now()
+	content := "package a\n\nfunc A() {}\n"
+	writeFileAt(t, filepath.Join(dir, "p", "a.go"), content, t0)
+	writeFileAt(t, filepath.Join(dir, "q", "vendor", "a.go"), content, t0)
+	writeFileAt(t, filepath.Join(dir, "q", "b.go"), "package b\n", t0)
+	args := []string{filepath.Join(dir, "p"), filepath.Join(dir, "q")}
+
+	// Each root is counted against a tracker of its own.
+	totalResults := gloccMain(args, glocc.Options{DetectDuplicates: true}, countConfig{})
+	if totalResults.Duplicates != 0 {
+		t.Errorf("gloccMain() without a shared tracker found %d duplicates; want 0", totalResults.Duplicates)
+	}
+
+	// All roots are counted against the same tracker, as with -duplicates.
+	totalResults = gloccMain(args, glocc.Options{DetectDuplicates: true, Duplicates: glocc.NewDuplicateTracker()}, countConfig{})
+	if totalResults.Duplicates != 2 {
+		t.Errorf("gloccMain() with a shared tracker found %d duplicates; want 2", totalResults.Duplicates)
+	}
+	if got, want := totalResults.Summary["Go"], 5; got != want {
+		t.Errorf("gloccMain() counted %d lines of Go; want %d", got, want)
+	}
+}
+
+func TestGloccMainConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFileAt(t, filepath.Join(dir, "p", "a.go"), "package a\n", time.Now())
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	arg, err := filepath.Rel(wd, filepath.Join(dir, "p"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	totalResults := gloccMain([]string{arg}, glocc.Options{}, countConfig{rootLabel: "ALL"})
+	if totalResults.Name != "ALL" || totalResults.Subdirs[0].Name != arg {
+		t.Errorf("gloccMain() named the results %q and %q; want %q and %q", totalResults.Name, totalResults.Subdirs[0].Name, "ALL", arg)
+	}
+	totalResults = gloccMain([]string{arg}, glocc.Options{}, countConfig{absPaths: true})
+	if want := filepath.Join(dir, "p"); totalResults.Subdirs[0].Name != want {
+		t.Errorf("gloccMain() with absolute paths named the result %q; want %q", totalResults.Subdirs[0].Name, want)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/ckatsak/glocc"
+)
+
+// A Go module, as reported by `go list -m -json`.
+type goModule struct {
+	Path    string
+	Version string
+	Dir     string
+	Main    bool
+}
+
+// Returns the dependencies of the Go module in the given directory, as
+// resolved in the module cache by `go list -m -json all`. Dependencies that
+// have not been downloaded to the module cache are omitted.
+func listGoModules(dir string) ([]goModule, error) {
+	cmd := exec.Command("go", "list", "-m", "-json", "all")
+	cmd.Dir = dir
+	cmd.Stderr = os.Stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go list -m -json all: %v", err)
+	}
+
+	var modules []goModule
+	dec := json.NewDecoder(bytes.NewReader(output))
+	for {
+		var m goModule
+		if err := dec.Decode(&m); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		if !m.Main && m.Dir != "" {
+			modules = append(modules, m)
+		}
+	}
+	return modules, nil
+}
+
+// It receives a slice of strings, the directories of the Go modules given as
+// command line arguments of glocc (or the current directory, if none), and
+// returns the results of counting each of their dependencies using the glocc
+// package, keyed by module path and version.
+func gomodMain(args []string, opts glocc.Options) map[string]map[string]int {
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	results := make(map[string]map[string]int)
+	for _, dir := range args {
+		modules, err := listGoModules(dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		summaries := make([]map[string]int, len(modules))
+		done := make(chan struct{})
+		for i, m := range modules {
+			go func(i int, dir string) {
+				result, err := glocc.CountLocWithOptions(dir, opts)
+				if err != nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				summaries[i] = result.Summary
+				done <- struct{}{}
+			}(i, m.Dir)
+		}
+		for range modules {
+			<-done
+		}
+		for i, m := range modules {
+			results[m.Path+"@"+m.Version] = summaries[i]
+		}
+	}
+	return results
+}
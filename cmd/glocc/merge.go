@@ -0,0 +1,74 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/ckatsak/glocc"
+)
+
+// It receives the paths of JSON files, each containing the results of a
+// previous run of glocc (as printed using "-o json", along with -a to retain
+// the whole tree), and returns their merged results, so that the counting of
+// a huge tree can be split among many runs (e.g. on different machines). It
+// exits with a non-zero status if any of them cannot be loaded.
+func mergeMain(paths []string) glocc.DirResult {
+	var results glocc.DirResults
+	for _, path := range paths {
+		loaded, err := loadResults(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			os.Exit(1)
+		}
+		results = append(results, loaded...)
+	}
+	totalResults := glocc.MergeResults(*rootLabelFlag, results...)
+	if !*showAllFlag {
+		for _, result := range results {
+			totalResults.Errors = append(totalResults.Errors, result.Errors...)
+		}
+	}
+	return totalResults
+}
+
+// Loads the results saved in the JSON file with the given path: either the
+// total results of a run, in which case the results of each of its arguments
+// are returned, or just their summary, in which case a single DirResult named
+// after the file is returned.
+func loadResults(path string) (glocc.DirResults, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	var result glocc.DirResult
+	if err := decoder.Decode(&result); err == nil && result.Summary != nil {
+		if result.Name == *rootLabelFlag && result.Subdirs != nil {
+			return result.Subdirs, nil
+		}
+		return glocc.DirResults{result}, nil
+	}
+	var summary map[string]int
+	if err := json.Unmarshal(content, &summary); err != nil {
+		return nil, fmt.Errorf("Invalid results: %v.", err)
+	}
+	return glocc.DirResults{{Name: path, Summary: summary}}, nil
+}
@@ -0,0 +1,52 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/ckatsak/glocc"
+)
+
+// Escapes the given value of a label of the Prometheus text exposition format.
+var prometheusLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Print the total results to the standard output as metrics in the Prometheus
+// text exposition format (e.g. for the textfile collector of node_exporter):
+// the lines of code and the files of each language, and the total blank and
+// comment lines.
+func displayPrometheus(result glocc.DirResult) {
+	writePerLanguageMetric(os.Stdout, "glocc_lines_of_code", "Lines of code per language.", result.Summary)
+	writePerLanguageMetric(os.Stdout, "glocc_files_total", "Files per language.", result.FileCounts)
+	writeMetric(os.Stdout, "glocc_blank_lines", "Blank lines of all languages.", result.Blank)
+	writeMetric(os.Stdout, "glocc_comment_lines", "Comment lines of all languages.", result.Comment)
+}
+
+// Writes a gauge with a sample per language, sorted by language.
+func writePerLanguageMetric(w io.Writer, name, help string, counts map[string]int) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	report := glocc.DirResult{Summary: counts}.Report(glocc.ReportOptions{SortByName: true})
+	for _, lang := range report.Languages {
+		fmt.Fprintf(w, "%s{language=\"%s\"} %d\n", name, prometheusLabelEscaper.Replace(lang.Name), lang.Loc)
+	}
+}
+
+// Writes a gauge with a single sample.
+func writeMetric(w io.Writer, name, help string, value int) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, value)
+}
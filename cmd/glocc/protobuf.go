@@ -0,0 +1,254 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/ckatsak/glocc"
+)
+
+// The wire types of the Protocol Buffers encoding that are used.
+const (
+	protoVarint          = 0
+	protoLengthDelimited = 2
+)
+
+// A buffer that messages are encoded into, in the Protocol Buffers binary
+// format. Like proto3, fields with default values (i.e. zero or empty) are
+// omitted.
+type protoBuffer []byte
+
+func (p *protoBuffer) varint(v uint64) {
+	for v >= 0x80 {
+		*p = append(*p, byte(v)|0x80)
+		v >>= 7
+	}
+	*p = append(*p, byte(v))
+}
+
+func (p *protoBuffer) key(field, wireType int) {
+	p.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+func (p *protoBuffer) int(field int, v int64) {
+	if v != 0 {
+		p.key(field, protoVarint)
+		p.varint(uint64(v))
+	}
+}
+
+func (p *protoBuffer) bool(field int, v bool) {
+	if v {
+		p.int(field, 1)
+	}
+}
+
+func (p *protoBuffer) bytes(field int, b []byte) {
+	p.key(field, protoLengthDelimited)
+	p.varint(uint64(len(b)))
+	*p = append(*p, b...)
+}
+
+func (p *protoBuffer) string(field int, s string) {
+	if s != "" {
+		p.bytes(field, []byte(s))
+	}
+}
+
+// Encodes the given map as a map<string, int64> field, sorted by key, so that
+// the output is stable across runs.
+func (p *protoBuffer) counts(field int, m map[string]int) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var entry protoBuffer
+		entry.string(1, k)
+		entry.int(2, int64(m[k]))
+		p.bytes(field, entry)
+	}
+}
+
+// Encodes the given LineCounts as a map<string, LineCount> field, sorted by
+// language.
+func (p *protoBuffer) lineCounts(field int, m glocc.LineCounts) {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var lc, entry protoBuffer
+		lc.int(1, int64(m[k].Code))
+		lc.int(2, int64(m[k].Comment))
+		lc.int(3, int64(m[k].Blank))
+		entry.string(1, k)
+		entry.bytes(2, lc)
+		p.bytes(field, entry)
+	}
+}
+
+// Encodes the given Histogram as a map<string, Buckets> field, sorted by
+// language.
+func (p *protoBuffer) histogram(field int, h glocc.Histogram) {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var packed, buckets, entry protoBuffer
+		for _, count := range h[k] {
+			packed.varint(uint64(count))
+		}
+		buckets.bytes(1, packed)
+		entry.string(1, k)
+		entry.bytes(2, buckets)
+		p.bytes(field, entry)
+	}
+}
+
+// Encodes the given Highlights, unless nil, as a Highlights message field.
+func (p *protoBuffer) highlights(field int, h *glocc.Highlights) {
+	if h == nil {
+		return
+	}
+	var m protoBuffer
+	m.string(1, h.LargestFile)
+	m.int(2, int64(h.LargestFileLoc))
+	m.string(3, h.DeepestDir)
+	m.int(4, int64(h.DeepestDirDepth))
+	p.bytes(field, m)
+}
+
+// Encodes the given TopFiles, unless nil, as a TopFiles message field, whose
+// files are sorted by language.
+func (p *protoBuffer) topFiles(field int, tf *glocc.TopFiles) {
+	if tf == nil {
+		return
+	}
+	var m protoBuffer
+	m.int(1, int64(tf.Limit))
+	keys := make([]string, 0, len(tf.Files))
+	for k := range tf.Files {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		var locations, entry protoBuffer
+		for _, fl := range tf.Files[k] {
+			var location protoBuffer
+			location.string(1, fl.Path)
+			location.int(2, int64(fl.Loc))
+			locations.bytes(1, location)
+		}
+		entry.string(1, k)
+		entry.bytes(2, locations)
+		m.bytes(2, entry)
+	}
+	p.bytes(field, m)
+}
+
+// Encodes the given time, unless nil, as a google.protobuf.Timestamp field.
+func (p *protoBuffer) timestamp(field int, t *time.Time) {
+	if t == nil {
+		return
+	}
+	var m protoBuffer
+	m.int(1, t.Unix())
+	m.int(2, int64(t.Nanosecond()))
+	p.bytes(field, m)
+}
+
+// Encodes the given DirResult as a DirResult message of glocc.proto.
+func encodeDirResult(d glocc.DirResult) []byte {
+	var p protoBuffer
+	p.string(1, d.Name)
+	for _, sub := range d.Subdirs {
+		p.bytes(2, encodeDirResult(sub))
+	}
+	for _, fr := range d.Files {
+		p.bytes(3, encodeFileResult(fr))
+	}
+	p.counts(4, d.Summary)
+	p.counts(5, d.FileCounts)
+	p.int(6, int64(d.Blank))
+	p.int(7, int64(d.Comment))
+	p.int(8, int64(d.Excluded))
+	p.int(9, int64(d.Duplicates))
+	p.int(10, int64(d.Directives))
+	p.counts(11, d.Markers)
+	p.counts(12, d.Branches)
+	p.counts(13, d.Documentation)
+	p.counts(14, d.Data)
+	p.counts(15, d.Generated)
+	p.int(16, int64(d.Minified))
+	for _, name := range d.Unrecognized {
+		p.string(17, name)
+	}
+	p.int(18, int64(d.ElidedFiles))
+	p.string(19, d.LicenseFile)
+	p.string(20, d.License)
+	for _, err := range d.Errors {
+		p.string(21, err)
+	}
+	p.lineCounts(22, d.Lines)
+	p.counts(23, d.Statements)
+	p.histogram(24, d.Histogram)
+	p.highlights(25, d.Highlights)
+	p.topFiles(26, d.TopFiles)
+	return p
+}
+
+// Encodes the given FileResult as a FileResult message of glocc.proto.
+func encodeFileResult(f glocc.FileResult) []byte {
+	var p protoBuffer
+	p.string(1, f.Name)
+	p.counts(2, f.Loc)
+	p.int(3, int64(f.Blank))
+	p.int(4, int64(f.Comment))
+	p.int(5, int64(f.Excluded))
+	p.int(6, int64(f.Duplicates))
+	p.int(7, int64(f.Directives))
+	p.counts(8, f.Markers)
+	p.counts(9, f.Branches)
+	p.counts(10, f.Documentation)
+	p.counts(11, f.Data)
+	p.counts(12, f.Generated)
+	p.int(13, f.Size)
+	p.bool(14, f.Minified)
+	p.bool(15, f.Unrecognized)
+	p.lineCounts(16, f.Lines)
+	p.counts(17, f.Statements)
+	p.timestamp(18, f.ModTime)
+	return p
+}
+
+// Write the given total results, encoded as a DirResult message of
+// glocc.proto, to the file at the given path, or to the standard output if
+// the path is empty.
+func writeProtobuf(result glocc.DirResult, path string) error {
+	if path == "" {
+		_, err := os.Stdout.Write(encodeDirResult(result))
+		return err
+	}
+	return ioutil.WriteFile(path, encodeDirResult(result), 0644)
+}
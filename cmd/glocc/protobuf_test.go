@@ -0,0 +1,356 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ckatsak/glocc"
+)
+
+// A field of a message in the Protocol Buffers binary format, which holds
+// either a varint or a length-delimited value.
+type protoField struct {
+	num    int
+	varint uint64
+	bytes  []byte
+}
+
+// Decodes the varint at the beginning of b, returning it along with the rest
+// of b.
+func readVarint(t *testing.T, b []byte) (uint64, []byte) {
+	t.Helper()
+	var v uint64
+	for shift := uint(0); ; shift += 7 {
+		if len(b) == 0 {
+			t.Fatal("Truncated varint")
+		}
+		c := b[0]
+		b = b[1:]
+		v |= uint64(c&0x7f) << shift
+		if c < 0x80 {
+			return v, b
+		}
+	}
+}
+
+// Decodes the fields of the given message, in order.
+func parseProto(t *testing.T, b []byte) []protoField {
+	t.Helper()
+	var fields []protoField
+	for len(b) > 0 {
+		var key uint64
+		key, b = readVarint(t, b)
+		f := protoField{num: int(key >> 3)}
+		switch key & 7 {
+		case protoVarint:
+			f.varint, b = readVarint(t, b)
+		case protoLengthDelimited:
+			var n uint64
+			n, b = readVarint(t, b)
+			if uint64(len(b)) < n {
+				t.Fatalf("Truncated field %d", f.num)
+			}
+			f.bytes, b = b[:n], b[n:]
+		default:
+			t.Fatalf("Unexpected wire type %d of field %d", key&7, f.num)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// Decodes a map<string, V> entry, returning its key and the raw value.
+func parseEntry(t *testing.T, b []byte) (string, protoField) {
+	var key string
+	var value protoField
+	for _, f := range parseProto(t, b) {
+		if f.num == 1 {
+			key = string(f.bytes)
+		} else {
+			value = f
+		}
+	}
+	return key, value
+}
+
+func addCount(m *map[string]int, t *testing.T, b []byte) {
+	if *m == nil {
+		*m = make(map[string]int)
+	}
+	k, v := parseEntry(t, b)
+	(*m)[k] = int(v.varint)
+}
+
+func addLineCount(m *glocc.LineCounts, t *testing.T, b []byte) {
+	if *m == nil {
+		*m = make(glocc.LineCounts)
+	}
+	k, v := parseEntry(t, b)
+	var lc glocc.LineCount
+	for _, f := range parseProto(t, v.bytes) {
+		switch f.num {
+		case 1:
+			lc.Code = int(f.varint)
+		case 2:
+			lc.Comment = int(f.varint)
+		case 3:
+			lc.Blank = int(f.varint)
+		}
+	}
+	(*m)[k] = lc
+}
+
+func decodeDirResult(t *testing.T, b []byte) glocc.DirResult {
+	var d glocc.DirResult
+	for _, f := range parseProto(t, b) {
+		switch f.num {
+		case 1:
+			d.Name = string(f.bytes)
+		case 2:
+			d.Subdirs = append(d.Subdirs, decodeDirResult(t, f.bytes))
+		case 3:
+			d.Files = append(d.Files, decodeFileResult(t, f.bytes))
+		case 4:
+			addCount(&d.Summary, t, f.bytes)
+		case 5:
+			addCount(&d.FileCounts, t, f.bytes)
+		case 6:
+			d.Blank = int(f.varint)
+		case 7:
+			d.Comment = int(f.varint)
+		case 8:
+			d.Excluded = int(f.varint)
+		case 9:
+			d.Duplicates = int(f.varint)
+		case 10:
+			d.Directives = int(f.varint)
+		case 11:
+			addCount(&d.Markers, t, f.bytes)
+		case 12:
+			addCount(&d.Branches, t, f.bytes)
+		case 13:
+			addCount(&d.Documentation, t, f.bytes)
+		case 14:
+			addCount(&d.Data, t, f.bytes)
+		case 15:
+			addCount(&d.Generated, t, f.bytes)
+		case 16:
+			d.Minified = int(f.varint)
+		case 17:
+			d.Unrecognized = append(d.Unrecognized, string(f.bytes))
+		case 18:
+			d.ElidedFiles = int(f.varint)
+		case 19:
+			d.LicenseFile = string(f.bytes)
+		case 20:
+			d.License = string(f.bytes)
+		case 21:
+			d.Errors = append(d.Errors, string(f.bytes))
+		case 22:
+			addLineCount(&d.Lines, t, f.bytes)
+		case 23:
+			addCount(&d.Statements, t, f.bytes)
+		case 24:
+			if d.Histogram == nil {
+				d.Histogram = make(glocc.Histogram)
+			}
+			k, v := parseEntry(t, f.bytes)
+			var counts []int
+			for _, buckets := range parseProto(t, v.bytes) {
+				for packed := buckets.bytes; len(packed) > 0; {
+					var count uint64
+					count, packed = readVarint(t, packed)
+					counts = append(counts, int(count))
+				}
+			}
+			d.Histogram[k] = counts
+		case 25:
+			d.Highlights = &glocc.Highlights{}
+			for _, h := range parseProto(t, f.bytes) {
+				switch h.num {
+				case 1:
+					d.Highlights.LargestFile = string(h.bytes)
+				case 2:
+					d.Highlights.LargestFileLoc = int(h.varint)
+				case 3:
+					d.Highlights.DeepestDir = string(h.bytes)
+				case 4:
+					d.Highlights.DeepestDirDepth = int(h.varint)
+				}
+			}
+		case 26:
+			d.TopFiles = &glocc.TopFiles{}
+			for _, tf := range parseProto(t, f.bytes) {
+				if tf.num == 1 {
+					d.TopFiles.Limit = int(tf.varint)
+					continue
+				}
+				if d.TopFiles.Files == nil {
+					d.TopFiles.Files = make(map[string][]glocc.FileLocation)
+				}
+				k, v := parseEntry(t, tf.bytes)
+				for _, location := range parseProto(t, v.bytes) {
+					var fl glocc.FileLocation
+					for _, lf := range parseProto(t, location.bytes) {
+						if lf.num == 1 {
+							fl.Path = string(lf.bytes)
+						} else {
+							fl.Loc = int(lf.varint)
+						}
+					}
+					d.TopFiles.Files[k] = append(d.TopFiles.Files[k], fl)
+				}
+			}
+		default:
+			t.Errorf("Unexpected field %d of DirResult", f.num)
+		}
+	}
+	return d
+}
+
+func decodeFileResult(t *testing.T, b []byte) glocc.FileResult {
+	var fr glocc.FileResult
+	for _, f := range parseProto(t, b) {
+		switch f.num {
+		case 1:
+			fr.Name = string(f.bytes)
+		case 2:
+			addCount(&fr.Loc, t, f.bytes)
+		case 3:
+			fr.Blank = int(f.varint)
+		case 4:
+			fr.Comment = int(f.varint)
+		case 5:
+			fr.Excluded = int(f.varint)
+		case 6:
+			fr.Duplicates = int(f.varint)
+		case 7:
+			fr.Directives = int(f.varint)
+		case 8:
+			addCount(&fr.Markers, t, f.bytes)
+		case 9:
+			addCount(&fr.Branches, t, f.bytes)
+		case 10:
+			addCount(&fr.Documentation, t, f.bytes)
+		case 11:
+			addCount(&fr.Data, t, f.bytes)
+		case 12:
+			addCount(&fr.Generated, t, f.bytes)
+		case 13:
+			fr.Size = int64(f.varint)
+		case 14:
+			fr.Minified = f.varint != 0
+		case 15:
+			fr.Unrecognized = f.varint != 0
+		case 16:
+			addLineCount(&fr.Lines, t, f.bytes)
+		case 17:
+			addCount(&fr.Statements, t, f.bytes)
+		case 18:
+			var seconds, nanos int64
+			for _, ts := range parseProto(t, f.bytes) {
+				if ts.num == 1 {
+					seconds = int64(ts.varint)
+				} else {
+					nanos = int64(ts.varint)
+				}
+			}
+			modTime := time.Unix(seconds, nanos)
+			fr.ModTime = &modTime
+		default:
+			t.Errorf("Unexpected field %d of FileResult", f.num)
+		}
+	}
+	return fr
+}
+
+// Fails unless every field of the given struct is set, so that no field that
+// is added to it later can be forgotten by the encoding.
+func checkAllFieldsSet(t *testing.T, v interface{}) {
+	t.Helper()
+	rv := reflect.ValueOf(v)
+	for i := 0; i < rv.NumField(); i++ {
+		if rv.Field(i).IsZero() {
+			t.Errorf("Field %s of %s is not set in the test; is it encoded?", rv.Type().Field(i).Name, rv.Type())
+		}
+	}
+}
+
+func TestEncodeDirResult(t *testing.T) {
+	counts := func(lang string, n int) map[string]int { return map[string]int{lang: n} }
+	modTime := time.Unix(1500000000, 123)
+	fr := glocc.FileResult{
+		Name:          "a.go",
+		Loc:           counts("Go", 10),
+		Blank:         2,
+		Comment:       3,
+		Lines:         glocc.LineCounts{"Go": {Code: 10, Comment: 3, Blank: 2}},
+		Excluded:      1,
+		Duplicates:    4,
+		Directives:    5,
+		Markers:       counts("Go", 6),
+		Branches:      counts("Go", 7),
+		Statements:    counts("Go", 0),
+		Documentation: counts("Markdown", 8),
+		Data:          counts("JSON", 9),
+		Generated:     counts("Go", 11),
+		Size:          1 << 40,
+		ModTime:       &modTime,
+		Minified:      true,
+		Unrecognized:  true,
+	}
+	want := glocc.DirResult{
+		Name:          "p",
+		Subdirs:       glocc.DirResults{{Name: "p/q", Summary: counts("C", 1)}},
+		Files:         []glocc.FileResult{fr, {Name: "b.c", Loc: counts("C", 0)}},
+		Summary:       counts("Go", 10),
+		FileCounts:    counts("Go", 1),
+		Blank:         2,
+		Comment:       3,
+		Lines:         glocc.LineCounts{"Go": {Code: 10, Comment: 3, Blank: 2}, "C": {Code: 1}},
+		Excluded:      1,
+		Duplicates:    4,
+		Directives:    5,
+		Markers:       counts("Go", 6),
+		Branches:      counts("Go", 7),
+		Statements:    counts("Go", 12),
+		Documentation: counts("Markdown", 8),
+		Data:          counts("JSON", 9),
+		Generated:     counts("Go", 11),
+		Histogram:     glocc.Histogram{"Go": {0, 1, 0, 300}, "C": {1}},
+		Minified:      13,
+		Unrecognized:  []string{"x.swift", "y.swift"},
+		ElidedFiles:   14,
+		Highlights:    &glocc.Highlights{LargestFile: "p/a.go", LargestFileLoc: 10, DeepestDir: "p/q", DeepestDirDepth: 1},
+		TopFiles:      &glocc.TopFiles{Limit: 2, Files: map[string][]glocc.FileLocation{"Go": {{Path: "p/a.go", Loc: 10}, {Path: "p/b.go", Loc: 1}}}},
+		LicenseFile:   "LICENSE",
+		License:       "MIT",
+		Errors:        []string{"a", "b"},
+	}
+	checkAllFieldsSet(t, want)
+	checkAllFieldsSet(t, fr)
+	checkAllFieldsSet(t, *want.Highlights)
+	checkAllFieldsSet(t, *want.TopFiles)
+
+	if got := decodeDirResult(t, encodeDirResult(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Decoded DirResult = %+v; want %+v", got, want)
+	}
+	if got := decodeDirResult(t, encodeDirResult(glocc.DirResult{})); !reflect.DeepEqual(got, glocc.DirResult{}) {
+		t.Errorf("Decoded empty DirResult = %+v; want none of its fields set", got)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/ckatsak/glocc"
+)
+
+// The ID of the SARIF rule that oversize files violate.
+const sarifOversizeRule = "oversize-file"
+
+// Minimal subset of the SARIF 2.1.0 log format, as understood by most
+// code-scanning dashboards.
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID     string          `json:"ruleId"`
+	Level      string          `json:"level"`
+	Message    sarifMessage    `json:"message"`
+	Locations  []sarifLocation `json:"locations"`
+	Properties sarifProperties `json:"properties"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation struct {
+		ArtifactLocation struct {
+			URI string `json:"uri"`
+		} `json:"artifactLocation"`
+	} `json:"physicalLocation"`
+}
+
+type sarifProperties struct {
+	Loc int `json:"loc"`
+}
+
+// Reports whether the given severity is a valid SARIF level for findings.
+func validSARIFLevel(level string) bool {
+	switch level {
+	case "note", "warning", "error":
+		return true
+	}
+	return false
+}
+
+// Print a finding, in SARIF format, for each of the files of the given total
+// results that have more than maxLoc lines of code, and return the number of
+// findings. The results must have been counted without Options.SummaryOnly
+// set; see oversizeFiles for the arguments they were counted for.
+func displaySARIF(result glocc.DirResult, args []string, maxLoc int, level string) int {
+	log := sarifFindings(result, args, maxLoc, level)
+	if output, err := json.MarshalIndent(log, "", "   "); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	} else {
+		fmt.Println(string(output))
+	}
+	return len(log.Runs[0].Results)
+}
+
+// Returns the SARIF log of the findings printed by displaySARIF.
+func sarifFindings(result glocc.DirResult, args []string, maxLoc int, level string) sarifLog {
+	log := sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "glocc",
+				InformationURI: "https://github.com/ckatsak/glocc",
+				Rules: []sarifRule{{
+					ID:               sarifOversizeRule,
+					ShortDescription: sarifMessage{fmt.Sprintf("Files should not have more than %d lines of code.", maxLoc)},
+				}},
+			}},
+			Results: make([]sarifResult, 0),
+		}},
+	}
+	for _, file := range oversizeFiles(result, args, maxLoc) {
+		finding := sarifResult{
+			RuleID:     sarifOversizeRule,
+			Level:      level,
+			Message:    sarifMessage{fmt.Sprintf("File has %d lines of code, more than the maximum of %d.", file.Loc, maxLoc)},
+			Locations:  make([]sarifLocation, 1),
+			Properties: sarifProperties{Loc: file.Loc},
+		}
+		finding.Locations[0].PhysicalLocation.ArtifactLocation.URI = filepath.ToSlash(file.Path)
+		log.Runs[0].Results = append(log.Runs[0].Results, finding)
+	}
+	return log
+}
+
+// Returns the files of the given total results that have more than maxLoc
+// lines of code, sorted by lines of code in descending order. If the results
+// were counted for the given arguments (i.e. each of their subdirectories for
+// the argument at the same position), a file that was an argument itself is
+// reported by the path it was given as, rather than by its base name.
+func oversizeFiles(result glocc.DirResult, args []string, maxLoc int) []glocc.FileReport {
+	var files []glocc.FileReport
+	for i, sub := range result.Subdirs {
+		for _, file := range sub.Report(glocc.ReportOptions{TopFiles: math.MaxInt32}).TopFiles {
+			// The files of the report are sorted by lines of code, in
+			// descending order.
+			if file.Loc <= maxLoc {
+				break
+			}
+			if i < len(args) && sub.Subdirs == nil && len(sub.Files) == 1 && file.Path == sub.Name {
+				file.Path = filepath.Clean(args[i])
+			}
+			files = append(files, file)
+		}
+	}
+	sort.SliceStable(files, func(i, j int) bool { return files[i].Loc > files[j].Loc })
+	return files
+}
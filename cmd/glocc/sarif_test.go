@@ -0,0 +1,51 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ckatsak/glocc"
+)
+
+func TestSARIFFindings(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Now()
+	writeFileAt(t, filepath.Join(dir, "d", "x.go"), "package x\n\nvar a = 1\nvar b = 2\n", t0)
+	writeFileAt(t, filepath.Join(dir, "d", "small.go"), "package x\n", t0)
+	writeFileAt(t, filepath.Join(dir, "e", "y.go"), "package y\n\nvar a = 1\nvar b = 2\nvar c = 3\n", t0)
+	args := []string{filepath.Join(dir, "d"), filepath.Join(dir, "e", "y.go")}
+
+	log := sarifFindings(gloccMain(args, glocc.Options{}, countConfig{}), args, 2, "warning")
+	var uris []string
+	for _, finding := range log.Runs[0].Results {
+		if finding.RuleID != sarifOversizeRule || finding.Level != "warning" {
+			t.Errorf("Unexpected finding %+v", finding)
+		}
+		uris = append(uris, finding.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	}
+	// A file given as an argument is reported by its path, not its base
+	// name, and the findings are sorted by lines of code.
+	want := []string{filepath.ToSlash(args[1]), filepath.ToSlash(filepath.Join(args[0], "x.go"))}
+	if !reflect.DeepEqual(uris, want) {
+		t.Errorf("SARIF findings are for %q; want %q", uris, want)
+	}
+	if loc := log.Runs[0].Results[0].Properties.Loc; loc != 4 {
+		t.Errorf("SARIF finding of %s has %d lines of code; want 4", uris[0], loc)
+	}
+}
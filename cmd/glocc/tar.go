@@ -0,0 +1,98 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ckatsak/glocc"
+)
+
+// The suffixes of the names of the (possibly compressed) tar archives that are
+// counted by their contents.
+var tarballSuffixes = []string{".tar", ".tar.gz", ".tgz", ".tar.zst", ".tzst"}
+
+// Reports whether the given path is named like a tar archive.
+func isTarball(path string) bool {
+	return hasAnySuffix(path, tarballSuffixes)
+}
+
+// Reports whether the given path ends with any of the given (lowercase)
+// suffixes, ignoring case.
+func hasAnySuffix(path string, suffixes []string) bool {
+	for _, suffix := range suffixes {
+		if strings.HasSuffix(strings.ToLower(path), suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reads the Zstandard-compressed tar archive read from r into a new TarFS,
+// decompressing it using the zstd command line tool.
+func readZstdTarball(r io.Reader) (*glocc.TarFS, error) {
+	cmd := exec.Command("zstd", "-d", "-c", "-q")
+	cmd.Stdin = r
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("zstd -d: %v", err)
+	}
+	t, err := glocc.NewTarFS(stdout)
+	// Let zstd finish, even if not all of its output was read.
+	io.Copy(io.Discard, stdout)
+	if waitErr := cmd.Wait(); err == nil && waitErr != nil {
+		err = fmt.Errorf("zstd -d: %v", waitErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// The suffixes of the names of the Zstandard-compressed tar archives, which are
+// decompressed using the zstd command line tool, since glocc.NewTarFS does not
+// support them.
+var zstdTarballSuffixes = []string{".tar.zst", ".tzst"}
+
+// Counts the contents of the tar archive at the given path, without extracting
+// it. The returned result is named after the archive.
+func countTarball(path string, opts glocc.Options) (glocc.DirResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return glocc.DirResult{Name: path}, err
+	}
+	defer file.Close()
+	var t *glocc.TarFS
+	if hasAnySuffix(path, zstdTarballSuffixes) {
+		t, err = readZstdTarball(file)
+	} else {
+		t, err = glocc.NewTarFS(file)
+	}
+	if err != nil {
+		return glocc.DirResult{Name: path}, err
+	}
+
+	result, err := glocc.CountLocFS(t, ".", opts)
+	result.Name = path
+	return result, err
+}
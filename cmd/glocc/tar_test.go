@@ -0,0 +1,53 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ckatsak/glocc"
+)
+
+func TestCountTarballZstd(t *testing.T) {
+	for _, tool := range []string{"tar", "zstd"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+	dir := t.TempDir()
+	writeFileAt(t, filepath.Join(dir, "src", "a.go"), "package a\n", time.Now())
+	tarball := filepath.Join(dir, "src.tar")
+	if output, err := exec.Command("tar", "-C", dir, "-cf", tarball, "src").CombinedOutput(); err != nil {
+		t.Fatalf("tar: %v: %s", err, output)
+	}
+	if output, err := exec.Command("zstd", "-q", "--rm", tarball).CombinedOutput(); err != nil {
+		t.Fatalf("zstd: %v: %s", err, output)
+	}
+	if _, err := os.Stat(tarball + ".zst"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := countTarball(tarball+".zst", glocc.Options{})
+	if err != nil {
+		t.Fatalf("countTarball(): %v", err)
+	}
+	if want := map[string]int{"Go": 1}; !reflect.DeepEqual(result.Summary, want) {
+		t.Errorf("countTarball().Summary = %v; want %v", result.Summary, want)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ckatsak/glocc"
+)
+
+// Returns the paths of the directories among the given command line arguments
+// to be watched, named the same way as their results (see relabel); any other
+// arguments (e.g. files or tarballs) are not watched.
+func watchRoots(args []string) []string {
+	var roots []string
+	for _, arg := range args {
+		if info, err := os.Stat(arg); err != nil || !info.IsDir() {
+			continue
+		}
+		root := filepath.Clean(arg)
+		if *absPathsFlag {
+			if abs, err := filepath.Abs(arg); err == nil {
+				root = abs
+			}
+		}
+		roots = append(roots, root)
+	}
+	return roots
+}
+
+// A snapshot of the directories being watched: for each of them, the latest
+// modification time among the directory itself and its files, which changes
+// whenever any of its files is written, or any of its entries is created,
+// removed or renamed.
+type dirSnapshot map[string]time.Time
+
+// Takes a snapshot of the directories under the given roots, except for .git
+// directories.
+func takeSnapshot(roots []string) dirSnapshot {
+	snapshot := make(dirSnapshot)
+	for _, root := range roots {
+		filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry == nil {
+				return nil
+			}
+			if entry.IsDir() && entry.Name() == ".git" && path != root {
+				return filepath.SkipDir
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return nil
+			}
+			dir := path
+			if !entry.IsDir() {
+				dir = filepath.Dir(path)
+			}
+			if mtime := info.ModTime(); mtime.After(snapshot[dir]) {
+				snapshot[dir] = mtime
+			}
+			return nil
+		})
+	}
+	return snapshot
+}
+
+// Returns the directories that changed between the two snapshots (or are new),
+// except for those under another one of them, which are re-counted along with
+// it anyway.
+func changedDirs(old, new dirSnapshot) []string {
+	var changed []string
+	for dir, mtime := range new {
+		if prev, found := old[dir]; !found || !prev.Equal(mtime) {
+			changed = append(changed, dir)
+		}
+	}
+	sort.Strings(changed)
+	var topmost []string
+	for _, dir := range changed {
+		covered := false
+		for _, top := range topmost {
+			if isUnderDir(dir, top) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			topmost = append(topmost, dir)
+		}
+	}
+	return topmost
+}
+
+// Returns the subtree of the given results with the given Name, or nil if
+// there is none.
+func findSubtree(result *glocc.DirResult, name string) *glocc.DirResult {
+	if result.Name == name {
+		return result
+	}
+	for i := range result.Subdirs {
+		if sub := findSubtree(&result.Subdirs[i], name); sub != nil {
+			return sub
+		}
+	}
+	return nil
+}
+
+// Re-counts each of the given directories, as part of the root (among the given
+// ones) that it lies under, and splices its results into the given total
+// results, whose summaries are thus recomputed. It returns the summaries of the
+// directories whose results changed, by name.
+func recount(totalResults *glocc.DirResult, roots, dirs []string, opts glocc.Options) map[string]map[string]int {
+	updated := make(map[string]map[string]int)
+	for _, dir := range dirs {
+		for _, root := range roots {
+			if !isUnderDir(dir, root) {
+				continue
+			}
+			// Re-count the nearest directory that is in the results, in
+			// case dir is not (e.g. if new, or pruned by -prune-empty).
+			for dir != root && findSubtree(totalResults, dir) == nil {
+				dir = filepath.Dir(dir)
+			}
+			result, err := glocc.CountSubdir(root, dir, opts)
+			if err != nil {
+				if opts.Context == nil || opts.Context.Err() == nil {
+					fmt.Fprintln(os.Stderr, err)
+				}
+				break
+			}
+			if abs, err := filepath.Abs(root); err == nil && !*absPathsFlag {
+				relabel(&result, abs, root)
+			}
+			if old := findSubtree(totalResults, result.Name); old != nil {
+				if !reflect.DeepEqual(old.Summary, result.Summary) {
+					updated[result.Name] = result.Summary
+				}
+				totalResults.Splice(result)
+			}
+			break
+		}
+	}
+	return updated
+}
+
+// Reports whether the given path is the same as, or lies under, the given
+// directory.
+func isUnderDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Watches the directories among the given command line arguments, whose total
+// results have already been counted and printed, polling them for changes
+// every interval, until interrupted (i.e. using Ctrl-C). On every change, only
+// the changed directories are re-counted, and their updated summaries printed
+// using displayFunc.
+func watchMain(args []string, opts glocc.Options, totalResults glocc.DirResult, displayFunc func(interface{}), interval time.Duration) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	opts.Context = ctx
+
+	roots := watchRoots(args)
+	snapshot := takeSnapshot(roots)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		newSnapshot := takeSnapshot(roots)
+		dirs := changedDirs(snapshot, newSnapshot)
+		snapshot = newSnapshot
+		if len(dirs) == 0 {
+			continue
+		}
+		if updated := recount(&totalResults, roots, dirs, opts); len(updated) > 0 {
+			displayFunc(updated)
+		}
+	}
+}
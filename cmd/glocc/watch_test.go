@@ -0,0 +1,90 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ckatsak/glocc"
+)
+
+func TestChangedDirs(t *testing.T) {
+	t0, t1 := time.Unix(1000, 0), time.Unix(2000, 0)
+	old := dirSnapshot{"p": t0, "p/a": t0, "p/a/x": t0, "p/b": t0, "p-c": t0}
+	new := dirSnapshot{"p": t0, "p/a": t1, "p/a/x": t1, "p/b": t0, "p-c": t1, "q": t0}
+	want := []string{"p-c", "p/a", "q"}
+	if got := changedDirs(old, new); !reflect.DeepEqual(got, want) {
+		t.Errorf("changedDirs() = %q; want %q", got, want)
+	}
+	if got := changedDirs(new, new); len(got) != 0 {
+		t.Errorf("changedDirs() of the same snapshot = %q; want none", got)
+	}
+}
+
+// Writes the given content to the file with the given path, setting its
+// modification time, so that changes are detected regardless of the
+// resolution of the timestamps of the filesystem.
+func writeFileAt(t *testing.T, path, content string, mtime time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchRecount(t *testing.T) {
+	dir := t.TempDir()
+	t0 := time.Now().Add(time.Hour) // later than the directories
+	root := filepath.Join(dir, "p")
+	writeFileAt(t, filepath.Join(root, "a", "a.go"), "package a\n", t0)
+	writeFileAt(t, filepath.Join(root, "b", "b.py"), "b = 1\n", t0)
+
+	args := []string{root}
+	totalResults := gloccMain(args, glocc.Options{}, countConfig{})
+	roots := watchRoots(args)
+	snapshot := takeSnapshot(roots)
+
+	// Modify a file of one subdirectory only.
+	writeFileAt(t, filepath.Join(root, "a", "a.go"), "package a\n\nvar a = 1\n", t0.Add(time.Minute))
+	newSnapshot := takeSnapshot(roots)
+	dirs := changedDirs(snapshot, newSnapshot)
+	if want := []string{filepath.Join(root, "a")}; !reflect.DeepEqual(dirs, want) {
+		t.Fatalf("changedDirs() = %q; want %q", dirs, want)
+	}
+	updated := recount(&totalResults, roots, dirs, glocc.Options{})
+	want := map[string]map[string]int{filepath.Join(root, "a"): {"Go": 2}}
+	if !reflect.DeepEqual(updated, want) {
+		t.Errorf("recount() = %v; want %v", updated, want)
+	}
+	if want := map[string]int{"Go": 2, "Python": 1}; !reflect.DeepEqual(totalResults.Summary, want) {
+		t.Errorf("Summary after recount() = %v; want %v", totalResults.Summary, want)
+	}
+
+	// A change that does not affect the lines of code is not reported.
+	writeFileAt(t, filepath.Join(root, "b", "notes"), "no language\n", t0.Add(2*time.Minute))
+	snapshot, newSnapshot = newSnapshot, takeSnapshot(roots)
+	if updated := recount(&totalResults, roots, changedDirs(snapshot, newSnapshot), glocc.Options{}); len(updated) != 0 {
+		t.Errorf("recount() = %v; want no updates", updated)
+	}
+}
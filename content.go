@@ -0,0 +1,184 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"path"
+	"regexp"
+)
+
+// The maximum number of bytes read at the beginning of a file, when validating
+// its content against the language detected by its extension.
+const contentValidationLen = 8192
+
+// A content signature, which, when matched by the beginning of a file detected
+// to be written in one of a few languages by its extension, strongly suggests
+// that it is actually written in another one.
+type contentSignature struct {
+	// The languages of the files the signature applies to.
+	from []string
+	// Returns the name of the language the content suggests, if any, given
+	// the beginning of the content and whether that is the whole of it.
+	match func(head []byte, complete bool) string
+}
+
+var (
+	// e.g. "#!/bin/sh", "#!/usr/bin/env python3"
+	shebang = regexp.MustCompile(`^#!\s*(?:/usr/bin/env\s+(?:-\S+\s+)*)?(\S+)`)
+	// e.g. "namespace foo {", "template <typename T>", "class Foo : public Bar", "std::string"
+	cppSignature = regexp.MustCompile(`(?m)^\s*(?:namespace\s+\w+\s*\{|template\s*<|class\s+\w+\s*(?::\s*(?:public|protected|private)\b|\{)|(?:public|protected|private):)|\bstd::\w`)
+	// The trailing version of interpreters, e.g. "python3.8".
+	interpreterVersion = regexp.MustCompile(`[\d.]+$`)
+)
+
+// The names used for the interpreters of some languages in shebang lines, that
+// are neither the name nor one of the extensions of the corresponding
+// language.
+var interpreterAliases = map[string]string{
+	"bash": "Shell",
+	"dash": "Shell",
+	"ksh":  "Shell",
+	"node": "Javascript",
+	"zsh":  "Shell",
+}
+
+var contentSignatures = []contentSignature{
+	{
+		from: []string{"plain text"},
+		match: func(head []byte, complete bool) string {
+			trimmed := bytes.TrimSpace(head)
+			if complete && len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') && json.Valid(trimmed) {
+				return "JSON"
+			}
+			return ""
+		},
+	},
+	{
+		from: []string{"plain text"},
+		match: func(head []byte, complete bool) string {
+			if lang, found := shebangLanguage(head); found {
+				return lang.name
+			}
+			return ""
+		},
+	},
+	{
+		from: []string{"C"},
+		match: func(head []byte, complete bool) string {
+			if cppSignature.Match(head) {
+				return "C++"
+			}
+			return ""
+		},
+	},
+}
+
+// Returns the language of the interpreter declared in the shebang line at the
+// beginning of the given content, if any, and whether it is supported.
+func shebangLanguage(head []byte) (language, bool) {
+	m := shebang.FindSubmatch(head)
+	if m == nil {
+		return language{}, false
+	}
+	interpreter := interpreterVersion.ReplaceAllString(path.Base(string(m[1])), "")
+	if name, exists := interpreterAliases[interpreter]; exists {
+		interpreter = name
+	}
+	return languageByAlias(interpreter)
+}
+
+// Validates the beginning of the content read from r against the given
+// language, as detected by the extension of the file with the given name (only
+// used for logging). If the content strongly suggests another language, it
+// logs a warning, and returns that language instead if Options.ReclassifyContent
+// is set. It also returns a reader that yields the whole content of r,
+// including the bytes that were validated.
+func (t *traversal) validateContent(r io.Reader, filename string, lang language) (language, io.Reader, error) {
+	head := make([]byte, contentValidationLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return lang, r, err
+	}
+	head = head[:n]
+	r = io.MultiReader(bytes.NewReader(head), r)
+	for _, sig := range contentSignatures {
+		if !stringsContain(sig.from, lang.name) {
+			continue
+		}
+		name := sig.match(head, n < contentValidationLen)
+		if name == "" || name == lang.name {
+			continue
+		}
+		suggested, found := languagesByName[name]
+		if !found {
+			continue
+		}
+		if !t.opts.ReclassifyContent {
+			logger.Printf("WARNING %q is detected as %s by its extension, but its content looks like %s.\n", filename, lang.name, suggested.name)
+			return lang, r, nil
+		}
+		logger.Printf("WARNING Counting %q as %s, rather than as %s, according to its content.\n", filename, suggested.name, lang.name)
+		return suggested, r, nil
+	}
+	return lang, r, nil
+}
+
+// Reports whether s is one of the given strings.
+func stringsContain(ss []string, s string) bool {
+	for _, candidate := range ss {
+		if candidate == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ShebangSniffer is a content sniffer, to be used as Options.ContentSniffer,
+// that detects the language of scripts by the interpreter declared in their
+// shebang line (e.g. "#!/usr/bin/env python3" for Python), so that every
+// script is counted regardless of its extension.
+func ShebangSniffer(head []byte) string {
+	if lang, found := shebangLanguage(head); found {
+		return lang.name
+	}
+	return ""
+}
+
+// Sniffs the language of the content read from r using
+// Options.ContentSniffer, given the file with the given name (only used for
+// logging). It returns the language and whether one was detected, along with a
+// reader that yields the whole content of r, including the bytes that were
+// sniffed.
+func (t *traversal) sniffContent(r io.Reader, filename string) (language, bool, io.Reader, error) {
+	head := make([]byte, contentValidationLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return language{}, false, r, err
+	}
+	head = head[:n]
+	r = io.MultiReader(bytes.NewReader(head), r)
+	name := t.opts.ContentSniffer(head)
+	if name == "" {
+		return language{}, false, r, nil
+	}
+	lang, found := t.languageByName(name)
+	if !found {
+		logger.Printf("WARNING %q is sniffed as unsupported language %q; ignoring.\n", filename, name)
+	}
+	return lang, found, r, nil
+}
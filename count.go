@@ -15,10 +15,17 @@
 package glocc
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -40,11 +47,101 @@ import (
 // associated with this DirResult.
 //
 // - Summary provides a summary of the results of the counting.
+//
+// - FileCounts is the number of files that contain lines of each language
+// (see also Histogram).
+//
+// - Blank is the total number of blank lines.
+//
+// - Comment is the total number of comment lines (see FileResult).
+//
+// - Lines are the lines of code, comment lines and blank lines per language
+// (see FileResult).
+//
+// - Excluded is the total number of lines excluded from the count because
+// they matched Options.ExcludeLinePattern.
+//
+// - Duplicates is the total number of lines of code that are exact duplicates
+// of lines of code seen elsewhere, if Options.DetectDuplicates was set.
+//
+// - Directives is the total number of commented-out lines that were
+// classified as directives, if Options.DirectivePatterns was set.
+//
+// - Markers is the number of comment lines that contain any of the markers in
+// Options.Markers, per language.
+//
+// - Branches is the number of branching keywords and operators in the code,
+// per language, if Options.CountBranches was set (see FileResult).
+//
+// - Statements is the number of statements in the code, per language, if
+// Options.CountStatements was set (see FileResult).
+//
+// - Documentation is the number of lines of documentation languages, per
+// language, if Options.SeparateDocumentation was set; they are not included in
+// the Summary then.
+//
+// - Data is the number of lines of the data files, per language, if
+// Options.DataExtensions was set; they are not included in the Summary then.
+//
+// - Generated is the number of lines of generated files, per language, if
+// Options.SeparateGenerated was set; they are not included in the Summary
+// then.
+//
+// - Histogram is the distribution of the sizes of the files, per language, if
+// Options.Histogram was set.
+//
+// - Minified is the total number of files that were skipped because they were
+// detected to be minified.
+//
+// - Unrecognized are the paths (relative to the directory) of the files that
+// were skipped because their language could not be detected, although they
+// are expected to be source code according to Options.SourceExtensions.
+//
+// - Highlights are the largest file and the deepest directory under the
+// directory, if Options.Highlights was set.
+//
+// - TopFiles are the largest files of each language under the directory, if
+// Options.TopFiles was set.
+//
+// - ElidedFiles is the number of files of the directory (not of its
+// subdirectories) whose FileResults were not retained in Files, because of
+// Options.MaxFilesPerDir; they are still accounted for in the summary.
+//
+// - LicenseFile and License are the name of the license file at the top level
+// of the directory, if any, and the SPDX identifier of its license (e.g.
+// "MIT"), if it could be identified, respectively; they are only set in the
+// DirResult of the root, if Options.DetectLicense was set.
+//
+// - Errors contains the messages of any unexpected errors that occurred while
+// counting the directory and its files. If the DirResults of its subdirectories
+// are not retained (see Options.SummaryOnly), their errors are included too.
 type DirResult struct {
-	Name    string         `json:"name" yaml:"Name"`
-	Subdirs DirResults     `json:"subdirs,omitempty" yaml:"subdirs,omitempty"`
-	Files   []FileResult   `json:"files,omitempty" yaml:"files,omitempty"`
-	Summary map[string]int `json:"summary" yaml:"Summary"`
+	Name          string         `json:"name" yaml:"Name"`
+	Subdirs       DirResults     `json:"subdirs,omitempty" yaml:"subdirs,omitempty"`
+	Files         []FileResult   `json:"files,omitempty" yaml:"files,omitempty"`
+	Summary       map[string]int `json:"summary" yaml:"Summary"`
+	FileCounts    map[string]int `json:"fileCounts,omitempty" yaml:"fileCounts,omitempty"`
+	Blank         int            `json:"blank,omitempty" yaml:"blank,omitempty"`
+	Comment       int            `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Lines         LineCounts     `json:"lines,omitempty" yaml:"lines,omitempty"`
+	Excluded      int            `json:"excluded,omitempty" yaml:"excluded,omitempty"`
+	Duplicates    int            `json:"duplicates,omitempty" yaml:"duplicates,omitempty"`
+	Directives    int            `json:"directives,omitempty" yaml:"directives,omitempty"`
+	Markers       map[string]int `json:"markers,omitempty" yaml:"markers,omitempty"`
+	Branches      map[string]int `json:"branches,omitempty" yaml:"branches,omitempty"`
+	Statements    map[string]int `json:"statements,omitempty" yaml:"statements,omitempty"`
+	Documentation map[string]int `json:"documentation,omitempty" yaml:"documentation,omitempty"`
+	Data          map[string]int `json:"data,omitempty" yaml:"data,omitempty"`
+	Generated     map[string]int `json:"generated,omitempty" yaml:"generated,omitempty"`
+	Histogram     Histogram      `json:"histogram,omitempty" yaml:"histogram,omitempty"`
+	Minified      int            `json:"minified,omitempty" yaml:"minified,omitempty"`
+	Unrecognized  []string       `json:"unrecognized,omitempty" yaml:"unrecognized,omitempty"`
+	ElidedFiles   int            `json:"elidedFiles,omitempty" yaml:"elidedFiles,omitempty"`
+	Highlights    *Highlights    `json:"highlights,omitempty" yaml:"highlights,omitempty"`
+	TopFiles      *TopFiles      `json:"topFiles,omitempty" yaml:"topFiles,omitempty"`
+	LicenseFile   string         `json:"licenseFile,omitempty" yaml:"licenseFile,omitempty"`
+	License       string         `json:"license,omitempty" yaml:"license,omitempty"`
+	Errors        []string       `json:"errors,omitempty" yaml:"errors,omitempty"`
 }
 
 // DirResults is a slice of DirResult.
@@ -52,9 +149,81 @@ type DirResults []DirResult
 
 // FileResult is a simple data structure used to store the results of a single
 // file's count. FileResult structs typically live inside DirResult structs.
+//
+// Blank is the number of blank lines in the file.
+//
+// Lines are the lines of code, comment lines and blank lines of the file, per
+// language (e.g. of a Markdown file, and of the code blocks in it), whose
+// totals are those of Loc, Comment and Blank. They are not affected by
+// Options.SeparateDocumentation, DataExtensions and SeparateGenerated, so the
+// lines of code they include are not necessarily in Loc.
+//
+// Comment is the number of comment lines in the file, i.e. of non-blank lines
+// that are not counted as lines of code because they are commented out, except
+// for those counted as Directives.
+//
+// Excluded is the number of lines excluded from the count because they
+// matched Options.ExcludeLinePattern.
+//
+// Duplicates is the number of lines of code that are exact duplicates of
+// lines of code seen elsewhere, if Options.DetectDuplicates was set.
+//
+// Directives is the number of commented-out lines that were classified as
+// directives, if Options.DirectivePatterns was set.
+//
+// Markers is the number of comment lines that contain any of the markers in
+// Options.Markers, per language.
+//
+// Branches is the number of occurrences of branching keywords and operators
+// (e.g. `if`, `for`, `case` or `&&`) in the code of the file, per language, if
+// Options.CountBranches was set; a cheap (and merely heuristic) proxy of its
+// cyclomatic complexity.
+//
+// Statements is the number of statements in the code of the file (i.e. of the
+// semicolons outside of string literals and comments), per language, if
+// Options.CountStatements was set; only languages that terminate statements
+// with semicolons are included (see StatementDensity).
+//
+// Documentation is the number of lines of documentation languages, per
+// language, if Options.SeparateDocumentation was set; they are not included in
+// Loc then.
+//
+// Data is the number of lines of the file, per language, if it is a data file
+// according to Options.DataExtensions; they are not included in Loc then.
+//
+// Generated is the number of lines of the file, per language, if it is a
+// generated file and Options.SeparateGenerated was set; they are not included
+// in Loc then.
+//
+// Size and ModTime are the size (in bytes) and the modification time of the
+// file, if Options.IncludeFileInfo was set; ModTime is nil otherwise.
+//
+// Minified is true if the file was skipped because it was detected to be
+// minified (see Options.SkipMinified and MinifiedLineLength), in which case
+// none of its lines are counted.
+//
+// Unrecognized is true if the file was skipped because its language could not
+// be detected, although it is expected to be source code according to
+// Options.SourceExtensions, in which case none of its lines are counted.
 type FileResult struct {
-	Name string         `json:"name" yaml:"Name,omitempty"`
-	Loc  map[string]int `json:"loc" yaml:"loc,omitempty,inline"`
+	Name          string         `json:"name" yaml:"Name,omitempty"`
+	Loc           map[string]int `json:"loc" yaml:"loc,omitempty,inline"`
+	Blank         int            `json:"blank,omitempty" yaml:"blank,omitempty"`
+	Comment       int            `json:"comment,omitempty" yaml:"comment,omitempty"`
+	Lines         LineCounts     `json:"lines,omitempty" yaml:"lines,omitempty"`
+	Excluded      int            `json:"excluded,omitempty" yaml:"excluded,omitempty"`
+	Duplicates    int            `json:"duplicates,omitempty" yaml:"duplicates,omitempty"`
+	Directives    int            `json:"directives,omitempty" yaml:"directives,omitempty"`
+	Markers       map[string]int `json:"markers,omitempty" yaml:"markers,omitempty"`
+	Branches      map[string]int `json:"branches,omitempty" yaml:"branches,omitempty"`
+	Statements    map[string]int `json:"statements,omitempty" yaml:"statements,omitempty"`
+	Documentation map[string]int `json:"documentation,omitempty" yaml:"documentation,omitempty"`
+	Data          map[string]int `json:"data,omitempty" yaml:"data,omitempty"`
+	Generated     map[string]int `json:"generated,omitempty" yaml:"generated,omitempty"`
+	Size          int64          `json:"size,omitempty" yaml:"size,omitempty"`
+	ModTime       *time.Time     `json:"modTime,omitempty" yaml:"modTime,omitempty"`
+	Minified      bool           `json:"minified,omitempty" yaml:"minified,omitempty"`
+	Unrecognized  bool           `json:"unrecognized,omitempty" yaml:"unrecognized,omitempty"`
 }
 
 // Package-level logger.
@@ -80,7 +249,33 @@ func DisableLogging() {
 // CountLoc is the main exported interface of glocc package, meant to be called
 // once for each top-level directory in which counting lines of code is needed.
 // It returns a DirResult that contains the results of the counting.
+//
+// It is equivalent to calling CountLocWithOptions with the zero value of
+// Options, ignoring any error returned.
 func CountLoc(root string) DirResult {
+	result, _ := CountLocWithOptions(root, Options{})
+	return result
+}
+
+// CountLocContext is like CountLoc, but the counting is cancelled once the
+// given context is done (e.g. its deadline expires), in which case the results
+// gathered so far are returned, along with ctx.Err(). It is equivalent to
+// calling CountLocWithOptions with Options.Context set to ctx.
+func CountLocContext(ctx context.Context, root string) (DirResult, error) {
+	return CountLocWithOptions(root, Options{Context: ctx})
+}
+
+// CountLocWithOptions is like CountLoc, but the counting is configured by the
+// given Options. It returns a DirResult that contains the results of the
+// counting, and a non-nil error if root could not be counted at all.
+func CountLocWithOptions(root string, opts Options) (DirResult, error) {
+	return countLoc(root, opts, nil)
+}
+
+// Implements CountLocWithOptions, calling onDir (unless nil) with the
+// DirResult of each directory under root, as soon as it has been counted (see
+// CountLocDirStreamWithOptions).
+func countLoc(root string, opts Options, onDir func(DirResult)) (DirResult, error) {
 	start := time.Now()
 	result := DirResult{
 		Name:    root,
@@ -88,71 +283,660 @@ func CountLoc(root string) DirResult {
 		Files:   make([]FileResult, 0),
 		Summary: make(map[string]int),
 	}
+	if err := opts.Validate(); err != nil {
+		logger.Println("ERROR", err)
+		return result, err
+	}
 	rootPath, err := filepath.Abs(root)
 	if err != nil {
 		logger.Println("ERROR", err)
-		return result
+		return result, err
 	}
 	fileinfo, err := os.Stat(rootPath)
 	if err != nil {
 		logger.Println("ERROR", err)
-		return result
+		return result, err
+	}
+	t := newTraversal(opts, nil)
+	t.onDir = onDir
+	result = t.countRoot(root, rootPath, fileinfo)
+	logger.Printf("INFO Time elapsed for %q: %s\n", root, time.Since(start))
+	return result, t.err()
+}
+
+// CountLocFS is like CountLocWithOptions, but counts the file or directory
+// with the given (slash-separated) path in the given filesystem, instead of
+// the operating system's. This allows counting e.g. the tree of a git commit
+// (see NewGitFS) or any other filesystem abstraction, without extracting it to
+// disk.
+func CountLocFS(fsys fs.FS, root string, opts Options) (DirResult, error) {
+	start := time.Now()
+	result := DirResult{
+		Name:    root,
+		Subdirs: make(DirResults, 0),
+		Files:   make([]FileResult, 0),
+		Summary: make(map[string]int),
+	}
+	if err := opts.Validate(); err != nil {
+		logger.Println("ERROR", err)
+		return result, err
+	}
+	fileinfo, err := fs.Stat(fsys, root)
+	if err != nil {
+		logger.Println("ERROR", err)
+		return result, err
+	}
+	t := newTraversal(opts, fsys)
+	result = t.countRoot(root, root, fileinfo)
+	logger.Printf("INFO Time elapsed for %q: %s\n", root, time.Since(start))
+	return result, t.err()
+}
+
+// CountSubdir counts the directory subdir, which lies under root, the same
+// way as it is counted as part of CountLocWithOptions(root, opts): e.g. the
+// .gitignore files of root apply to it, as do Options.MaxDepth and OnlyPaths
+// (which are relative to root). Its DirResult can thus be spliced into the
+// results of a previous counting of root, after subdir has changed (see
+// Splice); like the DirResults of the subdirectories counted by
+// CountLocWithOptions, it is named after the absolute path of subdir.
+// Options.PostProcess and DetectLicense, which only apply to root itself, are
+// ignored.
+func CountSubdir(root, subdir string, opts Options) (DirResult, error) {
+	result := DirResult{
+		Name:    subdir,
+		Subdirs: make(DirResults, 0),
+		Files:   make([]FileResult, 0),
+		Summary: make(map[string]int),
+	}
+	if err := opts.Validate(); err != nil {
+		return result, err
+	}
+	rootPath, err := filepath.Abs(root)
+	if err != nil {
+		return result, err
+	}
+	subdirPath, err := filepath.Abs(subdir)
+	if err != nil {
+		return result, err
+	}
+	if rel, err := filepath.Rel(rootPath, subdirPath); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return result, fmt.Errorf("Directory %q is not under %q.", subdir, root)
+	}
+	if fileinfo, err := os.Stat(subdirPath); err != nil {
+		return result, err
+	} else if !fileinfo.IsDir() {
+		return result, fmt.Errorf("%q is not a directory.", subdir)
+	}
+	t := newTraversal(opts, nil)
+	t.root = rootPath
+	return t.locDir(subdirPath), t.err()
+}
+
+// Merges the results of counting a subdirectory into the DirResult. The
+// subdirectory's DirResult itself is only retained if keep is true.
+func (d *DirResult) addSubdir(dr DirResult, keep bool) {
+	if keep {
+		d.Subdirs = append(d.Subdirs, dr)
+	} else {
+		d.Errors = append(d.Errors, dr.Errors...)
+	}
+	d.mergeTotals(dr)
+	if d.Histogram != nil {
+		d.Histogram.merge(dr.Histogram)
+	}
+	if d.Highlights != nil {
+		d.Highlights.mergeSubdir(dr.Highlights)
+	}
+	if d.TopFiles != nil {
+		d.TopFiles.merge(dr.TopFiles)
+	}
+	for _, name := range dr.Unrecognized {
+		d.Unrecognized = append(d.Unrecognized, filepath.Join(filepath.Base(dr.Name), name))
+	}
+}
+
+// Adds the counts (i.e. the Summary, and all other totals that do not depend on
+// the position of the directories in the tree) of another DirResult to those of
+// the DirResult.
+func (d *DirResult) mergeTotals(dr DirResult) {
+	mergeSummary(d.Summary, dr.Summary)
+	mergeCounts(&d.FileCounts, dr.FileCounts)
+	d.Blank += dr.Blank
+	d.Comment += dr.Comment
+	mergeLineCounts(&d.Lines, dr.Lines)
+	d.Excluded += dr.Excluded
+	d.Duplicates += dr.Duplicates
+	d.Directives += dr.Directives
+	mergeCounts(&d.Markers, dr.Markers)
+	mergeCounts(&d.Branches, dr.Branches)
+	mergeCounts(&d.Statements, dr.Statements)
+	mergeCounts(&d.Documentation, dr.Documentation)
+	mergeCounts(&d.Data, dr.Data)
+	mergeCounts(&d.Generated, dr.Generated)
+	d.Minified += dr.Minified
+}
+
+// Records an unexpected error that occurred while counting the DirResult's
+// directory or one of its files. Errors caused by files or directories that
+// were removed while counting are considered benign, and are only logged.
+func (d *DirResult) addError(err error) {
+	if os.IsNotExist(err) {
+		logger.Printf("INFO Skipping: %v\n", err)
+		return
+	}
+	logger.Println("ERROR", err)
+	d.Errors = append(d.Errors, err.Error())
+}
+
+// Reports whether the DirResults of the subdirectories of the directory with
+// the given path should be retained in its Subdirs, according to the Options
+// of the traversal.
+func (t *traversal) keepSubdirs(dirPath string) bool {
+	return !t.opts.SummaryOnly || t.opts.SubdirSummaries && dirPath == t.root
+}
+
+// Reports whether the FileResult of another file should be retained in the
+// Files of the given DirResult, according to the Options of the traversal. If
+// it should not only because of Options.MaxFilesPerDir, it is recorded as
+// elided.
+func (t *traversal) keepFile(d *DirResult) bool {
+	if t.opts.SummaryOnly {
+		return false
+	}
+	if t.opts.MaxFilesPerDir > 0 && len(d.Files) >= t.opts.MaxFilesPerDir {
+		d.ElidedFiles++
+		return false
+	}
+	return true
+}
+
+// Merges the outcome of counting a file into the given DirResult, recording
+// its error, if any.
+func (t *traversal) addFileOutcome(d *DirResult, fo fileOutcome) {
+	if fo.err != nil {
+		d.addError(fo.err)
+	}
+	if fo.result != nil {
+		d.addFile(*fo.result, t.keepFile(d))
+	}
+}
+
+// Merges the results of counting a file into the DirResult. The FileResult
+// itself is only retained if keep is true.
+func (d *DirResult) addFile(fr FileResult, keep bool) {
+	if keep {
+		d.Files = append(d.Files, fr)
+	}
+	mergeSummary(d.Summary, fr.Loc)
+	d.Blank += fr.Blank
+	d.Comment += fr.Comment
+	mergeLineCounts(&d.Lines, fr.Lines)
+	d.Excluded += fr.Excluded
+	d.Duplicates += fr.Duplicates
+	d.Directives += fr.Directives
+	mergeCounts(&d.Markers, fr.Markers)
+	mergeCounts(&d.Branches, fr.Branches)
+	mergeCounts(&d.Statements, fr.Statements)
+	mergeCounts(&d.Documentation, fr.Documentation)
+	mergeCounts(&d.Data, fr.Data)
+	mergeCounts(&d.Generated, fr.Generated)
+	if fr.Minified {
+		d.Minified++
+		return
+	}
+	if fr.Unrecognized {
+		d.Unrecognized = append(d.Unrecognized, fr.Name)
+		return
+	}
+	for lang := range fr.Loc {
+		if d.FileCounts == nil {
+			d.FileCounts = make(map[string]int)
+		}
+		d.FileCounts[lang]++
+	}
+	if d.Histogram != nil {
+		d.Histogram.addFile(fr)
+	}
+	if d.Highlights != nil {
+		d.Highlights.addFile(d.Name, fr)
+	}
+	if d.TopFiles != nil {
+		d.TopFiles.addFile(d.Name, fr)
+	}
+}
+
+// Splice replaces the subtree of the DirResult whose Name is equal to the Name
+// of sub (which may also be the DirResult itself) with sub, recomputing the
+// summaries of all its ancestors accordingly. It returns false if no such
+// subtree was found.
+//
+// Splice is meant for updating a previously counted tree after re-counting
+// one of its subdirectories, using CountSubdir. It requires the tree to have been counted without
+// Options.SummaryOnly set; if it was counted with Options.MaxFilesPerDir set,
+// the files elided from the ancestors of sub are not accounted for in their
+// recomputed summaries.
+func (d *DirResult) Splice(sub DirResult) bool {
+	if d.Name == sub.Name {
+		*d = sub
+		return true
+	}
+	for i := range d.Subdirs {
+		if d.Subdirs[i].Splice(sub) {
+			d.recomputeSummary()
+			return true
+		}
+	}
+	return false
+}
+
+// PruneEmpty removes, recursively, the subdirectories of the DirResult whose
+// subtrees contain no counted lines of code (e.g. empty directories, or ones
+// containing only skipped files), so that they do not clutter the extensive
+// results. The summaries are left intact, since the pruned subdirectories do
+// not contribute to them anyway; the DirResult itself is never removed.
+func (d *DirResult) PruneEmpty() {
+	subdirs := d.Subdirs[:0]
+	for _, dr := range d.Subdirs {
+		total := 0
+		for _, loc := range dr.Summary {
+			total += loc
+		}
+		if total == 0 {
+			continue
+		}
+		dr.PruneEmpty()
+		subdirs = append(subdirs, dr)
+	}
+	d.Subdirs = subdirs
+}
+
+// Recomputes the summary of the DirResult from the results of its
+// subdirectories and files.
+func (d *DirResult) recomputeSummary() {
+	subdirs, files, histogram, highlights, topFiles := d.Subdirs, d.Files, d.Histogram, d.Highlights, d.TopFiles
+	*d = DirResult{
+		Name:    d.Name,
+		Subdirs: make(DirResults, 0, len(subdirs)),
+		Files:   make([]FileResult, 0, len(files)),
+		Summary: make(map[string]int),
+		Errors:  d.Errors,
+
+		ElidedFiles: d.ElidedFiles,
+		LicenseFile: d.LicenseFile,
+		License:     d.License,
+	}
+	if histogram != nil {
+		d.Histogram = make(Histogram)
+	}
+	if highlights != nil {
+		d.Highlights = &Highlights{DeepestDir: d.Name}
+	}
+	if topFiles != nil {
+		d.TopFiles = newTopFiles(topFiles.Limit)
+	}
+	for _, dr := range subdirs {
+		d.addSubdir(dr, true)
+	}
+	for _, fr := range files {
+		d.addFile(fr, true)
+	}
+}
+
+// Merges the results of counting another part of the same file into the
+// FileResult.
+func (f *FileResult) add(other FileResult) {
+	mergeSummary(f.Loc, other.Loc)
+	f.Blank += other.Blank
+	f.Comment += other.Comment
+	mergeLineCounts(&f.Lines, other.Lines)
+	f.Excluded += other.Excluded
+	f.Duplicates += other.Duplicates
+	f.Directives += other.Directives
+	mergeCounts(&f.Markers, other.Markers)
+	mergeCounts(&f.Branches, other.Branches)
+	mergeCounts(&f.Statements, other.Statements)
+	mergeCounts(&f.Documentation, other.Documentation)
+	mergeCounts(&f.Data, other.Data)
+	mergeCounts(&f.Generated, other.Generated)
+}
+
+// Moves the lines of the documentation languages out of the Loc of the
+// FileResult, into its Documentation (see Options.SeparateDocumentation).
+func (f *FileResult) separateDocumentation() {
+	for lang, n := range f.Loc {
+		if languagesByName[lang].category != categoryDocumentation {
+			continue
+		}
+		if f.Documentation == nil {
+			f.Documentation = make(map[string]int)
+		}
+		f.Documentation[lang] += n
+		delete(f.Loc, lang)
+	}
+}
+
+// Moves all lines out of the Loc of the FileResult, into its Data (see
+// Options.DataExtensions).
+func (f *FileResult) separateData() {
+	if len(f.Loc) == 0 {
+		return
+	}
+	mergeCounts(&f.Data, f.Loc)
+	f.Loc = make(map[string]int)
+}
+
+// Adds the lines of code of each language in src to those in dst.
+func mergeSummary(dst, src map[string]int) {
+	for lang, loc := range src {
+		dst[lang] += loc
+	}
+}
+
+// Like mergeSummary, but for optional counts, which are nil unless non-empty;
+// *dst is only allocated when there is anything to add to it.
+func mergeCounts(dst *map[string]int, src map[string]int) {
+	if len(src) == 0 {
+		return
+	}
+	if *dst == nil {
+		*dst = make(map[string]int, len(src))
+	}
+	mergeSummary(*dst, src)
+}
+
+// LineCounts are the lines of code, comment lines and blank lines per language
+// (see FileResult.Lines).
+type LineCounts map[string]LineCount
+
+// LineCount are the lines of code, comment lines and blank lines of a single
+// language.
+type LineCount struct {
+	Code    int `json:"code" yaml:"code"`
+	Comment int `json:"comment" yaml:"comment"`
+	Blank   int `json:"blank" yaml:"blank"`
+}
+
+// Like mergeCounts, but for LineCounts.
+func mergeLineCounts(dst *LineCounts, src LineCounts) {
+	if len(src) == 0 {
+		return
+	}
+	if *dst == nil {
+		*dst = make(LineCounts, len(src))
+	}
+	for lang, lc := range src {
+		sum := (*dst)[lang]
+		sum.Code += lc.Code
+		sum.Comment += lc.Comment
+		sum.Blank += lc.Blank
+		(*dst)[lang] = sum
+	}
+}
+
+// A traversal holds the configuration (and any other state) shared by all
+// goroutines spawned during a single call of CountLocWithOptions.
+type traversal struct {
+	opts Options
+
+	// The filesystem to count in, or nil for the operating system's.
+	fsys fs.FS
+
+	// Only non-nil if duplicate lines of code should be detected.
+	seenLines *lineSet
+
+	// Only non-nil if the hard links of the same file should be counted
+	// once (see Options.DedupHardLinks).
+	seenHardLinks *fileIDSet
+
+	// Only non-nil if symbolic links should be followed (see
+	// Options.FollowSymlinks).
+	symlinks *symlinkTargets
+
+	// Only non-nil if .gitattributes files should be taken into account.
+	gitAttributes *gitAttributesCache
+
+	// Only non-nil if the paths ignored by .gitignore files should be
+	// skipped (see Options.CountGitIgnored).
+	gitIgnore *gitIgnoreCache
+
+	// Limit the number of directories being read, and of files being
+	// counted, concurrently (see Options.DirWorkers and FileWorkers).
+	dirWorkers, fileWorkers semaphore
+
+	// The custom languages to be counted (see Options.CustomLanguages).
+	customLanguages []language
+
+	// Only non-nil if only some paths should be counted (see
+	// Options.OnlyPaths), in which case it also contains all of their
+	// parent directories. They are relative to root, the path of the
+	// directory being counted.
+	onlyPaths map[string]bool
+	root      string
+
+	// Only non-nil if the DirResult of each directory under root should be
+	// reported, as soon as it has been counted.
+	onDir func(DirResult)
+}
+
+// Returns a new traversal, configured by the given Options, to count in the
+// given filesystem (or the operating system's, if nil).
+func newTraversal(opts Options, fsys fs.FS) *traversal {
+	t := &traversal{opts: opts, fsys: fsys}
+	if opts.Duplicates != nil {
+		t.seenLines = opts.Duplicates.lines
+	} else if opts.DetectDuplicates {
+		t.seenLines = newLineSet()
+	}
+	if opts.DedupHardLinks && fsys == nil {
+		t.seenHardLinks = &fileIDSet{ids: make(map[fileID]struct{})}
+	}
+	if opts.FollowSymlinks && fsys == nil {
+		t.symlinks = &symlinkTargets{}
+	}
+	for _, lang := range opts.CustomLanguages {
+		t.customLanguages = append(t.customLanguages, lang.language())
+	}
+	if opts.Workers != nil {
+		t.dirWorkers, t.fileWorkers = opts.Workers.dirs, opts.Workers.files
+	} else {
+		t.dirWorkers = newSemaphore(opts.DirWorkers)
+		t.fileWorkers = newSemaphore(opts.FileWorkers)
+	}
+	if opts.OnlyPaths != nil {
+		t.onlyPaths = make(map[string]bool, len(opts.OnlyPaths))
+		for _, p := range opts.OnlyPaths {
+			for p = path.Clean(filepath.ToSlash(p)); p != "." && p != "/" && !t.onlyPaths[p]; p = path.Dir(p) {
+				t.onlyPaths[p] = true
+			}
+		}
+	}
+	if opts.UseGitAttributes {
+		t.gitAttributes = &gitAttributesCache{dirs: make(map[string]gitAttributesDir)}
+	}
+	if !opts.CountGitIgnored {
+		t.gitIgnore = &gitIgnoreCache{dirs: make(map[string]gitIgnoreDir)}
+	}
+	return t
+}
+
+// Reports whether the traversal has been cancelled through Options.Context.
+func (t *traversal) cancelled() bool {
+	return t.err() != nil
+}
+
+// Returns the error of Options.Context, if any.
+func (t *traversal) err() error {
+	if t.opts.Context == nil {
+		return nil
+	}
+	return t.opts.Context.Err()
+}
+
+// WorkerPool limits the number of directories being read, and of files being
+// counted, concurrently, across all countings that share it through
+// Options.Workers. It is safe for concurrent use.
+type WorkerPool struct {
+	dirs, files semaphore
+}
+
+// NewWorkerPool returns a new WorkerPool that allows up to dirWorkers
+// directories to be read, and up to fileWorkers files to be counted,
+// concurrently; a limit that is not positive means no limit (see
+// Options.DirWorkers and FileWorkers).
+func NewWorkerPool(dirWorkers, fileWorkers int) *WorkerPool {
+	return &WorkerPool{dirs: newSemaphore(dirWorkers), files: newSemaphore(fileWorkers)}
+}
+
+// A counting semaphore, limiting the number of goroutines that perform some
+// operation concurrently. A nil semaphore imposes no limit.
+type semaphore chan struct{}
+
+// Returns a new semaphore that allows up to n concurrent holders, or nil if n is
+// not positive.
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+	return make(semaphore, n)
+}
+
+// Blocks until the semaphore can be held.
+func (s semaphore) acquire() {
+	if s != nil {
+		s <- struct{}{}
+	}
+}
+
+// Releases the semaphore, which must have been acquired before.
+func (s semaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// Counts the file or directory at rootPath, as given by the user as root.
+func (t *traversal) countRoot(root, rootPath string, fileinfo os.FileInfo) DirResult {
+	result := DirResult{
+		Name:    root,
+		Subdirs: make(DirResults, 0),
+		Files:   make([]FileResult, 0),
+		Summary: make(map[string]int),
+	}
+	if t.opts.Histogram {
+		result.Histogram = make(Histogram)
 	}
 	if fileinfo.IsDir() {
-		result = locDir(rootPath)
+		t.root = rootPath
+		result = t.locDir(rootPath)
+		if t.opts.DetectLicense {
+			t.detectLicense(rootPath, &result)
+		}
 	} else if fileinfo.Mode().IsRegular() {
-		fileResult := locFile(rootPath)
-		result.Name = fileResult.Name
-		result.Subdirs = nil
-		result.Files = []FileResult{*fileResult}
-		result.Summary = fileResult.Loc
+		fileResult, err := t.locFile(rootPath, fileinfo)
+		if err != nil {
+			result.addError(err)
+		}
+		if fileResult != nil {
+			result.Name = fileResult.Name
+			result.Subdirs = nil
+			result.Files = nil
+			result.addFile(*fileResult, !t.opts.SummaryOnly)
+			if t.opts.Highlights {
+				result.Highlights = &Highlights{}
+				result.Highlights.addFile(t.dir(rootPath), *fileResult)
+			}
+			if t.opts.TopFiles > 0 {
+				result.TopFiles = newTopFiles(t.opts.TopFiles)
+				result.TopFiles.addFile(t.dir(rootPath), *fileResult)
+			}
+		}
+	}
+	if t.opts.PostProcess != nil {
+		t.opts.PostProcess(&result)
 	}
-	logger.Printf("INFO Time elapsed for %q: %s\n", root, time.Since(start))
 	return result
 }
 
 // The core recursive function for diving into subdirectories, and for spawning
 // (per file and per subdirectory) and synchronizing the goroutines.
-func locDir(rootPath string) DirResult {
+func (t *traversal) locDir(rootPath string) DirResult {
 	result := DirResult{
 		Name:    rootPath,
-		Subdirs: make(DirResults, 0),
-		Files:   make([]FileResult, 0),
 		Summary: make(map[string]int),
 	}
-	if filepath.Base(rootPath) == ".git" {
-		logger.Printf("INFO Skipping %q.\n", rootPath)
+	if !t.opts.SummaryOnly {
+		result.Subdirs = make(DirResults, 0)
+		result.Files = make([]FileResult, 0)
+	} else if t.keepSubdirs(rootPath) {
+		result.Subdirs = make(DirResults, 0)
+	}
+	if t.opts.Histogram {
+		result.Histogram = make(Histogram)
+	}
+	if reason := t.skipDir(rootPath); reason != "" {
+		logger.Printf("INFO Skipping %q: %s.\n", rootPath, reason)
 		return result
 	}
-	// open(2) the directory to readdir(2) and stat(2) it.
-	dir, err := os.Open(rootPath)
-	if err != nil {
-		logger.Println("ERROR", err)
+	if t.cancelled() {
 		return result
 	}
-	defer dir.Close()
-	fileinfoz, err := dir.Readdir(0)
+	t.dirWorkers.acquire()
+	fileinfoz, err := t.readDir(rootPath)
+	t.dirWorkers.release()
 	if err != nil {
-		logger.Println("ERROR", err)
+		result.addError(err)
+		t.reportDir(result)
 		return result
 	}
+	if t.opts.Highlights {
+		result.Highlights = &Highlights{DeepestDir: rootPath}
+	}
+	if t.opts.TopFiles > 0 {
+		result.TopFiles = newTopFiles(t.opts.TopFiles)
+	}
+
+	if t.opts.Sequential {
+		sort.Slice(fileinfoz, func(i, j int) bool {
+			return fileinfoz[i].Name() < fileinfoz[j].Name()
+		})
+	}
 
-	// Spawn one goroutine per subdirectory, and another one per file.
+	// Spawn one goroutine per subdirectory, and another one per file, unless
+	// counting sequentially.
 	dirResultsChan := make(chan DirResult)
-	fileResultsChan := make(chan *FileResult)
+	fileResultsChan := make(chan fileOutcome)
 	count := 0
 	for _, fileinfo := range fileinfoz {
-		filename := filepath.Join(rootPath, fileinfo.Name())
-		if fileinfo.IsDir() {
+		if t.cancelled() {
+			break
+		}
+		filename := t.join(rootPath, fileinfo.Name())
+		if fileinfo.Mode()&os.ModeSymlink != 0 && t.symlinks != nil {
+			target, reason := t.resolveSymlink(filename)
+			if target == nil {
+				logger.Printf("WARNING Skipping symbolic link %q: %s.\n", filename, reason)
+				continue
+			}
+			fileinfo = target
+		}
+		if fileinfo.IsDir() && t.opts.Sequential {
+			result.addSubdir(t.locDir(filename), t.keepSubdirs(rootPath))
+		} else if fileinfo.IsDir() {
 			count++
 			go func(path string) {
-				dirResultsChan <- locDir(path)
+				dirResultsChan <- t.locDir(path)
 			}(filename)
+		} else if fileinfo.Mode().IsRegular() && t.opts.Sequential {
+			fr, err := t.locFile(filename, fileinfo)
+			t.addFileOutcome(&result, fileOutcome{fr, err})
 		} else if fileinfo.Mode().IsRegular() {
 			count++
-			go func(filename string) {
-				fileResultsChan <- locFile(filename)
-			}(filename)
+			go func(filename string, fileinfo os.FileInfo) {
+				t.fileWorkers.acquire()
+				fr, err := t.locFile(filename, fileinfo)
+				t.fileWorkers.release()
+				fileResultsChan <- fileOutcome{fr, err}
+			}(filename, fileinfo)
 		} else {
 			logger.Printf("INFO Skipping non-regular and non-directory file %q.\n", filename)
 		}
@@ -162,73 +946,664 @@ func locDir(rootPath string) DirResult {
 	for ; count > 0; count-- {
 		select {
 		case dr := <-dirResultsChan:
-			result.Subdirs = append(result.Subdirs, dr)
-			for lang, loc := range dr.Summary {
-				if _, exists := result.Summary[lang]; exists {
-					result.Summary[lang] += loc
-				} else {
-					result.Summary[lang] = loc
-				}
-			}
-		case fr := <-fileResultsChan:
-			if fr != nil {
-				result.Files = append(result.Files, *fr)
-				for lang, loc := range fr.Loc {
-					if _, exists := result.Summary[lang]; exists {
-						result.Summary[lang] += loc
-					} else {
-						result.Summary[lang] = loc
-					}
-				}
-			}
+			result.addSubdir(dr, t.keepSubdirs(rootPath))
+		case fo := <-fileResultsChan:
+			t.addFileOutcome(&result, fo)
 		}
 	}
 	close(dirResultsChan)
 	close(fileResultsChan)
 
+	t.reportDir(result)
 	return result
 }
 
+// Reports the DirResult of a directory that has been counted, unless it is the
+// root (which is reported by the caller of the traversal, once complete) or the
+// traversal has been cancelled.
+func (t *traversal) reportDir(result DirResult) {
+	if t.onDir != nil && result.Name != t.root && !t.cancelled() {
+		t.onDir(result)
+	}
+}
+
 // The core function for detecting a file's type, creating a LocCounter to
 // count the lines of code in it, and finally return the results in a
 // FileResult struct.
-func locFile(filename string) *FileResult {
-	var result *FileResult
+//
+// A nil FileResult is returned for files that are skipped (e.g. because their
+// language is not supported, or because they were removed before they could be
+// opened), while a non-nil error is returned for any unexpected error, in
+// which case the FileResult may still contain the results counted so far.
+func (t *traversal) locFile(filename string, fileinfo os.FileInfo) (*FileResult, error) {
+	d, err := t.decideFile(filename, fileinfo)
+	if d.file != nil {
+		defer d.file.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	baseName := filepath.Base(filename)
+	var fileResult *FileResult
+	switch d.verdict {
+	case fileSkipped:
+		logger.Printf("INFO Skipping %q: %s.\n", filename, d.reason)
+		return nil, nil
+	case fileUnrecognized:
+		logger.Printf("INFO Skipping %q: %s.\n", filename, d.reason)
+		return &FileResult{Name: baseName, Loc: make(map[string]int), Unrecognized: true}, nil
+	case fileMinified:
+		logger.Printf("INFO Skipping %q: %s.\n", filename, d.reason)
+		return &FileResult{Name: baseName, Loc: make(map[string]int), Minified: true}, nil
+	case fileListed:
+		fileResult = &FileResult{Name: baseName, Loc: map[string]int{d.lang.name: 0}}
+	default:
+		logger.Printf("INFO Counting %q as %s: %s.\n", filename, d.lang.name, d.reason)
+		if fileResult, err = t.countContent(d.r, filename, baseName, d.lang); fileResult == nil {
+			return nil, err
+		}
+	}
+	if t.opts.IncludeFileInfo {
+		fileResult.Size = fileinfo.Size()
+		modTime := fileinfo.ModTime()
+		fileResult.ModTime = &modTime
+	}
+	return fileResult, err
+}
+
+// The possible outcomes of the decision on whether a file is counted (see
+// traversal.decideFile).
+type fileVerdict int
 
-	file, err := os.Open(filename)
+const (
+	// The file is skipped altogether.
+	fileSkipped fileVerdict = iota
+	// The file is skipped, because its language could not be detected,
+	// but it is reported (see Options.SourceExtensions).
+	fileUnrecognized
+	// The file is skipped, because it is minified, but it is reported (see
+	// Options.SkipMinified).
+	fileMinified
+	// The file is counted, but not its lines (see Options.CountFilesOnly).
+	fileListed
+	// The lines of the file are counted.
+	fileCounted
+)
+
+// The decision on whether (and how) a file is counted.
+type fileDecision struct {
+	verdict fileVerdict
+	// A human-readable reason for the outcome.
+	reason string
+	// The language that the file is counted as, unless it is skipped.
+	lang language
+	// The file, if it had to be opened to decide (to be closed by the
+	// caller), and the reader of its content (possibly decorated, see
+	// Options.ReaderDecorators) for counting it, if its lines are counted.
+	file io.Closer
+	r    io.Reader
+}
+
+// Decides whether (and how) the file with the given path is counted, opening
+// it if needed; it is shared by locFile and Options.Preview, so that they never
+// disagree. Unless the file is skipped, it is registered as counted among the
+// hard links already seen (see Options.DedupHardLinks).
+func (t *traversal) decideFile(filename string, fileinfo os.FileInfo) (d fileDecision, err error) {
+	baseName := filepath.Base(filename)
+	if reason := t.skipFile(filename); reason != "" {
+		return fileDecision{verdict: fileSkipped, reason: reason}, nil
+	}
+	defer func() {
+		if err == nil && d.verdict >= fileMinified && t.seenHardLink(fileinfo) {
+			d.verdict, d.reason = fileSkipped, "hard link of a file already counted"
+		}
+	}()
+	if len(t.opts.RawCountExtensions) > 0 {
+		ext, matched := t.matchExtension(filename, t.opts.RawCountExtensions)
+		if !matched {
+			return fileDecision{verdict: fileSkipped, reason: "not one of the extensions counted raw"}, nil
+		}
+		lang := languagesByName["plain text"]
+		lang.name = "." + ext
+		file, r, err := t.openDecorated(filename, nil)
+		if os.IsNotExist(err) {
+			return fileDecision{verdict: fileSkipped, reason: "it no longer exists"}, nil
+		} else if err != nil {
+			return fileDecision{}, err
+		}
+		return fileDecision{verdict: fileCounted, reason: fmt.Sprintf("extension %q is counted raw", ext), lang: lang, file: file, r: r}, nil
+	}
+	if t.opts.SkipMinified && isMinifiedName(baseName) {
+		return fileDecision{verdict: fileMinified, reason: "minified, according to its name"}, nil
+	}
+	name, decorators := t.decorators(filename)
+	lang, reason, found := t.detectLanguage(name)
+	overridden := false // by .gitattributes, which takes precedence over modelines
+	if t.gitAttributes != nil {
+		skipReason, override := t.skipByGitAttributes(filename)
+		if skipReason != "" {
+			return fileDecision{verdict: fileSkipped, reason: skipReason}, nil
+		}
+		if override != "" {
+			if lang, found = languageByAlias(override); !found {
+				return fileDecision{verdict: fileSkipped, reason: fmt.Sprintf("overridden to unsupported language %q in .gitattributes", override)}, nil
+			}
+			reason = fmt.Sprintf("overridden to %s in .gitattributes", lang.name)
+			overridden = true
+		}
+	}
+	if t.opts.CountFilesOnly {
+		if !found {
+			return t.unrecognized(name, reason), nil
+		}
+		if skipReason := t.skipLanguage(lang.name); skipReason != "" {
+			return fileDecision{verdict: fileSkipped, reason: skipReason}, nil
+		}
+		return fileDecision{verdict: fileListed, reason: reason + ", and only files are counted", lang: lang}, nil
+	}
+	byExtension := found && !overridden
+	detectModelines := t.opts.DetectModelines && !overridden
+	sniffContent := t.opts.ContentSniffer != nil && !overridden
+	if !found && !detectModelines && !sniffContent && !t.shouldSniff(name) {
+		return t.unrecognized(name, reason), nil
+	}
+
+	file, r, err := t.openDecorated(filename, decorators)
+	if os.IsNotExist(err) {
+		return fileDecision{verdict: fileSkipped, reason: "it no longer exists"}, nil
+	} else if err != nil {
+		return fileDecision{}, err
+	}
+	// The file is closed by the caller, whatever the verdict.
+	d.file = file
+	if sniffContent {
+		sniffedLang, sniffed, rewound, err := t.sniffContent(r, filename)
+		if err != nil {
+			return d, fmt.Errorf("%s: %w", filename, err)
+		}
+		if r = rewound; sniffed {
+			lang, found, reason = sniffedLang, true, fmt.Sprintf("content sniffed as %s", sniffedLang.name)
+			byExtension, detectModelines = false, false
+		} else if !found && !detectModelines && !t.shouldSniff(name) {
+			return t.unrecognized(name, reason).with(file), nil
+		}
+	}
+	if detectModelines {
+		modelineLang, modelineReason, modelineFound, rewound, err := readModeline(r)
+		if err != nil {
+			return d, fmt.Errorf("%s: %w", filename, err)
+		}
+		if r = rewound; modelineFound {
+			lang, found, reason = modelineLang, true, modelineReason
+			byExtension = false
+		} else if !found && !t.shouldSniff(name) {
+			return t.unrecognized(name, reason+", and "+modelineReason).with(file), nil
+		}
+	}
+	if !found {
+		if found, reason, r, err = sniffText(r); err != nil {
+			return d, fmt.Errorf("%s: %w", filename, err)
+		} else if !found {
+			return t.unrecognized(name, reason).with(file), nil
+		}
+		lang = languagesByName["plain text"]
+	}
+	if byExtension && (t.opts.ValidateContent || t.opts.ReclassifyContent) {
+		var validated language
+		if validated, r, err = t.validateContent(r, filename, lang); err != nil {
+			return d, fmt.Errorf("%s: %w", filename, err)
+		}
+		if validated.name != lang.name {
+			lang, reason = validated, fmt.Sprintf("content looks like %s", validated.name)
+		}
+	}
+	if skipReason := t.skipLanguage(lang.name); skipReason != "" {
+		return fileDecision{verdict: fileSkipped, reason: skipReason, file: file}, nil
+	}
+	return fileDecision{verdict: fileCounted, reason: reason, lang: lang, file: file, r: r}, nil
+}
+
+// Opens the file with the given path, returning it along with a reader of its
+// content, decorated by the given decorators; the file is closed if the
+// decorators fail.
+func (t *traversal) openDecorated(filename string, decorators []ReaderDecorator) (io.Closer, io.Reader, error) {
+	file, err := t.open(filename)
 	if err != nil {
-		logger.Println("ERROR", err)
-		return result
+		return nil, nil, err
+	}
+	r, err := decorate(filename, file, decorators)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, r, nil
+}
+
+// Returns the decision to skip the file with the given name (stripped of any
+// decorating extension), whose language could not be detected for the given
+// reason; it is still reported if it is expected to be source code according
+// to Options.SourceExtensions.
+func (t *traversal) unrecognized(name, reason string) fileDecision {
+	if !t.hasExtension(name, t.opts.SourceExtensions) {
+		return fileDecision{verdict: fileSkipped, reason: reason}
+	}
+	return fileDecision{verdict: fileUnrecognized, reason: reason}
+}
+
+// Returns the fileDecision, along with the given file, which has been opened
+// to decide, so that it is closed by the caller.
+func (d fileDecision) with(file io.Closer) fileDecision {
+	d.file = file
+	return d
+}
+
+// Reports whether the file described by the given FileInfo is a hard link of
+// a file that has already been counted, if Options.DedupHardLinks is set, and
+// registers it as counted otherwise. It is only called once the file is known
+// to be counted, so that a link that is skipped (e.g. because of its extension)
+// does not make the other links of the same file be skipped too.
+func (t *traversal) seenHardLink(fileinfo os.FileInfo) bool {
+	id, linked := hardLinkIDOf(fileinfo)
+	return linked && t.seenHardLinks != nil && !t.seenHardLinks.add(id)
+}
+
+// Counts the content read from r, which is already known to be written in the
+// given language, as that of the file with the given name and base name (only
+// used in the FileResult, and for logging and errors). Like locFile, it returns
+// a nil FileResult for content that is skipped.
+func (t *traversal) countContent(r io.Reader, filename, baseName string, lang language) (*FileResult, error) {
+	var err error
+	if t.opts.Context != nil {
+		r = &abortableReader{r: r, abort: t.opts.Context.Done()}
+	}
+	if t.opts.MinifiedLineLength > 0 {
+		var minified bool
+		if minified, r, err = sniffMinified(r, t.opts.MinifiedLineLength); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		} else if minified {
+			logger.Printf("INFO Skipping %q: minified, according to its average line length.\n", filename)
+			return &FileResult{Name: baseName, Loc: make(map[string]int), Minified: true}, nil
+		}
+	}
+
+	// If the counting may be abandoned, the lines that it has seen so far
+	// are to be forgotten then, so it only sees the others through a
+	// journal.
+	tc := t
+	if t.opts.FileTimeout > 0 && t.seenLines != nil {
+		journaled := *t
+		journaled.seenLines = t.seenLines.journal()
+		tc = &journaled
+	}
+	count := func(r io.Reader) (FileResult, error) {
+		if lang.name == "Markdown" && tc.opts.CountMarkdownFences {
+			return tc.countMarkdown(r, filename, baseName)
+		}
+		if lang.name == "HTML" && tc.opts.CountHTMLEmbeddedCode {
+			return tc.countHTML(r, filename, baseName)
+		}
+		return tc.newLocCounter(r, filename, lang).fileResult(baseName)
 	}
-	defer file.Close()
+	var fileResult FileResult
+	if t.opts.FileTimeout > 0 {
+		var timedOut bool
+		if fileResult, timedOut, err = countWithTimeout(r, count, t.opts.FileTimeout); timedOut {
+			if tc.seenLines != nil {
+				tc.seenLines.rollback()
+			}
+			logger.Printf("INFO Skipping %q: counting timed out after %s.\n", filename, t.opts.FileTimeout)
+			return nil, fmt.Errorf("%s: counting timed out after %s; skipped", filename, t.opts.FileTimeout)
+		}
+	} else {
+		fileResult, err = count(r)
+	}
+	if t.cancelled() {
+		// The file may have been abandoned half-way.
+		logger.Printf("INFO Skipping %q: counting cancelled.\n", filename)
+		return nil, nil
+	}
+	if t.isDataFile(filename) {
+		fileResult.separateData()
+	} else if t.isGeneratedFile(filename) {
+		fileResult.separateGenerated()
+	} else if t.opts.SeparateDocumentation {
+		fileResult.separateDocumentation()
+	}
+	if err != nil {
+		err = fmt.Errorf("%s: %w", filename, err)
+	}
+	return &fileResult, err
+}
+
+// Counts the content read from r using the given function, in a separate
+// goroutine, abandoning it if it takes longer than the given timeout. Once
+// abandoned, any further attempt of the goroutine to read from r fails, so that
+// it finishes as soon as possible; the function must not modify any state
+// shared with the rest of the traversal, unless that is undone on a timeout.
+func countWithTimeout(r io.Reader, count func(io.Reader) (FileResult, error), timeout time.Duration) (FileResult, bool, error) {
+	abort := make(chan struct{})
+	done := make(chan fileOutcome, 1)
+	go func() {
+		fr, err := count(&abortableReader{r: r, abort: abort})
+		done <- fileOutcome{&fr, err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case fo := <-done:
+		return *fo.result, false, fo.err
+	case <-timer.C:
+		close(abort)
+		return FileResult{}, true, nil
+	}
+}
 
+// An io.Reader that fails as soon as its abort channel is closed.
+type abortableReader struct {
+	r     io.Reader
+	abort <-chan struct{}
+}
+
+func (ar *abortableReader) Read(p []byte) (int, error) {
+	select {
+	case <-ar.abort:
+		return 0, errAborted
+	default:
+		return ar.r.Read(p)
+	}
+}
+
+// The error returned by an abortableReader after it has been aborted.
+var errAborted = errors.New("counting aborted")
+
+// Returns a new LocCounter to count the lines of code in the content read from
+// r, written in the given language, as part of the traversal.
+func (t *traversal) newLocCounter(r io.Reader, name string, lang language) *LocCounter {
+	lc := newLocCounter(r, name, lang, &t.opts)
+	lc.seenLines = t.seenLines
+	if t.opts.CountBranches {
+		lc.branchKeywords = branchesOf(lang)
+	}
+	lc.countsStatements = t.opts.CountStatements && semicolonLanguages[lang.name]
+	return lc
+}
+
+// Returns the reason why the directory with the given path should be skipped,
+// or an empty string if it should be counted.
+func (t *traversal) skipDir(path string) string {
+	if filepath.Base(path) == ".git" && !t.opts.CountGitDirs {
+		return "git directories are not counted"
+	}
+	if t.opts.SkipHidden && path != t.root && t.isHiddenDir(path) {
+		return "hidden directories are not counted"
+	}
+	if t.gitIgnore != nil && path != t.root && t.isGitIgnored(path, true) {
+		return "ignored by .gitignore"
+	}
+	if path != t.root {
+		for _, pattern := range t.opts.SkipDirPatterns {
+			if matched, _ := filepath.Match(pattern, filepath.Base(path)); matched {
+				return fmt.Sprintf("directory name matches skip pattern %q", pattern)
+			}
+		}
+	}
+	if rel, ok := t.relPath(path); ok && t.opts.MaxDepth > 0 && rel != "." && strings.Count(rel, "/")+1 >= t.opts.MaxDepth {
+		return "deeper than the maximum depth"
+	}
+	if !t.allowedPath(path) {
+		return "not among the paths to be counted"
+	}
+	return ""
+}
+
+// Reports whether the directory with the given path is hidden, i.e. whether its
+// name starts with a dot, and it is not among Options.HiddenAllowlist.
+func (t *traversal) isHiddenDir(path string) bool {
+	name := filepath.Base(path)
+	if !strings.HasPrefix(name, ".") || name == "." || name == ".." {
+		return false
+	}
+	for _, allowed := range t.opts.HiddenAllowlist {
+		if name == allowed {
+			return false
+		}
+	}
+	return true
+}
+
+// Reports whether the file or directory with the given path may be counted
+// according to Options.OnlyPaths, i.e. whether it (or, for directories, any
+// path under it) is among them.
+func (t *traversal) allowedPath(name string) bool {
+	if t.onlyPaths == nil || t.root == "" {
+		return true
+	}
+	rel, ok := t.relPath(name)
+	return ok && (rel == "." || t.onlyPaths[rel])
+}
+
+// Returns the slash-separated path of the given file or directory relative to
+// the root of the traversal, or false if there is no such path (e.g. when
+// counting a single file).
+func (t *traversal) relPath(name string) (string, bool) {
+	if t.root == "" {
+		return "", false
+	}
+	if t.fsys == nil {
+		rel, err := filepath.Rel(t.root, name)
+		if err != nil {
+			return "", false
+		}
+		return filepath.ToSlash(rel), true
+	} else if t.root == "." {
+		return name, true
+	}
+	return strings.TrimPrefix(name, t.root+"/"), true
+}
+
+// Returns the reason why the files of the language with the given name should
+// be skipped according to Options.Languages and ExcludeLanguages, or an empty
+// string if they should be counted.
+func (t *traversal) skipLanguage(name string) string {
+	for _, excluded := range t.opts.ExcludeLanguages {
+		if name == excluded {
+			return fmt.Sprintf("%s is among the languages excluded", name)
+		}
+	}
+	if t.opts.Languages == nil {
+		return ""
+	}
+	for _, included := range t.opts.Languages {
+		if name == included {
+			return ""
+		}
+	}
+	return fmt.Sprintf("%s is not among the languages to be counted", name)
+}
+
+// The names of lock files and similar generated manifests, which are skipped
+// by default, since they are usually huge and uninteresting to count. Patterns
+// are matched against base names, using the syntax of filepath.Match.
+var lockFilePatterns = []string{
+	"Cargo.lock",
+	"composer.lock",
+	"Gemfile.lock",
+	"go.sum",
+	"mix.lock",
+	"npm-shrinkwrap.json",
+	"package-lock.json",
+	"Pipfile.lock",
+	"pnpm-lock.yaml",
+	"Podfile.lock",
+	"poetry.lock",
+	"pubspec.lock",
+	"yarn.lock",
+}
+
+// Reports whether the file with the given name is a data file, according to
+// Options.DataExtensions.
+func (t *traversal) isDataFile(filename string) bool {
+	return t.hasExtension(filename, t.opts.DataExtensions)
+}
+
+// Reports whether the file with the given name has any of the given extensions
+// (with or without the leading dot), ignoring case only if
+// Options.CaseInsensitiveExtensions is set. Extensions may be compound (e.g.
+// "pb.go"), in which case they must match a whole chain of suffixes of the
+// name (see suffixChain).
+func (t *traversal) hasExtension(filename string, exts []string) bool {
+	_, matched := t.matchExtension(filename, exts)
+	return matched
+}
+
+// Like hasExtension, but also returns the extension that matched, as given
+// (without the leading dot). The longest suffix of the name that matches any of
+// them wins.
+func (t *traversal) matchExtension(filename string, exts []string) (string, bool) {
+	for _, suffix := range suffixChain(filepath.Base(filename)) {
+		ext := suffix[1:]
+		for _, e := range exts {
+			e = strings.TrimPrefix(e, ".")
+			if ext == e || t.opts.CaseInsensitiveExtensions && strings.EqualFold(ext, e) {
+				return e, true
+			}
+		}
+	}
+	return "", false
+}
+
+// Returns the chain of the suffixes of the given base name of a file, i.e. of
+// the parts of it that start at each of its dots, from the longest to the
+// shortest; e.g. [".tar.gz", ".gz"] for "archive.tar.gz", or [".min.js", ".js"]
+// for "jquery.min.js". Unlike filepath.Ext, which only returns the last one,
+// it allows matching compound suffixes (e.g. ".pb.go") reliably. The leading
+// dot of a hidden file (e.g. ".bashrc") does not start a suffix.
+func suffixChain(baseName string) []string {
+	var chain []string
+	for i := 1; i < len(baseName); i++ {
+		if baseName[i] == '.' {
+			chain = append(chain, baseName[i:])
+		}
+	}
+	return chain
+}
+
+// Returns the reason why the file with the given path should be skipped
+// regardless of its language, or an empty string if it should be counted.
+func (t *traversal) skipFile(path string) string {
+	baseName := filepath.Base(path)
+	if !t.opts.CountLockFiles {
+		for _, pattern := range lockFilePatterns {
+			if matched, _ := filepath.Match(pattern, baseName); matched {
+				return "lock files are not counted"
+			}
+		}
+	}
+	for _, pattern := range t.opts.SkipFilePatterns {
+		if matched, _ := filepath.Match(pattern, baseName); matched {
+			return fmt.Sprintf("file name matches skip pattern %q", pattern)
+		}
+	}
+	if t.gitIgnore != nil && t.isGitIgnored(path, false) {
+		return "ignored by .gitignore"
+	}
+	if !t.allowedPath(path) {
+		return "not among the paths to be counted"
+	}
+	return ""
+}
+
+// Detects the language of the file with the given name. It returns the
+// language and whether one was found at all, along with a human-readable
+// reason for the outcome.
+func (t *traversal) detectLanguage(filename string) (language, string, bool) {
 	baseName := filepath.Base(filename)
 	ext := filepath.Ext(filename)
+	ignoreCase := t.opts.CaseInsensitiveExtensions
 	if ext == "" {
-		if strings.HasPrefix(baseName, "Makefile") {
+		if isMakefileName(baseName, ignoreCase) {
 			ext = "Makefile"
-		} else if strings.HasPrefix(baseName, "Dockerfile") {
+		} else if hasPrefix(baseName, "Dockerfile", ignoreCase) {
 			ext = "Dockerfile"
+		} else if isTextFileName(baseName, ignoreCase) {
+			return languagesByName["plain text"], fmt.Sprintf("file name %q is plain text", baseName), true
 		}
 	} else {
 		// Ignore the leading dot.
 		ext = ext[1:]
+		if _, found := t.resolveLanguage(ext); !found && isMakefileName(strings.TrimSuffix(baseName, "."+ext), ignoreCase) {
+			// e.g. "Makefile.win" or "Makefile.am"
+			ext = "Makefile"
+		}
 	}
-	locCounter, err := NewLocCounter(file, ext)
-	if err != nil {
-		logger.Println("ERROR", err)
-		return result
+	lang, found := t.resolveLanguage(ext)
+	switch {
+	case !found:
+		return lang, fmt.Sprintf("cannot deduce a supported language from extension %q", ext), false
+	case t.opts.ExtensionOverrides[ext] != "":
+		return lang, fmt.Sprintf("extension %q is overridden to %s", ext, lang.name), true
+	default:
+		return lang, fmt.Sprintf("extension %q is %s", ext, lang.name), true
 	}
+}
 
-	loc, err := locCounter.Count()
-	if err != nil {
-		logger.Println("ERROR", err)
+// Returns the language that is associated with the given extension, taking
+// into account the overrides and the custom languages of the traversal, and
+// whether such a language was found at all.
+func (t *traversal) resolveLanguage(ext string) (language, bool) {
+	if name, exists := t.opts.ExtensionOverrides[ext]; exists {
+		return t.languageByName(name)
 	}
-	result = &FileResult{
-		Name: baseName,
-		Loc: map[string]int{
-			languages[ext].name: loc,
-		},
+	for _, lang := range t.customLanguages {
+		for _, e := range lang.extensions {
+			if e == ext || (t.opts.CaseInsensitiveExtensions && strings.EqualFold(e, ext)) {
+				return lang, true
+			}
+		}
 	}
-	return result
+	return lookupLanguage(ext, t.opts.CaseInsensitiveExtensions)
+}
+
+// Returns the language with the given name, among the custom languages of the
+// traversal and the supported ones, in that order, and whether such a language
+// was found at all.
+func (t *traversal) languageByName(name string) (language, bool) {
+	for _, lang := range t.customLanguages {
+		if lang.name == name {
+			return lang, true
+		}
+	}
+	lang, found := languagesByName[name]
+	return lang, found
+}
+
+// The outcome of counting a single file, as sent by the goroutine that was
+// assigned to count it.
+type fileOutcome struct {
+	result *FileResult
+	err    error
+}
+
+// The names (or prefixes of the names) of makefiles, which have no extension.
+var makefileNames = []string{"Makefile", "makefile", "GNUmakefile", "BSDmakefile"}
+
+// Reports whether a file with the given base name (without any extension that
+// does not belong to a supported language) is a makefile, e.g. "Makefile" or
+// "GNUmakefile".
+func isMakefileName(baseName string, ignoreCase bool) bool {
+	for _, name := range makefileNames {
+		if hasPrefix(baseName, name, ignoreCase) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether string s begins with prefix, optionally ignoring case.
+func hasPrefix(s, prefix string, ignoreCase bool) bool {
+	if ignoreCase {
+		return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+	}
+	return strings.HasPrefix(s, prefix)
 }
@@ -0,0 +1,457 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRawCountExtensions(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a.xyz":          "one\ntwo\n",
+		"b.tar.gz":       "one\n",
+		"c.gz":           "one\ntwo\nthree\n",
+		"d.go":           "package d\n",
+		"e.XYZ":          "one\n",
+		"sub/f.x.tar.gz": "one\ntwo\n",
+	})
+	checkSummary(t, root, Options{RawCountExtensions: []string{"xyz", ".tar.gz"}}, map[string]int{
+		".xyz":    2,
+		".tar.gz": 3,
+	})
+	// The longest suffix that matches wins.
+	checkSummary(t, root, Options{RawCountExtensions: []string{"gz", "tar.gz"}}, map[string]int{
+		".gz":     3,
+		".tar.gz": 3,
+	})
+	checkSummary(t, root, Options{RawCountExtensions: []string{"xyz"}, CaseInsensitiveExtensions: true}, map[string]int{
+		".xyz": 3,
+	})
+}
+
+func TestSpliceCountSubdir(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		".gitignore":    "*.txt\n",
+		"a.go":          "package a\n",
+		"sub/b.go":      "package b\n",
+		"sub/deep/c.go": "package c\n",
+		"other/d.py":    "d = 1\n",
+	})
+	opts := Options{MaxDepth: 3}
+	tree := checkSummary(t, root, opts, map[string]int{"Go": 3, "Python": 1})
+
+	// Change the subtree: the new .txt file is ignored by the .gitignore of
+	// root, and the one too deep is skipped, as when counting root.
+	sub := filepath.Join(root, "sub")
+	writeTree(t, root, map[string]string{
+		"sub/b.go":               "package b\n\nvar b = 1\n",
+		"sub/e.txt":              "ignored\n",
+		"sub/new/f.c":            "int f;\n",
+		"sub/deep/deeper/g.rs":   "fn g() {}\n",
+		"sub/deep/deeper/h.html": "<p>\n",
+	})
+	if err := os.Remove(filepath.Join(root, "sub", "deep", "c.go")); err != nil {
+		t.Fatal(err)
+	}
+	subResult, err := CountSubdir(root, sub, opts)
+	if err != nil {
+		t.Fatalf("CountSubdir(%q, %q): %v", root, sub, err)
+	}
+	if want := map[string]int{"Go": 2, "C": 1}; !reflect.DeepEqual(subResult.Summary, want) {
+		t.Errorf("CountSubdir(%q, %q).Summary = %v; want %v", root, sub, subResult.Summary, want)
+	}
+	if subResult.Name != sub {
+		t.Errorf("CountSubdir(%q, %q).Name = %q; want %q", root, sub, subResult.Name, sub)
+	}
+
+	if !tree.Splice(subResult) {
+		t.Fatalf("Splice(%q) = false; want true", sub)
+	}
+	recounted := checkSummary(t, root, opts, map[string]int{"Go": 3, "C": 1, "Python": 1})
+	if !reflect.DeepEqual(tree.Summary, recounted.Summary) {
+		t.Errorf("Summary after Splice = %v; want %v, as when re-counting", tree.Summary, recounted.Summary)
+	}
+	if !reflect.DeepEqual(tree.FileCounts, recounted.FileCounts) {
+		t.Errorf("FileCounts after Splice = %v; want %v, as when re-counting", tree.FileCounts, recounted.FileCounts)
+	}
+	for _, dr := range tree.Subdirs {
+		if dr.Name == sub && !reflect.DeepEqual(dr, subResult) {
+			t.Errorf("Splice did not replace the subtree %q", sub)
+		}
+	}
+
+	if tree.Splice(DirResult{Name: filepath.Join(root, "missing")}) {
+		t.Errorf("Splice of a missing subtree = true; want false")
+	}
+	if _, err := CountSubdir(sub, root, opts); err == nil {
+		t.Errorf("CountSubdir(%q, %q) succeeded; want an error, since it is not under it", sub, root)
+	}
+}
+
+func TestExtensionCase(t *testing.T) {
+	tests := []struct {
+		filename   string
+		ignoreCase bool
+		want       string // the name of the language, or "" if none
+	}{
+		{"a.c", false, "C"},
+		{"a.C", false, "C++"},
+		{"a.h", false, "C"},
+		{"a.H", false, "C++"},
+		{"a.s", false, "Assembly"},
+		{"a.S", false, "Assembly (preprocessed)"},
+		{"a.cc", false, "C++"},
+		{"a.CC", false, ""},
+		{"a.PY", false, ""},
+		{"a.Go", false, ""},
+		// Exact matches take precedence, and then lowercase extensions.
+		{"a.c", true, "C"},
+		{"a.C", true, "C++"},
+		{"a.h", true, "C"},
+		{"a.H", true, "C++"},
+		{"a.s", true, "Assembly"},
+		{"a.S", true, "Assembly (preprocessed)"},
+		{"a.CC", true, "C++"},
+		{"a.PY", true, "Python"},
+		{"a.Go", true, "Go"},
+		{"MAKEFILE", false, ""},
+		{"MAKEFILE", true, "Makefile"},
+	}
+	for _, test := range tests {
+		tr := newTraversal(Options{CaseInsensitiveExtensions: test.ignoreCase}, nil)
+		lang, _, found := tr.detectLanguage(test.filename)
+		got := ""
+		if found {
+			got = lang.name
+		}
+		if got != test.want {
+			t.Errorf("detectLanguage(%q) with CaseInsensitiveExtensions=%t = %q; want %q", test.filename, test.ignoreCase, got, test.want)
+		}
+	}
+}
+
+func TestExtensionCaseCount(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a.c":  "int a;\n",
+		"b.C":  "int b;\nint c;\n",
+		"c.h":  "int d;\n",
+		"d.H":  "int e;\nint f;\n",
+		"e.PY": "x = 1\n",
+		"f.s":  "nop\n",
+		"g.S":  "nop\nnop\n",
+	})
+	checkSummary(t, root, Options{}, map[string]int{"C": 2, "C++": 4, "Assembly": 1, "Assembly (preprocessed)": 2})
+	checkSummary(t, root, Options{CaseInsensitiveExtensions: true}, map[string]int{"C": 2, "C++": 4, "Python": 1, "Assembly": 1, "Assembly (preprocessed)": 2})
+}
+
+func TestIncludeFileInfo(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"a.go": "package a\n"})
+	mtime := time.Unix(1500000000, 0)
+	if err := os.Chtimes(filepath.Join(root, "a.go"), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	for _, include := range []bool{false, true} {
+		result, err := CountLocWithOptions(root, Options{IncludeFileInfo: include})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fr := result.Files[0]
+		data, err := json.Marshal(fr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			t.Fatal(err)
+		}
+		_, encoded := fields["modTime"]
+		if !include {
+			if fr.ModTime != nil || fr.Size != 0 || encoded {
+				t.Errorf("Without IncludeFileInfo, got size %d, modification time %v and %s", fr.Size, fr.ModTime, data)
+			}
+		} else if fr.ModTime == nil || !fr.ModTime.Equal(mtime) || fr.Size != 10 || !encoded {
+			t.Errorf("With IncludeFileInfo, got size %d, modification time %v and %s; want 10 and %v", fr.Size, fr.ModTime, data, mtime)
+		}
+	}
+}
+
+func TestLocFileRemoved(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"by extension", Options{}},
+		{"by modeline", Options{DetectModelines: true}},
+		{"raw", Options{RawCountExtensions: []string{"go"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filename := filepath.Join(t.TempDir(), "a.go")
+			if err := os.WriteFile(filename, []byte("package a\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			fileinfo, err := os.Stat(filename)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Removed after it is found, but before it is opened.
+			if err := os.Remove(filename); err != nil {
+				t.Fatal(err)
+			}
+			fr, err := newTraversal(test.opts, nil).locFile(filename, fileinfo)
+			if fr != nil || err != nil {
+				t.Errorf("locFile(%q) of a removed file = %v, %v; want nil, nil", filename, fr, err)
+			}
+		})
+	}
+}
+
+func TestSequentialDocComments(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"c.rs":   "/*! a */\n/**/\n/// b\nfn main() {}\n",
+		"a.cs":   "/// a\n/**/ class A {}\n",
+		"b.java": "/** a\n */\nclass B {}\n",
+		"d/e.rs": "//! a\nfn e() {}\n",
+	})
+	result := checkSummary(t, root, Options{Sequential: true}, map[string]int{"C#": 1, "Java": 1, "Rust": 2})
+	var names []string
+	for _, fr := range result.Files {
+		names = append(names, fr.Name)
+	}
+	if want := []string{"a.cs", "b.java", "c.rs"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Sequential counting returned files %q; want %q", names, want)
+	}
+	if result.Comment != 7 {
+		t.Errorf("Sequential counting returned %d comment lines; want 7", result.Comment)
+	}
+}
+
+func TestSuffixChain(t *testing.T) {
+	tests := []struct {
+		baseName string
+		want     []string
+	}{
+		{"a", nil},
+		{"a.go", []string{".go"}},
+		{"jquery.min.js", []string{".min.js", ".js"}},
+		{"archive.tar.gz", []string{".tar.gz", ".gz"}},
+		{"a.pb.go", []string{".pb.go", ".go"}},
+		{"a.b.c.d", []string{".b.c.d", ".c.d", ".d"}},
+		{".bashrc", nil},
+		{".profile.sh", []string{".sh"}},
+		{"a..go", []string{"..go", ".go"}},
+	}
+	for _, test := range tests {
+		if got := suffixChain(test.baseName); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("suffixChain(%q) = %q; want %q", test.baseName, got, test.want)
+		}
+	}
+}
+
+func TestMatchExtension(t *testing.T) {
+	tests := []struct {
+		filename   string
+		exts       []string
+		ignoreCase bool
+		want       string // the extension that matched, or "" if none
+	}{
+		{"a.pb.go", []string{"pb.go"}, false, "pb.go"},
+		{"a.pb.go", []string{".pb.go"}, false, "pb.go"},
+		{"dir/a.pb.go", []string{"go", "pb.go"}, false, "pb.go"},
+		{"a.go", []string{"pb.go"}, false, ""},
+		{"apb.go", []string{"pb.go"}, false, ""},
+		{"x.tar.gz", []string{"gz", "tar.gz"}, false, "tar.gz"},
+		{"x.tar.gz", []string{"gz"}, false, "gz"},
+		{"x.tar.gz", []string{"tar"}, false, ""},
+		{"x.TAR.GZ", []string{"tar.gz"}, false, ""},
+		{"x.TAR.GZ", []string{"tar.gz"}, true, "tar.gz"},
+		{"a.min.js", []string{"min.js"}, false, "min.js"},
+		{".bashrc", []string{"bashrc"}, false, ""},
+		{"dir.d/a", []string{"d"}, false, ""},
+	}
+	for _, test := range tests {
+		tr := newTraversal(Options{CaseInsensitiveExtensions: test.ignoreCase}, nil)
+		got, matched := tr.matchExtension(test.filename, test.exts)
+		if matched != (test.want != "") || got != test.want {
+			t.Errorf("matchExtension(%q, %q) = %q, %t; want %q", test.filename, test.exts, got, matched, test.want)
+		}
+		if hasExt := tr.hasExtension(test.filename, test.exts); hasExt != matched {
+			t.Errorf("hasExtension(%q, %q) = %t; want %t", test.filename, test.exts, hasExt, matched)
+		}
+	}
+}
+
+func TestMultiDotNamesLanguage(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string // the name of the language, or "" if none
+	}{
+		{"a.min.js", "Javascript"},
+		{"a.pb.go", "Go"},
+		{"a.b.c.py", "Python"},
+		{"x.tar.gz", ""},
+		{".profile.sh", "Shell"},
+		{".bashrc", ""},
+		{"Makefile.am", "Makefile"},
+	}
+	tr := newTraversal(Options{}, nil)
+	for _, test := range tests {
+		lang, _, found := tr.detectLanguage(test.filename)
+		got := ""
+		if found {
+			got = lang.name
+		}
+		if got != test.want {
+			t.Errorf("detectLanguage(%q) = %q; want %q", test.filename, got, test.want)
+		}
+	}
+}
+
+func TestMultiDotNamesCount(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a.js":     "x = 1;\n",
+		"a.min.js": "x=1;y=2;\n",
+		"a.pb.go":  "package a\n",
+		"b.go":     "package a\n\nfunc B() {}\n",
+		"x.tar.gz": "not an archive\n",
+	})
+	result := checkSummary(t, root, Options{SkipMinified: true, DataExtensions: []string{"pb.go"}},
+		map[string]int{"Go": 2, "Javascript": 1})
+	if result.Minified != 1 {
+		t.Errorf("CountLocWithOptions(%q) skipped %d minified files; want 1", root, result.Minified)
+	}
+	if want := map[string]int{"Go": 1}; !reflect.DeepEqual(result.Data, want) {
+		t.Errorf("CountLocWithOptions(%q).Data = %v; want %v", root, result.Data, want)
+	}
+	checkSummary(t, root, Options{RawCountExtensions: []string{"tar.gz"}}, map[string]int{".tar.gz": 1})
+}
+
+// An io.Reader that returns its content, and then blocks until released.
+type stallingReader struct {
+	content string
+	release chan struct{}
+}
+
+func (sr *stallingReader) Read(p []byte) (int, error) {
+	if sr.content != "" {
+		n := copy(p, sr.content)
+		sr.content = sr.content[n:]
+		return n, nil
+	}
+	<-sr.release
+	return 0, io.EOF
+}
+
+func TestFileTimeoutDuplicates(t *testing.T) {
+	tr := newTraversal(Options{DetectDuplicates: true, FileTimeout: 20 * time.Millisecond}, nil)
+	lang, _ := lookupLanguage("c", false)
+
+	stalled := &stallingReader{content: "int x;\n", release: make(chan struct{})}
+	defer close(stalled.release)
+	if fr, err := tr.countContent(stalled, "a.c", "a.c", lang); fr != nil || err == nil {
+		t.Fatalf("Counting a stalled file returned %v, %v; want a timeout", fr, err)
+	}
+	// The line of the abandoned file must have been forgotten.
+	fr, err := tr.countContent(strings.NewReader("int x;\n"), "b.c", "b.c", lang)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fr.Loc["C"] != 1 || fr.Duplicates != 0 {
+		t.Errorf("Counted %d lines of code and %d duplicates; want 1 and 0", fr.Loc["C"], fr.Duplicates)
+	}
+	fr, err = tr.countContent(strings.NewReader("int x;\n"), "c.c", "c.c", lang)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fr.Duplicates != 1 {
+		t.Errorf("Counted %d duplicates; want 1", fr.Duplicates)
+	}
+}
+
+func TestCountLocContext(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a.go":   "package a\n",
+		"b/b.go": "package b\n",
+	})
+	result, err := CountLocContext(context.Background(), root)
+	if err != nil {
+		t.Fatalf("CountLocContext(%q): %v", root, err)
+	}
+	if want := map[string]int{"Go": 2}; !reflect.DeepEqual(result.Summary, want) {
+		t.Errorf("CountLocContext(%q).Summary = %v; want %v", root, result.Summary, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err = CountLocContext(ctx, root)
+	if err != context.Canceled {
+		t.Errorf("CountLocContext(%q) with a cancelled context: %v; want %v", root, err, context.Canceled)
+	}
+	if result.Name != root || result.Summary == nil {
+		t.Errorf("CountLocContext(%q) with a cancelled context = %+v; want an empty result", root, result)
+	}
+}
+
+// A context.Context that is cancelled once the content of its n-th file
+// starts being counted (i.e. on the n-th call to Done).
+type cancelOnNthFile struct {
+	context.Context
+	cancel context.CancelFunc
+	n      int
+}
+
+func (c *cancelOnNthFile) Done() <-chan struct{} {
+	if c.n--; c.n == 0 {
+		c.cancel()
+	}
+	return c.Context.Done()
+}
+
+func TestCountLocContextPartial(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a.go": "package a\n",
+		"b.go": "package b\n\nfunc B() {}\n",
+		"c.go": "package c\n",
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := Options{Context: &cancelOnNthFile{Context: ctx, cancel: cancel, n: 2}, Sequential: true}
+	result, err := CountLocWithOptions(root, opts)
+	if err != context.Canceled {
+		t.Errorf("CountLocWithOptions(%q) cancelled half-way: %v; want %v", root, err, context.Canceled)
+	}
+	if want := map[string]int{"Go": 1}; !reflect.DeepEqual(result.Summary, want) {
+		t.Errorf("CountLocWithOptions(%q) cancelled half-way: Summary = %v; want %v", root, result.Summary, want)
+	}
+	if len(result.Files) != 1 || result.Files[0].Name != "a.go" {
+		t.Errorf("CountLocWithOptions(%q) cancelled half-way: Files = %+v; want only a.go", root, result.Files)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ReaderDecorator transforms the content of some of the files (e.g. by
+// decompressing or decrypting it) before it is counted, as configured by
+// Options.ReaderDecorators.
+type ReaderDecorator struct {
+	// Suffix, if not empty, restricts the ReaderDecorator to the files
+	// whose names end with it. It is stripped from the name of the file
+	// before its language is detected, so that e.g. "foo.go.gz" is counted
+	// as Go, given a ReaderDecorator with the ".gz" Suffix.
+	Suffix string
+
+	// Decorate returns a reader that yields the transformed content read
+	// from r, which is that of the file with the given path.
+	Decorate func(path string, r io.Reader) (io.Reader, error)
+}
+
+// GzipDecorator returns a ReaderDecorator that decompresses the content of
+// gzip-compressed files, i.e. those whose names end with ".gz".
+func GzipDecorator() ReaderDecorator {
+	return ReaderDecorator{
+		Suffix: ".gz",
+		Decorate: func(path string, r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+	}
+}
+
+// Returns the name of the given file with the suffixes of the ReaderDecorators
+// of the traversal that apply to it stripped, along with these
+// ReaderDecorators, in the order they should be applied.
+func (t *traversal) decorators(filename string) (string, []ReaderDecorator) {
+	var decorators []ReaderDecorator
+	for _, d := range t.opts.ReaderDecorators {
+		if !strings.HasSuffix(filename, d.Suffix) {
+			continue
+		}
+		filename = strings.TrimSuffix(filename, d.Suffix)
+		decorators = append(decorators, d)
+	}
+	return filename, decorators
+}
+
+// Applies the given ReaderDecorators, in order, to the content read from r,
+// which is that of the file with the given path.
+func decorate(path string, r io.Reader, decorators []ReaderDecorator) (io.Reader, error) {
+	for _, d := range decorators {
+		var err error
+		if r, err = d.Decorate(path, r); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,202 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CountDiff counts the lines of code among the lines added by a diff in the
+// unified format (e.g. as printed by `git diff`), read from r. The added lines
+// of each file are counted using the rules of the file's language, as detected
+// from its new name, while files that would be skipped by CountLocWithOptions
+// (e.g. of unsupported languages) are skipped; so are deleted files.
+//
+// The DirResult returned contains one FileResult per file (unless
+// Options.SummaryOnly is set), named after the file's new path.
+//
+// Each hunk is counted separately, so that e.g. a block comment that is opened
+// but not closed in a hunk does not swallow the following ones. However, since
+// only the added lines are counted, lines added inside a block comment that
+// was opened in unchanged lines are counted as lines of code.
+func CountDiff(r io.Reader, opts Options) (DirResult, error) {
+	result := DirResult{
+		Name:    "<diff>",
+		Summary: make(map[string]int),
+	}
+	if !opts.SummaryOnly {
+		result.Files = make([]FileResult, 0)
+	}
+	if opts.Histogram {
+		result.Histogram = make(Histogram)
+	}
+	if opts.TopFiles > 0 {
+		result.TopFiles = newTopFiles(opts.TopFiles)
+	}
+	if err := opts.Validate(); err != nil {
+		return result, err
+	}
+	t := newTraversal(opts, nil)
+	t.gitIgnore = nil // the paths of a diff need not exist on disk
+
+	var (
+		file             *FileResult // nil while in a skipped file
+		lang             language
+		hunk             strings.Builder
+		oldLeft, newLeft int // lines left in the current hunk
+	)
+	flushHunk := func() error {
+		// The added lines of a skipped file are dropped too.
+		defer hunk.Reset()
+		if file == nil || hunk.Len() == 0 {
+			return nil
+		}
+		fr, err := t.newLocCounter(strings.NewReader(hunk.String()), file.Name, lang).fileResult(file.Name)
+		file.add(fr)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file.Name, err)
+		}
+		return nil
+	}
+	flushFile := func() error {
+		err := flushHunk()
+		if file != nil {
+			if t.isDataFile(file.Name) {
+				file.separateData()
+			} else if t.isGeneratedFile(file.Name) {
+				file.separateGenerated()
+			} else if opts.SeparateDocumentation {
+				file.separateDocumentation()
+			}
+			result.addFile(*file, t.keepFile(&result))
+			file = nil
+		}
+		return err
+	}
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if oldLeft > 0 || newLeft > 0 {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				hunk.WriteString(line[1:])
+				hunk.WriteByte('\n')
+				newLeft--
+			case strings.HasPrefix(line, "-"):
+				oldLeft--
+			case strings.HasPrefix(line, `\`):
+				// "\ No newline at end of file"
+			default:
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			if err := flushFile(); err != nil {
+				result.addError(err)
+			}
+			name, ok := diffFileName(line[len("+++ "):])
+			if !ok {
+				continue
+			}
+			if reason := t.skipFile(name); reason != "" {
+				logger.Printf("INFO Skipping %q: %s.\n", name, reason)
+				continue
+			}
+			var found bool
+			var reason string
+			if lang, reason, found = t.detectLanguage(name); !found {
+				logger.Printf("INFO Skipping %q: %s.\n", name, reason)
+				continue
+			}
+			if reason := t.skipLanguage(lang.name); reason != "" {
+				logger.Printf("INFO Skipping %q: %s.\n", name, reason)
+				continue
+			}
+			file = &FileResult{Name: name, Loc: make(map[string]int)}
+		case strings.HasPrefix(line, "@@ "):
+			if err := flushHunk(); err != nil {
+				result.addError(err)
+			}
+			var err error
+			if oldLeft, newLeft, err = parseHunkHeader(line); err != nil {
+				return result, err
+			}
+		}
+		// Anything else is part of the headers of a file.
+	}
+	if err := flushFile(); err != nil {
+		result.addError(err)
+	}
+	if opts.PostProcess != nil {
+		opts.PostProcess(&result)
+	}
+	return result, sc.Err()
+}
+
+// Returns the path of a file, as given in a "---" or "+++" line of a unified
+// diff (without the prefix), stripped of any quotes, timestamp and "a/" or
+// "b/" prefix. It returns false for "/dev/null".
+func diffFileName(s string) (string, bool) {
+	if i := strings.IndexByte(s, '\t'); i != -1 {
+		s = s[:i]
+	}
+	if strings.HasPrefix(s, `"`) {
+		if unquoted, err := strconv.Unquote(s); err == nil {
+			s = unquoted
+		}
+	}
+	if s == "/dev/null" {
+		return "", false
+	}
+	if strings.HasPrefix(s, "a/") || strings.HasPrefix(s, "b/") {
+		s = s[2:]
+	}
+	return s, true
+}
+
+// Parses a hunk header of a unified diff (e.g. "@@ -1,5 +1,7 @@ func foo()"),
+// returning the number of lines of the hunk in the old and in the new file.
+func parseHunkHeader(line string) (oldLines, newLines int, err error) {
+	fields := strings.Fields(line)
+	if len(fields) < 3 || !strings.HasPrefix(fields[1], "-") || !strings.HasPrefix(fields[2], "+") {
+		return 0, 0, fmt.Errorf("Invalid hunk header %q.", line)
+	}
+	if oldLines, err = hunkRangeLength(fields[1][1:]); err != nil {
+		return 0, 0, fmt.Errorf("Invalid hunk header %q.", line)
+	}
+	if newLines, err = hunkRangeLength(fields[2][1:]); err != nil {
+		return 0, 0, fmt.Errorf("Invalid hunk header %q.", line)
+	}
+	return oldLines, newLines, nil
+}
+
+// Returns the length of a range of a hunk header (e.g. "1,5"), which is 1 if
+// omitted.
+func hunkRangeLength(r string) (int, error) {
+	i := strings.IndexByte(r, ',')
+	if i == -1 {
+		_, err := strconv.Atoi(r)
+		return 1, err
+	}
+	return strconv.Atoi(r[i+1:])
+}
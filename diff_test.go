@@ -0,0 +1,81 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCountDiff(t *testing.T) {
+	diff := `diff --git a/a.go b/a.go
+index 1111111..2222222 100644
+--- a/a.go
++++ b/a.go
+@@ -1,2 +1,4 @@
+ package a
+-var x = 1
++var x = 2
++/* unterminated
++var y = 3
+@@ -10,0 +12,2 @@ func f() {
++	return
++// comment
+\ No newline at end of file
+diff --git a/gone.c b/gone.c
+deleted file mode 100644
+--- a/gone.c
++++ /dev/null
+@@ -1 +0,0 @@
+-int gone;
+diff --git a/notes.xyz b/notes.xyz
+new file mode 100644
+--- /dev/null
++++ b/notes.xyz
+@@ -0,0 +1 @@
++unsupported
+diff --git "a/sp ace.py" "b/sp ace.py"
+new file mode 100644
+--- /dev/null
++++ "b/sp ace.py"
+@@ -0,0 +1,2 @@
++x = 1
++
+`
+	result, err := CountDiff(strings.NewReader(diff), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The comment opened in the first hunk of a.go ends with it, and the
+	// line added to notes.xyz is not counted as part of the next file.
+	if want := map[string]int{"Go": 2, "Python": 1}; !reflect.DeepEqual(result.Summary, want) {
+		t.Errorf("CountDiff().Summary = %v; want %v", result.Summary, want)
+	}
+	var names []string
+	for _, fr := range result.Files {
+		names = append(names, fr.Name)
+	}
+	if want := []string{"a.go", "sp ace.py"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("CountDiff() counted files %q; want %q", names, want)
+	}
+	if result.Comment != 3 || result.Blank != 1 {
+		t.Errorf("CountDiff() counted %d comment and %d blank lines; want 3 and 1", result.Comment, result.Blank)
+	}
+
+	if _, err := CountDiff(strings.NewReader("--- a/a.go\n+++ b/a.go\n@@ -1 +x @@\n"), Options{}); err == nil {
+		t.Error("CountDiff() of an invalid hunk header returned no error")
+	}
+}
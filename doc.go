@@ -47,6 +47,11 @@
 //
 //	$ glocc -o json ~/bar
 //
+// For quick viewing in a terminal, the summary can also be printed as a plain
+// text table, sorted by lines of code, along with percentages:
+//
+//	$ glocc -o table ~/bar
+//
 // Running it with the -h flag shows all options available.
 //
 // Using the glocc package
@@ -56,6 +61,44 @@
 // (recursive) type that contains the results of counting all lines of code
 // under this root directory.
 //
+// To configure the counting, glocc also exports
+// `func CountLocWithOptions(root string, opts Options) (DirResult, error)`.
+// The zero value of Options results in the same behaviour as CountLoc.
+//
+// By default, file extensions are matched case-sensitively, so that e.g.
+// "foo.C" is counted as C++ and "foo.c" as C, regardless of whether the
+// underlying filesystem is case-sensitive. Setting
+// Options.CaseInsensitiveExtensions (or using the -ignore-case flag of the
+// command line tool) makes the matching case-insensitive instead, for the
+// extensions that are not registered exactly as they are (i.e. "foo.C" is
+// still counted as C++, but "foo.PY" as Python).
+//
+// To count content that is not read from the filesystem (or a file that is
+// already open), glocc exports
+// `func CountReader(r io.Reader, ext string) (FileResult, error)`, which
+// counts the lines of code read from r, as written in the language associated
+// with the given extension. To count many of them at once, concurrently,
+// `func CountReaders(inputs []NamedReader, opts Options) DirResult` counts a
+// slice of readers, each named and associated with an extension.
+//
+// Similarly, `func CountLocFS(fsys fs.FS, root string, opts Options) (DirResult, error)`
+// counts the lines of code under root in any fs.FS. In particular, NewGitFS
+// returns an fs.FS backed by the tree of a commit in a git repository, so that
+// any commit can be counted without checking it out (which is also possible
+// through the -git-ref flag of the command line tool). Moreover,
+// `func CountDiff(r io.Reader, opts Options) (DirResult, error)` counts the
+// lines of code among the lines added by a unified diff (e.g. the output of
+// `git diff`, as used by the -diff flag of the command line tool).
+//
+// For live-updating views, `func CountLocDirStream(root string) <-chan DirResult`
+// sends the DirResult of each directory as soon as it has been counted, the
+// subdirectories before their parents, and root last.
+//
+// To render the results, DirResult.Report returns a Report: the languages
+// sorted by lines of code along with their percentages, the totals, and
+// optionally the files with the most lines of code, as configured by
+// ReportOptions.
+//
 // It also exports EnableLogging() and DisableLogging() functions, to enable
 // and disable verbose logging to standard error, respectively, using a
 // package-level logger.
@@ -71,7 +114,8 @@
 //
 // Platforms
 //
-// Until now, it has been tested only under `go version go1.9.1 linux/amd64`.
+// It requires Go 1.17 or later. Until now, it has been tested only on
+// `linux/amd64`.
 //
 // Known Issues
 //
@@ -104,9 +148,23 @@
 //
 // Supported Languages
 //
-// Ada, assembly, AWK, C, C++, C#, D (not the ddoc comments), Delphi,
-// Dockerfile, Eiffel, Elixir, Erlang, Go, Haskell, HTML, Java, Javascript,
-// JSON, Kotlin, Lisp, Makefile, Matlab, OCaml, Perl (not __END__ comments),
-// PHP, PowerShell, Python, R, Ruby (not __END__ comments), Rust, Scala,
-// Scheme, shell scripts, SQL, Standard ML, TeX, Tcl, YAML.
+// Ada, AsciiDoc, assembly (including the preprocessed .S files), AWK, Batch, C,
+// C++, C#, Clojure, COBOL (fixed format), Coq, CSS, CSV, D (not the ddoc
+// comments), Dart, Delphi, Dockerfile, Eiffel, Elixir, Elm, Erlang, F#, Go, Go
+// templates, Haskell, HCL (including Terraform), HTML, Java, Javascript, JSON,
+// JSON5, JSONC, Kotlin, Lisp, Lua, Makefile (including .mk and .mak files, and
+// e.g. GNUmakefile or Makefile.win), Matlab, OCaml, Perl, PHP, plain text
+// (including common files without an extension, like README), PowerShell
+// (including modules and manifests), Python, R, reStructuredText, Ruby, Rust,
+// Scala, Scheme, shell scripts, SQL, Standard ML, SystemVerilog, TeX, Tcl,
+// Verilog, VHDL, Xcode build configuration files (.xcconfig) and projects
+// (.pbxproj), XML (including property lists), YAML.
+//
+// Some extensions are used by more than one language. Most notably, ".v" files
+// are counted as Verilog by default, although Coq uses it too. The
+// language of any extension can be explicitly overridden using
+// Options.ExtensionOverrides, or the -lang flag of the command line tool; e.g.
+// to count ".v" files as Coq:
+//
+//	$ glocc -lang v=Coq ~/src/proofs
 package glocc
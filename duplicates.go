@@ -0,0 +1,114 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"hash/fnv"
+	"strings"
+	"sync"
+)
+
+// A concurrency-safe set of the hashes of all lines of code seen so far, during
+// a single traversal. It is used to detect lines of code that are exact
+// duplicates of lines seen elsewhere.
+type lineSet struct {
+	mu     sync.Mutex
+	hashes map[uint64]struct{}
+
+	// Only non-nil for a journal of another lineSet (see journal), in
+	// which case the fields above are only guarded by the mutex of parent.
+	parent    *lineSet
+	abandoned bool
+}
+
+// Returns a new, empty lineSet.
+func newLineSet() *lineSet {
+	return &lineSet{hashes: make(map[uint64]struct{})}
+}
+
+// Returns a journal of the set: a lineSet that adds lines to the set, but also
+// records them, so that they can all be removed from it again by rollback.
+func (ls *lineSet) journal() *lineSet {
+	return &lineSet{hashes: make(map[uint64]struct{}), parent: ls}
+}
+
+// Adds the given line (ignoring any leading and trailing whitespace) to the
+// set. Returns true if the line had not been seen before; false otherwise.
+func (ls *lineSet) add(line string) bool {
+	h := fnv.New64a()
+	h.Write([]byte(strings.TrimSpace(line)))
+	sum := h.Sum64()
+
+	if ls.parent == nil {
+		ls.mu.Lock()
+		defer ls.mu.Unlock()
+		if _, exists := ls.hashes[sum]; exists {
+			return false
+		}
+		ls.hashes[sum] = struct{}{}
+		return true
+	}
+	ls.parent.mu.Lock()
+	defer ls.parent.mu.Unlock()
+	if ls.abandoned {
+		return true
+	}
+	if _, exists := ls.parent.hashes[sum]; exists {
+		return false
+	}
+	ls.parent.hashes[sum] = struct{}{}
+	ls.hashes[sum] = struct{}{}
+	return true
+}
+
+// Removes the lines added through the journal from its set, and makes it
+// ignore any lines added to it from then on.
+func (ls *lineSet) rollback() {
+	ls.parent.mu.Lock()
+	defer ls.parent.mu.Unlock()
+	for sum := range ls.hashes {
+		delete(ls.parent.hashes, sum)
+	}
+	ls.abandoned = true
+}
+
+// DuplicateTracker tracks the lines of code seen so far, to detect exact
+// duplicates among them, across all countings that share it through
+// Options.Duplicates (e.g. of many related checkouts, counted concurrently). It
+// is safe for concurrent use.
+type DuplicateTracker struct {
+	lines *lineSet
+}
+
+// NewDuplicateTracker returns a new DuplicateTracker, without any lines seen.
+func NewDuplicateTracker() *DuplicateTracker {
+	return &DuplicateTracker{lines: newLineSet()}
+}
+
+// DuplicationRatio returns the ratio of the lines of code under the directory
+// associated with the DirResult that are exact duplicates (ignoring leading
+// and trailing whitespace) of lines of code seen elsewhere, to the total lines
+// of code counted. It is only meaningful if the counting was performed with
+// Options.DetectDuplicates set.
+func (d DirResult) DuplicationRatio() float64 {
+	total := 0
+	for _, loc := range d.Summary {
+		total += loc
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(d.Duplicates) / float64(total)
+}
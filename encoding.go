@@ -0,0 +1,241 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding identifies a legacy 8-bit character encoding, which can be used to
+// decode files that turn out not to be valid UTF-8.
+type Encoding int
+
+const (
+	// NoFallbackEncoding leaves invalid UTF-8 byte sequences as they are.
+	NoFallbackEncoding Encoding = iota
+	// Latin1 is ISO-8859-1.
+	Latin1
+	// Windows1252 is the Windows-1252 code page, a superset of Latin-1.
+	Windows1252
+)
+
+// Windows-1252 code points for the bytes in the range 0x80-0x9F; the rest of
+// the bytes map to the same code points as in Latin-1. Bytes that are left
+// undefined by Windows-1252 map to the corresponding C1 control characters.
+var windows1252Table = [32]rune{
+	'€', '\u0081', '‚', 'ƒ', '„', '…', '†', '‡',
+	'ˆ', '‰', 'Š', '‹', 'Œ', '\u008D', 'Ž', '\u008F',
+	'\u0090', '‘', '’', '“', '”', '•', '–', '—',
+	'˜', '™', 'š', '›', 'œ', '\u009D', 'ž', 'Ÿ',
+}
+
+// Returns the code point that the given byte represents in the Encoding.
+func (e Encoding) decodeByte(b byte) rune {
+	if e == Windows1252 && b >= 0x80 && b < 0xA0 {
+		return windows1252Table[b-0x80]
+	}
+	return rune(b)
+}
+
+// Returns an io.Reader that decodes the text read from r to UTF-8.
+//
+// A leading UTF-8 byte order mark is stripped, and content starting with a
+// UTF-16 (little or big endian) byte order mark is transcoded to UTF-8. Any
+// other content is assumed to be UTF-8; if a fallback Encoding is given, any
+// byte that is not part of a valid UTF-8 sequence is decoded using it.
+func newTextReader(r io.Reader, fallback Encoding) io.Reader {
+	br := bufio.NewReader(r)
+	if bom, _ := br.Peek(3); bytes.HasPrefix(bom, []byte{0xEF, 0xBB, 0xBF}) {
+		br.Discard(3)
+	} else if bytes.HasPrefix(bom, []byte{0xFF, 0xFE}) {
+		br.Discard(2)
+		return &utf16Reader{r: br, littleEndian: true}
+	} else if bytes.HasPrefix(bom, []byte{0xFE, 0xFF}) {
+		br.Discard(2)
+		return &utf16Reader{r: br}
+	}
+	if fallback == NoFallbackEncoding {
+		return br
+	}
+	return &fallbackReader{r: br, encoding: fallback}
+}
+
+// An io.Reader that transcodes UTF-16 text to UTF-8.
+type utf16Reader struct {
+	r            *bufio.Reader
+	littleEndian bool
+	out          []byte
+	err          error
+}
+
+// Returns the next UTF-16 code unit, without consuming it.
+func (u *utf16Reader) peekUnit() (uint16, error) {
+	unit, err := u.r.Peek(2)
+	if len(unit) < 2 {
+		if err == nil || err == bufio.ErrBufferFull {
+			err = io.EOF
+		}
+		return 0, err
+	}
+	if u.littleEndian {
+		return uint16(unit[0]) | uint16(unit[1])<<8, nil
+	}
+	return uint16(unit[1]) | uint16(unit[0])<<8, nil
+}
+
+// Reads the next UTF-16 code unit.
+func (u *utf16Reader) readUnit() (uint16, error) {
+	unit, err := u.peekUnit()
+	if err == nil {
+		u.r.Discard(2)
+	}
+	return unit, err
+}
+
+func (u *utf16Reader) Read(p []byte) (int, error) {
+	for len(u.out) < len(p) && u.err == nil {
+		unit, err := u.readUnit()
+		if err != nil {
+			u.err = err
+			break
+		}
+		r := rune(unit)
+		if utf16.IsSurrogate(r) {
+			// A high surrogate is only decoded along with a low one that
+			// follows it; any other unit that follows it is left to be
+			// decoded on its own, after a RuneError for the lone surrogate.
+			next, err := u.peekUnit()
+			if err != nil {
+				u.err = err
+				r = utf8.RuneError
+			} else if r = utf16.DecodeRune(r, rune(next)); r != utf8.RuneError {
+				u.r.Discard(2)
+			}
+		}
+		u.out = appendRune(u.out, r)
+	}
+	n := copy(p, u.out)
+	u.out = u.out[n:]
+	if n == 0 && u.err != nil {
+		return 0, u.err
+	}
+	return n, nil
+}
+
+// An io.Reader that passes valid UTF-8 through, decoding any other byte using
+// a fallback Encoding.
+type fallbackReader struct {
+	r        *bufio.Reader
+	encoding Encoding
+	out      []byte
+	err      error
+}
+
+func (f *fallbackReader) Read(p []byte) (int, error) {
+	for len(f.out) < len(p) && f.err == nil {
+		b, err := f.r.Peek(utf8.UTFMax)
+		if len(b) == 0 {
+			f.err = err
+			break
+		}
+		// Peek returns fewer than utf8.UTFMax bytes only near EOF, so a
+		// RuneError here always means an invalid (not a partial) sequence.
+		r, size := utf8.DecodeRune(b)
+		if r == utf8.RuneError && size == 1 {
+			r = f.encoding.decodeByte(b[0])
+		}
+		f.r.Discard(size)
+		f.out = appendRune(f.out, r)
+	}
+	n := copy(p, f.out)
+	f.out = f.out[n:]
+	if n == 0 && f.err != nil {
+		return 0, f.err
+	}
+	return n, nil
+}
+
+// Appends the UTF-8 encoding of r to out.
+func appendRune(out []byte, r rune) []byte {
+	var buf [utf8.UTFMax]byte
+	return append(out, buf[:utf8.EncodeRune(buf[:], r)]...)
+}
+
+// DefaultScanBufferBytes is the maximum length of a line, in bytes, if
+// Options.ScanBufferBytes is not set; it is much longer than that of
+// bufio.Scanner (64 KiB), to fit most generated files as well.
+const DefaultScanBufferBytes = 1 << 20
+
+// Returns a bufio.Scanner that reads the lines of the text read from r (see
+// scanLines), up to the maximum length given by the Options.
+func newLineScanner(r io.Reader, opts *Options) *bufio.Scanner {
+	fsc := bufio.NewScanner(r)
+	// The buffer starts small, and only grows as much as needed.
+	fsc.Buffer(nil, opts.scanBufferBytes())
+	fsc.Split(scanLines)
+	return fsc
+}
+
+// Returns the error of the given bufio.Scanner, returned by newLineScanner,
+// that stopped after the given number of lines; if a line was too long, the
+// error names it, so that the file that needs attention is easily found.
+func lineScannerErr(fsc *bufio.Scanner, lines int, opts *Options) error {
+	err := fsc.Err()
+	if err == bufio.ErrTooLong {
+		return fmt.Errorf("Line %d is longer than %d bytes (see Options.ScanBufferBytes); the rest of the file is not counted.", lines+1, opts.scanBufferBytes())
+	}
+	return err
+}
+
+// Returns the maximum length of a line, as given by the Options, or the
+// default one.
+func (o *Options) scanBufferBytes() int {
+	if o.ScanBufferBytes == 0 {
+		return DefaultScanBufferBytes
+	}
+	return o.ScanBufferBytes
+}
+
+// A bufio.SplitFunc that splits text into lines, like bufio.ScanLines, except
+// that lines may end in a lone carriage return too (as in files written on
+// classic Mac OS), besides a line feed or a CRLF pair. The line endings are
+// stripped; the last line of the text is returned exactly once, whether it has
+// a line ending or not.
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		switch {
+		case data[i] == '\n':
+			return i + 1, data[:i], nil
+		case i+1 < len(data) && data[i+1] == '\n':
+			return i + 2, data[:i], nil
+		case i+1 < len(data) || atEOF:
+			return i + 1, data[:i], nil
+		}
+		// Cannot tell a lone carriage return from a CRLF pair yet.
+		return 0, nil, nil
+	}
+	if atEOF {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestScanLines(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"empty", "", nil},
+		{"LF", "a\nb\n", []string{"a", "b"}},
+		{"LF, no final terminator", "a\nb", []string{"a", "b"}},
+		{"CRLF", "a\r\nb\r\n", []string{"a", "b"}},
+		{"CRLF, no final terminator", "a\r\nb", []string{"a", "b"}},
+		{"lone CR", "a\rb\r", []string{"a", "b"}},
+		{"lone CR, no final terminator", "a\rb", []string{"a", "b"}},
+		{"mixed", "a\nb\r\nc\rd", []string{"a", "b", "c", "d"}},
+		{"blank lines", "\n\r\n\r", []string{"", "", ""}},
+		{"CR, LF", "a\r\r\nb", []string{"a", "", "b"}},
+		{"LF, CR", "a\n\rb", []string{"a", "", "b"}},
+		{"only a terminator", "\n", []string{""}},
+		{"only a lone CR", "\r", []string{""}},
+	}
+	readers := []struct {
+		name string
+		wrap func(io.Reader) io.Reader
+	}{
+		{"whole", func(r io.Reader) io.Reader { return r }},
+		// A carriage return at the end of a read cannot be told apart
+		// from the start of a CRLF pair, until the next read.
+		{"byte by byte", iotest.OneByteReader},
+	}
+	for _, test := range tests {
+		for _, reader := range readers {
+			t.Run(test.name+", "+reader.name, func(t *testing.T) {
+				fsc := newLineScanner(reader.wrap(strings.NewReader(test.content)), &Options{})
+				var got []string
+				for fsc.Scan() {
+					got = append(got, fsc.Text())
+				}
+				if err := fsc.Err(); err != nil {
+					t.Fatalf("Scanning %q: %v", test.content, err)
+				}
+				if !reflect.DeepEqual(got, test.want) {
+					t.Errorf("Scanning %q returned lines %q; want %q", test.content, got, test.want)
+				}
+			})
+		}
+	}
+}
+
+func TestLineEndingsCount(t *testing.T) {
+	runLineCountTests(t, []lineCountTest{
+		{"LF", "c", "int x;\n\n// a\n", 1, 1, 1},
+		{"LF, no final terminator", "c", "int x;\n\n// a", 1, 1, 1},
+		{"CRLF", "c", "int x;\r\n\r\n// a\r\n", 1, 1, 1},
+		{"CRLF, no final terminator", "c", "int x;\r\n\r\n// a", 1, 1, 1},
+		{"lone CR", "c", "int x;\r\r// a\r", 1, 1, 1},
+		{"lone CR, no final terminator", "c", "int x;\r\r// a", 1, 1, 1},
+		{"lone CR, block comment", "c", "/* a\rb */\rint x;", 1, 2, 0},
+	})
+}
+
+func TestUTF16Reader(t *testing.T) {
+	tests := []struct {
+		name  string
+		units []uint16
+		want  string
+	}{
+		{"BMP", []uint16{'a', 0x00E9, '\n'}, "aé\n"},
+		{"surrogate pair", []uint16{0xD83D, 0xDE00, 'a'}, "\U0001F600a"},
+		{"lone high surrogate", []uint16{0xD83D, 'a', 'b'}, "�ab"},
+		{"lone low surrogate", []uint16{0xDE00, 'a'}, "�a"},
+		{"two high surrogates", []uint16{0xD83D, 0xD83D, 0xDE00}, "�\U0001F600"},
+		{"high surrogate at EOF", []uint16{'a', 0xD83D}, "a�"},
+	}
+	for _, test := range tests {
+		for _, littleEndian := range []bool{true, false} {
+			var content []byte
+			if littleEndian {
+				content = []byte{0xFF, 0xFE}
+			} else {
+				content = []byte{0xFE, 0xFF}
+			}
+			for _, unit := range test.units {
+				if littleEndian {
+					content = append(content, byte(unit), byte(unit>>8))
+				} else {
+					content = append(content, byte(unit>>8), byte(unit))
+				}
+			}
+			got, err := io.ReadAll(newTextReader(iotest.OneByteReader(strings.NewReader(string(content))), NoFallbackEncoding))
+			if err != nil {
+				t.Fatalf("%s: %v", test.name, err)
+			}
+			if string(got) != test.want {
+				t.Errorf("%s (little endian: %t): read %q; want %q", test.name, littleEndian, got, test.want)
+			}
+		}
+	}
+}
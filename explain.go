@@ -0,0 +1,79 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// LineExplanation is the classification of a single line of a file, and the
+// decision on whether it was counted as a line of code, as returned by
+// ExplainFile.
+type LineExplanation struct {
+	// Number is the (1-based) number of the line in the file.
+	Number int
+	// Line is the line, exactly as read (without its line ending). A line
+	// that is continued on the following ones (e.g. by a trailing
+	// backslash in C) is joined with them into a single LineExplanation,
+	// numbered after its first line, although each of them is counted.
+	Line string
+	// State is the classification of the line.
+	State LineState
+	// Counted is true if the line was counted as a line of code; Excluded
+	// and Directive are true if it was instead excluded from the count
+	// (see Options.ExcludeLinePattern), or counted as a directive (see
+	// Options.DirectivePatterns), respectively.
+	Counted, Excluded, Directive bool
+}
+
+// ExplainFile counts the lines of code in the file at the given path, as
+// configured by the given Options, and returns the name of its language along
+// with the classification of each of its lines, in order, for understanding
+// the decisions of the counting. The language is only detected by the name of
+// the file (taking into account Options.ExtensionOverrides and
+// CustomLanguages), and the fenced code blocks of Markdown files are always
+// counted as Markdown.
+func ExplainFile(path string, opts Options) (string, []LineExplanation, error) {
+	if err := opts.Validate(); err != nil {
+		return "", nil, err
+	}
+	t := newTraversal(opts, nil)
+	name, decorators := t.decorators(path)
+	lang, reason, found := t.detectLanguage(name)
+	if !found {
+		return "", nil, fmt.Errorf("Cannot explain %q: %s.", path, reason)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer file.Close()
+	r, err := decorate(path, file, decorators)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var lines []LineExplanation
+	lc := t.newLocCounter(r, path, lang)
+	lc.explain = func(line LineExplanation) {
+		lines = append(lines, line)
+	}
+	if _, err := lc.fileResult(filepath.Base(path)); err != nil {
+		return lang.name, lines, fmt.Errorf("%s: %w", path, err)
+	}
+	return lang.name, lines, nil
+}
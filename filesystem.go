@@ -0,0 +1,115 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+)
+
+// Reads the directory with the given path in the filesystem of the traversal,
+// and returns information about all of its entries.
+func (t *traversal) readDir(dirPath string) ([]os.FileInfo, error) {
+	if t.fsys == nil {
+		// open(2) the directory to readdir(2) and stat(2) it.
+		dir, err := os.Open(dirPath)
+		if err != nil {
+			return nil, err
+		}
+		defer dir.Close()
+		return dir.Readdir(0)
+	}
+
+	entries, err := fs.ReadDir(t.fsys, dirPath)
+	if err != nil {
+		return nil, err
+	}
+	fileinfoz := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		fileinfo, err := entry.Info()
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return fileinfoz, err
+		}
+		fileinfoz = append(fileinfoz, fileinfo)
+	}
+	return fileinfoz, nil
+}
+
+// Opens the file with the given path in the filesystem of the traversal, for
+// reading.
+func (t *traversal) open(filename string) (io.ReadCloser, error) {
+	if t.fsys == nil {
+		return os.Open(filename)
+	}
+	return t.fsys.Open(filename)
+}
+
+// Joins the given directory path and name into a path of the filesystem of
+// the traversal.
+func (t *traversal) join(dirPath, name string) string {
+	if t.fsys == nil {
+		return filepath.Join(dirPath, name)
+	}
+	return path.Join(dirPath, name)
+}
+
+// Returns all but the last element of the given path of the filesystem of the
+// traversal.
+func (t *traversal) dir(name string) string {
+	if t.fsys == nil {
+		return filepath.Dir(name)
+	}
+	return path.Dir(name)
+}
+
+// Reports whether a file or directory with the given path exists in the
+// filesystem of the traversal.
+func (t *traversal) exists(name string) bool {
+	var err error
+	if t.fsys == nil {
+		_, err = os.Lstat(name)
+	} else {
+		_, err = fs.Stat(t.fsys, name)
+	}
+	return err == nil
+}
+
+// The identity of a file in the filesystem of the operating system, i.e. its
+// device and inode numbers, which is shared by all of its hard links.
+type fileID struct{ dev, ino uint64 }
+
+// A set of fileIDs, safe for concurrent use.
+type fileIDSet struct {
+	mu  sync.Mutex
+	ids map[fileID]struct{}
+}
+
+// Adds the given fileID to the set. Returns true if it had not been seen
+// before; false otherwise.
+func (s *fileIDSet) add(id fileID) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.ids[id]; exists {
+		return false
+	}
+	s.ids[id] = struct{}{}
+	return true
+}
@@ -0,0 +1,68 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"path/filepath"
+	"regexp"
+)
+
+// The header of generated Go files, as specified by `go help generate`; it
+// must appear before the first non-comment, non-blank text of the file.
+var generatedGoHeader = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// DefaultGeneratedPatterns returns a new slice of the patterns of the names of
+// some common generated Go files (e.g. protobuf and gRPC stubs, or the output
+// of code generators), suitable for use as Options.GeneratedPatterns.
+func DefaultGeneratedPatterns() []string {
+	return []string{
+		"*.pb.go", "*.pb.gw.go", "*_grpc.pb.go", "*.pb.validate.go",
+		"*_gen.go", "*.gen.go", "*_generated.go", "zz_generated.*.go",
+		"bindata.go", "*_mock.go", "mock_*.go", "wire_gen.go",
+	}
+}
+
+// Reports whether the file with the given name is a generated one, according
+// to Options.GeneratedPatterns, if Options.SeparateGenerated is set.
+func (t *traversal) isGeneratedFile(filename string) bool {
+	if !t.opts.SeparateGenerated {
+		return false
+	}
+	baseName := filepath.Base(filename)
+	for _, pattern := range t.opts.GeneratedPatterns {
+		if matched, _ := filepath.Match(pattern, baseName); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the current line of the LocCounter marks the file as a
+// generated one, i.e. whether it is the standard header of generated Go files,
+// found before any line of code, if Options.SeparateGenerated is set.
+func (lc *LocCounter) lineIsGeneratedHeader() bool {
+	return lc.opts.SeparateGenerated && lc.language.name == "Go" && lc.loc == 0 &&
+		generatedGoHeader.MatchString(lc.rawLine)
+}
+
+// Moves all lines out of the Loc of the FileResult, into its Generated (see
+// Options.SeparateGenerated).
+func (f *FileResult) separateGenerated() {
+	if len(f.Loc) == 0 {
+		return
+	}
+	mergeCounts(&f.Generated, f.Loc)
+	f.Loc = make(map[string]int)
+}
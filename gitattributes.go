@@ -0,0 +1,223 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"bufio"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// A single line of a .gitattributes file: a pattern, and the attributes of the
+// files that match it. Attributes that are set have the value "true", those
+// that are unset "false", and those that are explicitly unspecified (using the
+// "!attr" syntax) an empty value.
+type gitAttributesRule struct {
+	pattern    *regexp.Regexp
+	attributes map[string]string
+}
+
+// The rules of a .gitattributes file, along with the directory that it is in,
+// to which its patterns are relative.
+type gitAttributesFile struct {
+	dir   string
+	rules []gitAttributesRule
+}
+
+// The .gitattributes files that apply to the entries of a directory,
+// outermost first, and whether the directory lives in a git repository.
+type gitAttributesDir struct {
+	files  []gitAttributesFile
+	inRepo bool
+}
+
+// The .gitattributes files read during a traversal, per directory, so that
+// each file is only read once.
+type gitAttributesCache struct {
+	mu   sync.Mutex
+	dirs map[string]gitAttributesDir
+}
+
+// Returns the .gitattributes files that apply to the entries of the given
+// directory, reading those that have not been read already. Like the
+// .gitignore files (see gitIgnoreFiles), those are the .gitattributes files of
+// the directory itself and of its ancestors up to the root of the git
+// repository that it lives in, or only those under the root of the traversal
+// (if any) outside of any repository.
+func (t *traversal) gitAttributesFiles(dirPath string) gitAttributesDir {
+	c := t.gitAttributes
+	c.mu.Lock()
+	d, cached := c.dirs[dirPath]
+	c.mu.Unlock()
+	if cached {
+		return d
+	}
+
+	if t.exists(t.join(dirPath, ".git")) {
+		d.inRepo = true
+	} else if parent := t.dir(dirPath); parent != dirPath {
+		d = t.gitAttributesFiles(parent)
+	}
+	if d.inRepo || t.underRoot(dirPath) {
+		if file, err := t.open(t.join(dirPath, ".gitattributes")); err == nil {
+			rules := parseGitAttributes(bufio.NewScanner(file))
+			file.Close()
+			if len(rules) > 0 {
+				d.files = append(d.files[:len(d.files):len(d.files)], gitAttributesFile{dir: dirPath, rules: rules})
+			}
+		}
+	}
+	c.mu.Lock()
+	c.dirs[dirPath] = d
+	c.mu.Unlock()
+	return d
+}
+
+// Returns the linguist attributes of the file with the given path, as set by
+// the .gitattributes files that apply to it (see gitAttributesFiles).
+func (t *traversal) linguistAttributes(filename string) map[string]string {
+	if t.fsys == nil {
+		if abs, err := filepath.Abs(filename); err == nil {
+			filename = abs
+		}
+	}
+
+	// Rules of deeper directories take precedence, so apply them last.
+	attributes := make(map[string]string)
+	for _, file := range t.gitAttributesFiles(t.dir(filename)).files {
+		rel, err := filepath.Rel(file.dir, filename)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, rule := range file.rules {
+			if rule.pattern.MatchString(rel) {
+				for attr, value := range rule.attributes {
+					attributes[attr] = value
+				}
+			}
+		}
+	}
+	return attributes
+}
+
+// Returns the reason why the file with the given path should be skipped,
+// according to its linguist attributes, or an empty string if it should be
+// counted; in the latter case, the language it is overridden to (if any) is
+// also returned.
+func (t *traversal) skipByGitAttributes(filename string) (reason, lang string) {
+	attributes := t.linguistAttributes(filename)
+	for _, attr := range []string{"linguist-vendored", "linguist-generated", "linguist-documentation"} {
+		if attributes[attr] == "true" {
+			return fmt.Sprintf("marked as %s in .gitattributes", attr), ""
+		}
+	}
+	if lang := attributes["linguist-language"]; lang != "" && lang != "true" && lang != "false" {
+		return "", lang
+	}
+	return "", ""
+}
+
+// Parses the lines of a .gitattributes file, ignoring those that are not
+// about linguist attributes.
+func parseGitAttributes(sc *bufio.Scanner) []gitAttributesRule {
+	var rules []gitAttributesRule
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") || strings.HasPrefix(fields[0], "[attr]") {
+			continue
+		}
+		rule := gitAttributesRule{attributes: make(map[string]string)}
+		for _, field := range fields[1:] {
+			switch {
+			case strings.HasPrefix(field, "-"):
+				rule.attributes[field[1:]] = "false"
+			case strings.HasPrefix(field, "!"):
+				rule.attributes[field[1:]] = ""
+			case strings.Contains(field, "="):
+				kv := strings.SplitN(field, "=", 2)
+				rule.attributes[kv[0]] = kv[1]
+			default:
+				rule.attributes[field] = "true"
+			}
+		}
+		for attr := range rule.attributes {
+			if !strings.HasPrefix(attr, "linguist-") {
+				delete(rule.attributes, attr)
+			}
+		}
+		if len(rule.attributes) == 0 {
+			continue
+		}
+		pattern, err := gitPatternRegexp(fields[0])
+		if err != nil {
+			logger.Printf("INFO Ignoring invalid .gitattributes pattern %q: %v\n", fields[0], err)
+			continue
+		}
+		rule.pattern = pattern
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// Translates a pattern of a .gitattributes (or .gitignore) file into a regular
+// expression that matches the slash-separated paths (relative to the directory
+// of the file) that the pattern matches.
+func gitPatternRegexp(pattern string) (*regexp.Regexp, error) {
+	var re strings.Builder
+	re.WriteString("^")
+	if !strings.Contains(pattern, "/") {
+		// Patterns without a slash match the base names at any depth.
+		re.WriteString("(?:.*/)?")
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		default:
+			// Quote the byte as is, so that multi-byte UTF-8 characters
+			// are kept intact.
+			re.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+	re.WriteString("$")
+	return regexp.Compile(re.String())
+}
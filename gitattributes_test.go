@@ -0,0 +1,91 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGitPatternRegexp(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*.c", "a.c", true},
+		{"*.c", "src/a.c", true},
+		{"*.c", "a.cc", false},
+		{"/a.c", "a.c", true},
+		{"/a.c", "src/a.c", false},
+		{"src/*.c", "src/a.c", true},
+		{"src/*.c", "src/sub/a.c", false},
+		{"src/**/*.c", "src/sub/deep/a.c", true},
+		{"src/**/*.c", "src/a.c", true},
+		{"**/gen/*.go", "a/b/gen/x.go", true},
+		{"vendor/**", "vendor/x/y.go", true},
+		{"?.c", "a.c", true},
+		{"?.c", "ab.c", false},
+		{"[ab].c", "b.c", true},
+		{"[!ab].c", "b.c", false},
+		{`\*.c`, "*.c", true},
+		{`\*.c`, "a.c", false},
+		{"a+b.c", "a+b.c", true},
+		{"a+b.c", "aab.c", false},
+		{"café.c", "café.c", true},
+		{"café.c", "src/café.c", true},
+		{"caf?.c", "café.c", true},
+		{"*.ü", "x.ü", true},
+		{"日本/*.go", "日本/a.go", true},
+	}
+	for _, test := range tests {
+		re, err := gitPatternRegexp(test.pattern)
+		if err != nil {
+			t.Errorf("gitPatternRegexp(%q): %v", test.pattern, err)
+			continue
+		}
+		if got := re.MatchString(test.path); got != test.want {
+			t.Errorf("gitPatternRegexp(%q).MatchString(%q) = %t; want %t", test.pattern, test.path, got, test.want)
+		}
+	}
+}
+
+func TestGitAttributesNonASCIIPattern(t *testing.T) {
+	repo := t.TempDir()
+	writeTree(t, repo, map[string]string{
+		".git/":          "",
+		".gitattributes": "café.c linguist-vendored\n",
+		"café.c":         "int x;\n",
+		"cafe.c":         "int y;\n",
+	})
+	checkSummary(t, repo, Options{UseGitAttributes: true}, map[string]int{"C": 1})
+}
+
+func TestGitAttributesOfAncestors(t *testing.T) {
+	// Outside of any git repository, the .gitattributes files of the
+	// ancestors of the directory being counted are not taken into account.
+	outer := t.TempDir()
+	writeTree(t, outer, map[string]string{
+		".gitattributes":      "*.py linguist-vendored\n",
+		"proj/.gitattributes": "*.txt linguist-documentation\n",
+		"proj/a.py":           "x = 1\n",
+		"proj/b.txt":          "skipped\n",
+	})
+	proj := filepath.Join(outer, "proj")
+	checkSummary(t, proj, Options{UseGitAttributes: true}, map[string]int{"Python": 1})
+
+	// Within one, those of the ancestors up to its root are.
+	writeTree(t, outer, map[string]string{".git/": ""})
+	checkSummary(t, proj, Options{UseGitAttributes: true}, map[string]int{})
+}
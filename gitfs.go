@@ -0,0 +1,245 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GitFS is a read-only fs.FS backed by the tree of a commit in a git
+// repository, as read using the git command line tool. It allows counting the
+// lines of code of any commit (e.g. using CountLocFS) without checking it out.
+//
+// Submodules are omitted, and symbolic links are reported as such (thus they
+// are not counted). A GitFS must be closed after use.
+type GitFS struct {
+	nodes map[string]*gitNode
+
+	// A long-running `git cat-file --batch` process, which reads the
+	// contents of the blobs; access is serialized through mu. Once its
+	// output cannot be parsed any more, err is set, and returned by any
+	// further attempt to read from it.
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	err    error
+}
+
+// A file or directory in the tree of a GitFS.
+type gitNode struct {
+	name     string
+	mode     fs.FileMode
+	size     int64
+	object   string
+	children []*gitNode
+}
+
+// NewGitFS returns a new GitFS for the tree of the given ref (e.g. a branch,
+// tag or commit hash) in the git repository at the given directory.
+func NewGitFS(repo, ref string) (*GitFS, error) {
+	output, err := exec.Command("git", "-C", repo, "ls-tree", "-r", "-t", "-l", "-z", "--full-tree", ref).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-tree %s: %w", ref, err)
+	}
+	g := &GitFS{nodes: map[string]*gitNode{
+		".": {name: ".", mode: fs.ModeDir | 0555},
+	}}
+	for _, entry := range bytes.Split(output, []byte{0}) {
+		if len(entry) == 0 {
+			continue
+		}
+		// <mode> SP <type> SP <object> SP <size> TAB <path>
+		var fields []string
+		tab := bytes.IndexByte(entry, '\t')
+		if tab != -1 {
+			fields = strings.Fields(string(entry[:tab]))
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("git ls-tree %s: unexpected entry %q", ref, entry)
+		}
+		name := string(entry[tab+1:])
+		node := &gitNode{name: path.Base(name), object: fields[2]}
+		switch {
+		case fields[1] == "tree":
+			node.mode = fs.ModeDir | 0555
+		case fields[1] == "blob" && fields[0] == "120000":
+			node.mode = fs.ModeSymlink | 0777
+		case fields[1] == "blob":
+			node.mode = 0444
+			node.size, _ = strconv.ParseInt(fields[3], 10, 64)
+		default:
+			continue // submodules
+		}
+		g.nodes[name] = node
+		// ls-tree lists each tree before its entries.
+		parent := g.nodes[path.Dir(name)]
+		parent.children = append(parent.children, node)
+	}
+
+	g.cmd = exec.Command("git", "-C", repo, "cat-file", "--batch")
+	if g.stdin, err = g.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	stdout, err := g.cmd.StdoutPipe()
+	if err != nil {
+		g.stdin.Close()
+		return nil, err
+	}
+	g.stdout = bufio.NewReader(stdout)
+	if err := g.cmd.Start(); err != nil {
+		g.stdin.Close()
+		stdout.Close()
+		return nil, fmt.Errorf("git cat-file --batch: %w", err)
+	}
+	return g, nil
+}
+
+// Close terminates the git process used to read the contents of the files.
+func (g *GitFS) Close() error {
+	g.stdin.Close()
+	return g.cmd.Wait()
+}
+
+// Open opens the named file or directory of the tree, implementing fs.FS.
+func (g *GitFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	node, exists := g.nodes[name]
+	if !exists {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if node.mode.IsDir() {
+		return &gitDir{node: node}, nil
+	}
+	content, err := g.readBlob(node.object)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &gitFile{node: node, Reader: bytes.NewReader(content)}, nil
+}
+
+// Reads the whole content of the blob with the given object name.
+func (g *GitFS) readBlob(object string) ([]byte, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.err != nil {
+		return nil, g.err
+	}
+	return g.readBatchOutput(object)
+}
+
+// Requests the blob with the given object name from the git process, and
+// reads its output. It sets g.err if the output is not exactly as expected, so
+// that none of it is mistaken for the output of the next blob.
+func (g *GitFS) readBatchOutput(object string) ([]byte, error) {
+	if _, err := fmt.Fprintln(g.stdin, object); err != nil {
+		g.err = fmt.Errorf("git cat-file: %w", err)
+		return nil, g.err
+	}
+	// <object> SP <type> SP <size> LF <contents> LF, or
+	// <object> SP missing LF (or ambiguous) if there is no such blob.
+	header, err := g.stdout.ReadString('\n')
+	if err != nil {
+		g.err = fmt.Errorf("git cat-file: %w", err)
+		return nil, g.err
+	}
+	fields := strings.Fields(header)
+	if len(fields) == 2 {
+		return nil, fmt.Errorf("git cat-file: object %s is %s", object, fields[1])
+	}
+	var size int
+	if len(fields) == 3 {
+		size, err = strconv.Atoi(fields[2])
+	}
+	if len(fields) != 3 || err != nil || size < 0 {
+		g.err = fmt.Errorf("git cat-file: unexpected header %q", header)
+		return nil, g.err
+	}
+	content := make([]byte, size)
+	n, err := io.ReadFull(g.stdout, content)
+	if err != nil {
+		// Skip whatever is left of the contents, along with the LF.
+		io.CopyN(io.Discard, g.stdout, int64(size-n)+1)
+		g.err = fmt.Errorf("git cat-file: %w", err)
+		return nil, g.err
+	}
+	if lf, err := g.stdout.ReadByte(); err != nil || lf != '\n' {
+		g.err = fmt.Errorf("git cat-file: missing LF after the contents of %s", object)
+		return nil, g.err
+	}
+	return content, nil
+}
+
+// Implements fs.FileInfo for a gitNode.
+type gitFileInfo struct{ node *gitNode }
+
+func (fi gitFileInfo) Name() string       { return fi.node.name }
+func (fi gitFileInfo) Size() int64        { return fi.node.size }
+func (fi gitFileInfo) Mode() fs.FileMode  { return fi.node.mode }
+func (fi gitFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi gitFileInfo) IsDir() bool        { return fi.node.mode.IsDir() }
+func (fi gitFileInfo) Sys() interface{}   { return nil }
+
+// An open file of a GitFS, with its whole content in memory.
+type gitFile struct {
+	node *gitNode
+	*bytes.Reader
+}
+
+func (f *gitFile) Stat() (fs.FileInfo, error) { return gitFileInfo{f.node}, nil }
+func (f *gitFile) Close() error               { return nil }
+
+// An open directory of a GitFS.
+type gitDir struct {
+	node   *gitNode
+	offset int
+}
+
+func (d *gitDir) Stat() (fs.FileInfo, error) { return gitFileInfo{d.node}, nil }
+func (d *gitDir) Close() error               { return nil }
+
+func (d *gitDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.node.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *gitDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	children := d.node.children[d.offset:]
+	if n > 0 && len(children) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(children) {
+		children = children[:n]
+	}
+	entries := make([]fs.DirEntry, len(children))
+	for i, child := range children {
+		entries[i] = fs.FileInfoToDirEntry(gitFileInfo{child})
+	}
+	d.offset += len(children)
+	return entries, nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestGitFS(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	writeTree(t, repo, map[string]string{
+		"a.go":       "package a\n\nfunc A() {}\n",
+		"empty.txt":  "",
+		"src/b.c":    "int b;\n// no final newline",
+		"src/c/d.py": "x = 1\n",
+	})
+	if err := os.Symlink("a.go", filepath.Join(repo, "link.go")); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "-A"},
+		{"-c", "user.name=glocc", "-c", "user.email=glocc@example.com", "commit", "-q", "-m", "Initial commit"},
+	} {
+		cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, output)
+		}
+	}
+	// Changes after the commit are not seen.
+	writeTree(t, repo, map[string]string{"a.go": "package changed\n", "e.go": "package e\n"})
+
+	g, err := NewGitFS(repo, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Close()
+	if err := fstest.TestFS(g, "a.go", "empty.txt", "src/b.c", "src/c/d.py", "link.go"); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"a.go":      "package a\n\nfunc A() {}\n",
+		"empty.txt": "",
+		"src/b.c":   "int b;\n// no final newline",
+	} {
+		if content, err := fs.ReadFile(g, name); err != nil || string(content) != want {
+			t.Errorf("ReadFile(%q) = %q, %v; want %q", name, content, err, want)
+		}
+	}
+	if info, err := fs.Stat(g, "link.go"); err != nil || info.Mode()&fs.ModeSymlink == 0 {
+		t.Errorf("Stat(link.go) = %v, %v; want a symbolic link", info, err)
+	}
+	result, err := CountLocFS(g, ".", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"Go": 2, "C": 1, "Python": 1, "plain text": 0}; !reflect.DeepEqual(result.Summary, want) {
+		t.Errorf("CountLocFS(HEAD).Summary = %v; want %v", result.Summary, want)
+	}
+}
+
+// An io.WriteCloser that discards everything written to it.
+type discardCloser struct{}
+
+func (discardCloser) Write(p []byte) (int, error) { return len(p), nil }
+func (discardCloser) Close() error                { return nil }
+
+func TestGitFSBatchOutput(t *testing.T) {
+	newGitFS := func(output string) *GitFS {
+		return &GitFS{stdin: discardCloser{}, stdout: bufio.NewReader(strings.NewReader(output))}
+	}
+	type read struct {
+		content string
+		err     bool
+	}
+	tests := []struct {
+		name   string
+		output string
+		reads  []read
+	}{
+		{
+			"well-formed",
+			"1 blob 3\nabc\n2 missing\n3 blob 0\n\n4 blob 2\nx\n\n",
+			[]read{{"abc", false}, {"", true}, {"", false}, {"x\n", false}},
+		},
+		{
+			// Nothing after a truncated blob can be trusted.
+			"truncated contents",
+			"1 blob 5\nabc",
+			[]read{{"", true}, {"", true}},
+		},
+		{
+			"longer contents",
+			"1 blob 2\nabc\n2 blob 1\nx\n",
+			[]read{{"", true}, {"", true}},
+		},
+		{
+			"invalid size",
+			"1 blob x\nabc\n",
+			[]read{{"", true}, {"", true}},
+		},
+	}
+	for _, test := range tests {
+		g := newGitFS(test.output)
+		for i, want := range test.reads {
+			content, err := g.readBlob("object")
+			if string(content) != want.content || (err != nil) != want.err {
+				t.Errorf("%s: read %d returned %q, %v; want %q and error %t", test.name, i+1, content, err, want.content, want.err)
+			}
+		}
+	}
+
+	// The error of a broken stream is returned as is.
+	g := newGitFS("1 blob 5\nabc")
+	_, err := g.readBlob("object")
+	if _, again := g.readBlob("object"); !errors.Is(again, io.ErrUnexpectedEOF) || again != err {
+		t.Errorf("Reading after a truncated blob returned %v; want %v", again, err)
+	}
+}
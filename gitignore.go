@@ -0,0 +1,164 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"bufio"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// A single pattern of a .gitignore file, which ignores the paths that it
+// matches, or re-includes them if negated (using the "!pattern" syntax).
+type gitIgnoreRule struct {
+	pattern *regexp.Regexp
+	negated bool
+	dirOnly bool // i.e. the pattern ends with a slash
+}
+
+// The rules of a .gitignore file, along with the directory that it is in, to
+// which its patterns are relative.
+type gitIgnoreFile struct {
+	dir   string
+	rules []gitIgnoreRule
+}
+
+// The .gitignore files that apply to the entries of a directory, outermost
+// first, and whether the directory lives in a git repository.
+type gitIgnoreDir struct {
+	files  []gitIgnoreFile
+	inRepo bool
+}
+
+// The .gitignore files read during a traversal, per directory, so that each
+// file is only read once.
+type gitIgnoreCache struct {
+	mu   sync.Mutex
+	dirs map[string]gitIgnoreDir
+}
+
+// Returns the .gitignore files that apply to the entries of the given
+// directory, reading those that have not been read already. Within a git
+// repository, those are the .gitignore files of the directory itself and of
+// its ancestors up to the root of the repository; outside of any, only those
+// under the root of the traversal (if any) are taken into account, so that
+// stray .gitignore files of its ancestors do not affect the counting.
+func (t *traversal) gitIgnoreFiles(dirPath string) gitIgnoreDir {
+	c := t.gitIgnore
+	c.mu.Lock()
+	d, cached := c.dirs[dirPath]
+	c.mu.Unlock()
+	if cached {
+		return d
+	}
+
+	if t.exists(t.join(dirPath, ".git")) {
+		d.inRepo = true
+	} else if parent := t.dir(dirPath); parent != dirPath {
+		d = t.gitIgnoreFiles(parent)
+	}
+	if d.inRepo || t.underRoot(dirPath) {
+		if file, err := t.open(t.join(dirPath, ".gitignore")); err == nil {
+			rules := parseGitIgnore(bufio.NewScanner(file))
+			file.Close()
+			if len(rules) > 0 {
+				d.files = append(d.files[:len(d.files):len(d.files)], gitIgnoreFile{dir: dirPath, rules: rules})
+			}
+		}
+	}
+	c.mu.Lock()
+	c.dirs[dirPath] = d
+	c.mu.Unlock()
+	return d
+}
+
+// Reports whether the directory with the given path is the root of the
+// traversal or lies under it.
+func (t *traversal) underRoot(dirPath string) bool {
+	switch {
+	case t.root == "":
+		return false
+	case t.fsys == nil:
+		return isUnder(dirPath, t.root)
+	default:
+		return t.root == "." || dirPath == t.root || strings.HasPrefix(dirPath, t.root+"/")
+	}
+}
+
+// Reports whether the file or directory with the given path is ignored by the
+// .gitignore files of its parent directory and of its ancestors, the way git
+// does: the last pattern that matches it wins, and patterns of deeper
+// .gitignore files take precedence.
+func (t *traversal) isGitIgnored(name string, isDir bool) bool {
+	if t.fsys == nil {
+		if abs, err := filepath.Abs(name); err == nil {
+			name = abs
+		}
+	}
+	ignored := false
+	for _, file := range t.gitIgnoreFiles(t.dir(name)).files {
+		rel, err := filepath.Rel(file.dir, name)
+		if err != nil {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, rule := range file.rules {
+			if (isDir || !rule.dirOnly) && rule.pattern.MatchString(rel) {
+				ignored = !rule.negated
+			}
+		}
+	}
+	return ignored
+}
+
+// Parses the lines of a .gitignore file.
+func parseGitIgnore(sc *bufio.Scanner) []gitIgnoreRule {
+	var rules []gitIgnoreRule
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		// Trailing spaces are ignored, unless escaped with a backslash.
+		if trimmed := strings.TrimRight(line, " "); strings.HasSuffix(trimmed, `\`) && len(trimmed) < len(line) {
+			line = trimmed + " "
+		} else {
+			line = trimmed
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var rule gitIgnoreRule
+		pattern := line
+		if strings.HasPrefix(pattern, "!") {
+			rule.negated = true
+			pattern = pattern[1:]
+		}
+		if strings.HasSuffix(pattern, "/") {
+			rule.dirOnly = true
+			pattern = strings.TrimRight(pattern, "/")
+		}
+		if pattern == "" {
+			continue
+		}
+		re, err := gitPatternRegexp(pattern)
+		if err != nil {
+			logger.Printf("INFO Ignoring invalid .gitignore pattern %q: %v\n", line, err)
+			continue
+		}
+		rule.pattern = re
+		rules = append(rules, rule)
+	}
+	return rules
+}
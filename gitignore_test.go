@@ -0,0 +1,81 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestGitIgnore(t *testing.T) {
+	repo := t.TempDir()
+	writeTree(t, repo, map[string]string{
+		".git/":              "",
+		".gitignore":         "build/\n*.min.js\n*.txt\n!keep.txt\n",
+		"a.go":               "package a\n",
+		"build/b.go":         "package b\n",
+		"web/x.js":           "var x = 1;\n",
+		"web/x.min.js":       "var x = 1;\n",
+		"keep.txt":           "kept\n",
+		"drop.txt":           "dropped\n",
+		"sub/.gitignore":     "!*.min.js\n/local.go\n",
+		"sub/y.min.js":       "var y = 1;\n",
+		"sub/local.go":       "package sub\n",
+		"sub/deep/local.go":  "package deep\n",
+		"sub/deep/build.txt": "dropped\n",
+	})
+
+	checkSummary(t, repo, Options{}, map[string]int{
+		"Go":         2, // a.go and sub/deep/local.go
+		"Javascript": 2, // web/x.js and sub/y.min.js
+		"plain text": 1, // keep.txt
+	})
+	checkSummary(t, repo, Options{CountGitIgnored: true}, map[string]int{
+		"Go":         4,
+		"Javascript": 3,
+		"plain text": 3,
+	})
+}
+
+func TestGitIgnoreDirOnlyPattern(t *testing.T) {
+	repo := t.TempDir()
+	writeTree(t, repo, map[string]string{
+		".git/":          "",
+		".gitignore":     "vendor/\n",
+		"vendor/v.go":    "package v\n",
+		"src/vendor.go":  "package src\n",
+		"src/vendor/":    "",
+		"src/vendor/w.c": "int w;\n",
+	})
+	checkSummary(t, repo, Options{}, map[string]int{"Go": 1})
+}
+
+func TestGitIgnoreOfAncestors(t *testing.T) {
+	// Outside of any git repository, the .gitignore files of the ancestors
+	// of the directory being counted are not taken into account.
+	outer := t.TempDir()
+	writeTree(t, outer, map[string]string{
+		".gitignore":      "*.py\n",
+		"proj/.gitignore": "*.txt\n",
+		"proj/a.py":       "x = 1\n",
+		"proj/b.txt":      "ignored\n",
+	})
+	proj := filepath.Join(outer, "proj")
+	checkSummary(t, proj, Options{}, map[string]int{"Python": 1})
+
+	// Within one, those of the ancestors up to its root are.
+	writeTree(t, outer, map[string]string{".git/": ""})
+	checkSummary(t, proj, Options{}, map[string]int{})
+}
@@ -0,0 +1,75 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import "path/filepath"
+
+// Highlights are notable files and directories of a counted tree, for a quick
+// insight into its shape.
+//
+// LargestFile is the path of the file with the most lines of code (of all
+// languages), and LargestFileLoc its lines of code.
+//
+// DeepestDir is the path of the most deeply nested directory, and
+// DeepestDirDepth the number of directories it is nested in, under the
+// directory of the DirResult the Highlights belong to.
+//
+// Among files (or directories) that tie, the one with the lexicographically
+// smallest path is chosen, so that the Highlights do not depend on the order
+// in which files and directories are counted.
+type Highlights struct {
+	LargestFile     string `json:"largestFile,omitempty" yaml:"largestFile,omitempty"`
+	LargestFileLoc  int    `json:"largestFileLoc,omitempty" yaml:"largestFileLoc,omitempty"`
+	DeepestDir      string `json:"deepestDir,omitempty" yaml:"deepestDir,omitempty"`
+	DeepestDirDepth int    `json:"deepestDirDepth,omitempty" yaml:"deepestDirDepth,omitempty"`
+}
+
+// Accounts for the given file, found in the given directory, in the
+// Highlights.
+func (h *Highlights) addFile(dir string, fr FileResult) {
+	if fr.Minified {
+		return
+	}
+	loc := 0
+	for _, l := range fr.Loc {
+		loc += l
+	}
+	h.considerFile(filepath.Join(dir, fr.Name), loc)
+}
+
+// Replaces the largest file of the Highlights with the given one, if it is
+// larger (or equally large, but first in order).
+func (h *Highlights) considerFile(path string, loc int) {
+	if h.LargestFile == "" || loc > h.LargestFileLoc || loc == h.LargestFileLoc && path < h.LargestFile {
+		h.LargestFile, h.LargestFileLoc = path, loc
+	}
+}
+
+// Merges the Highlights of a subdirectory into those of its parent directory.
+func (h *Highlights) mergeSubdir(sub *Highlights) {
+	if sub == nil {
+		return
+	}
+	if sub.LargestFile != "" {
+		h.considerFile(sub.LargestFile, sub.LargestFileLoc)
+	}
+	if sub.DeepestDir == "" {
+		return
+	}
+	depth := sub.DeepestDirDepth + 1
+	if h.DeepestDir == "" || depth > h.DeepestDirDepth || depth == h.DeepestDirDepth && sub.DeepestDir < h.DeepestDir {
+		h.DeepestDir, h.DeepestDirDepth = sub.DeepestDir, depth
+	}
+}
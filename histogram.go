@@ -0,0 +1,75 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+// HistogramBuckets are the labels of the buckets of a Histogram, i.e. the
+// ranges of lines of code per file, in ascending order.
+var HistogramBuckets = []string{"0-10", "11-50", "51-200", "201-1000", "1001+"}
+
+// The (inclusive) upper bounds of all buckets of HistogramBuckets but the last.
+var histogramBounds = []int{10, 50, 200, 1000}
+
+// Histogram represents the distribution of the sizes of files, per language. It
+// maps the name of each language to the number of files (of that language)
+// that fall in each bucket of HistogramBuckets, according to their lines of
+// code. A file that contains lines of code of more than one language (e.g. a
+// Markdown file with fenced code blocks, if Options.CountMarkdownFences is
+// set) is accounted for once per language, according to its lines of code in
+// that language.
+type Histogram map[string][]int
+
+// Accounts for the given file in the Histogram.
+func (h Histogram) addFile(fr FileResult) {
+	for lang, loc := range fr.Loc {
+		bucket := len(histogramBounds)
+		for i, bound := range histogramBounds {
+			if loc <= bound {
+				bucket = i
+				break
+			}
+		}
+		h.buckets(lang)[bucket]++
+	}
+}
+
+// Adds the files of each language in other to those in the Histogram.
+func (h Histogram) merge(other Histogram) {
+	for lang, counts := range other {
+		buckets := h.buckets(lang)
+		for i, count := range counts {
+			buckets[i] += count
+		}
+	}
+}
+
+// Returns the buckets of the given language, allocating them if needed.
+func (h Histogram) buckets(lang string) []int {
+	if h[lang] == nil {
+		h[lang] = make([]int, len(HistogramBuckets))
+	}
+	return h[lang]
+}
+
+// Total returns the number of files in each bucket of HistogramBuckets,
+// across all languages.
+func (h Histogram) Total() []int {
+	total := make([]int, len(HistogramBuckets))
+	for _, counts := range h {
+		for i, count := range counts {
+			total[i] += count
+		}
+	}
+	return total
+}
@@ -0,0 +1,105 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Matches the opening <script> or <style> tag at the beginning of a line of an
+// HTML file (after any leading whitespace), capturing the tag's name and its
+// attributes.
+var htmlEmbeddingTag = regexp.MustCompile(`(?i)^\s*<(script|style)(\s[^>]*)?>`)
+
+// Matches the type attribute of a tag, capturing its value.
+var htmlTypeAttribute = regexp.MustCompile(`(?i)\btype\s*=\s*["']?([^"'\s>]*)`)
+
+// Reports whether a <script> tag with the given attributes contains Javascript,
+// i.e. declares no type, or a type of Javascript.
+func isJavascriptScript(attributes string) bool {
+	m := htmlTypeAttribute.FindStringSubmatch(attributes)
+	if m == nil {
+		return true
+	}
+	switch strings.ToLower(m[1]) {
+	case "", "module", "text/javascript", "application/javascript", "text/ecmascript", "application/ecmascript":
+		return true
+	}
+	return false
+}
+
+// Counts the lines of an HTML file read from r, attributing the lines inside
+// <script> and <style> elements to Javascript and CSS respectively, and the
+// rest of them (including the opening and closing tags) to HTML. Elements
+// opened and closed in the same line, and scripts whose type attribute
+// declares non-Javascript content (e.g. "text/template"), are counted as HTML.
+func (t *traversal) countHTML(r io.Reader, filename, baseName string) (FileResult, error) {
+	html := languagesByName["HTML"]
+	result := FileResult{Name: baseName, Loc: make(map[string]int)}
+	segment := &fileSegment{lang: html}
+	closingTag := ""
+
+	flush := func() error {
+		fr, err := t.newLocCounter(strings.NewReader(segment.lines.String()), filename, segment.lang).fileResult(baseName)
+		result.add(fr)
+		return err
+	}
+
+	fsc := newLineScanner(newTextReader(r, t.opts.FallbackEncoding), &t.opts)
+	lines := 0
+	for fsc.Scan() {
+		lines++
+		line := fsc.Text()
+		switch {
+		case closingTag == "":
+			segment.lines.WriteString(line + "\n")
+			m := htmlEmbeddingTag.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			tag := strings.ToLower(m[1])
+			if strings.Contains(strings.ToLower(line[len(m[0]):]), "</"+tag) {
+				continue
+			}
+			lang := languagesByName["CSS"]
+			if tag == "script" {
+				if !isJavascriptScript(m[2]) {
+					continue
+				}
+				lang = languagesByName["Javascript"]
+			}
+			if err := flush(); err != nil {
+				return result, err
+			}
+			segment = &fileSegment{lang: lang}
+			closingTag = "</" + tag
+		case strings.Contains(strings.ToLower(line), closingTag):
+			closingTag = ""
+			if err := flush(); err != nil {
+				return result, err
+			}
+			segment = &fileSegment{lang: html}
+			segment.lines.WriteString(line + "\n")
+		default:
+			segment.lines.WriteString(line + "\n")
+		}
+	}
+	if err := lineScannerErr(fsc, lines, &t.opts); err != nil {
+		return result, err
+	}
+	return result, flush()
+}
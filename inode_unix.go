@@ -0,0 +1,34 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package glocc
+
+import (
+	"os"
+	"syscall"
+)
+
+// Returns the identity of the file described by the given FileInfo, i.e. its
+// device and inode numbers, if it is known to have other hard links (so that
+// the vast majority of files is never tracked), and false otherwise.
+func hardLinkIDOf(fileinfo os.FileInfo) (fileID, bool) {
+	st, ok := fileinfo.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink < 2 {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
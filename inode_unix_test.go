@@ -0,0 +1,40 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package glocc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDedupHardLinks(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{"x.c": "int x;\n"})
+	// "x.bak", which is not counted, is visited first when counting
+	// sequentially; it must not make the other links be skipped.
+	for _, link := range []string{"x.bak", "y.c"} {
+		if err := os.Link(filepath.Join(root, "x.c"), filepath.Join(root, link)); err != nil {
+			t.Skipf("Cannot create hard links: %v", err)
+		}
+	}
+	checkSummary(t, root, Options{Sequential: true}, map[string]int{"C": 2})
+	checkSummary(t, root, Options{Sequential: true, DedupHardLinks: true}, map[string]int{"C": 1})
+	checkSummary(t, root, Options{DedupHardLinks: true}, map[string]int{"C": 1})
+	checkSummary(t, root, Options{Sequential: true, DedupHardLinks: true, SkipFilePatterns: []string{"x.c"}}, map[string]int{"C": 1})
+}
@@ -14,6 +14,12 @@
 
 package glocc
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
 // A struct to store all the basic information needed to support counting the
 // lines of code for a programming language, hardcoded.
 type language struct {
@@ -23,6 +29,89 @@ type language struct {
 	inlineCommentTokens            []string
 	multiLineCommentStartingTokens []string
 	multiLineCommentEndingTokens   []string
+
+	// Tokens that, alone on a line, mark the end of the code; the rest of
+	// the file is data, and is not counted (e.g. Perl's __END__).
+	endOfCodeTokens []string
+
+	// For languages with a fixed format (e.g. COBOL), the (1-based) column
+	// of the indicator area, and the indicators that, when found in it,
+	// mark the whole line as a comment. Zero if the language has none.
+	commentIndicatorColumn int
+	commentIndicators      string
+
+	// The character that, when it immediately precedes a comment token
+	// (inline, or starting or ending a block comment), makes it a literal
+	// rather than a token (e.g. TeX's `\%`, or the shell's `\#`); the
+	// character itself may be escaped too. Zero if the language has none.
+	escapeChar byte
+
+	// The character that, when it ends a line (and is not escaped itself),
+	// continues it on the next one, e.g. the backslash of C macros or of
+	// shell commands. The lines are joined (without the character) before
+	// being processed, so that a logical line that spans many physical
+	// ones is classified as a whole, while each of them is still counted
+	// (e.g. a macro defined across three lines is three lines of code).
+	// Zero if the language has none.
+	lineContinuationChar byte
+
+	// Whether a line that ends in an inline comment is continued by the
+	// lineContinuationChar too, so that the comment spans the next line as
+	// well (e.g. a `//` comment followed by a backslash in C); otherwise
+	// (e.g. a `#` comment in the shell), the comment ends the line.
+	continuedComments bool
+
+	// The delimiters of string (and character) literals, within which
+	// comment tokens are not looked for, so that e.g. `"// not a comment"`
+	// is code. Each literal is closed by its opening delimiter, unless it is
+	// escaped by a backslash, or, for raw string literals (e.g. Go's `...`
+	// or single-quoted shell strings), closed by the first occurrence of it.
+	// Literals are only looked for up to the first comment token of a line,
+	// and those left open at the end of a line are considered to end with it,
+	// since the state of a LocCounter does not span literals across lines;
+	// thus the tokens that start multi-line strings (e.g. Python's `"""`)
+	// should rather be block comment tokens, if anything.
+	stringDelimiters    []string
+	rawStringDelimiters []string
+
+	// Whether block comment tokens only start and end block comments at the
+	// very beginning of a line, without any leading whitespace (e.g. Ruby's
+	// `=begin` and `=end`, or Perl's POD); the rest of the line that ends a
+	// block comment is commented out too.
+	lineStartComments bool
+
+	// Whether block comments nest (e.g. in Dart), so that each starting
+	// token must be matched by an ending token of its own.
+	nestedComments bool
+
+	// Whether block comments are (also) delimited by long brackets, like
+	// Lua's `--[[` and `]]`, where the ending bracket must be of the same
+	// level (i.e. have the same number of `=`, e.g. `--[==[` and `]==]`)
+	// as the starting one.
+	longBracketComments bool
+
+	// The kind of the language (e.g. data, or documentation); zero for
+	// programming languages.
+	category languageCategory
+}
+
+// The kind of a language, as reported by DirResult.Categories.
+type languageCategory string
+
+const (
+	categoryProgramming   languageCategory = ""
+	categoryMarkup        languageCategory = "Markup"
+	categoryData          languageCategory = "Data"
+	categoryDocumentation languageCategory = "Documentation"
+	categoryConfig        languageCategory = "Config"
+)
+
+// Returns the name of the category, as reported by DirResult.Categories.
+func (c languageCategory) String() string {
+	if c == categoryProgramming {
+		return "Programming"
+	}
+	return string(c)
 }
 
 // A slice of language structs containing all the programming languages
@@ -35,13 +124,33 @@ var allLanguages = []language{
 		multiLineCommentStartingTokens: []string{},
 		multiLineCommentEndingTokens:   []string{},
 	},
+	{
+		name:                           "AsciiDoc",
+		extensions:                     []string{"adoc", "asciidoc"},
+		inlineCommentTokens:            []string{`//`},
+		multiLineCommentStartingTokens: []string{`////`},
+		multiLineCommentEndingTokens:   []string{`////`},
+		category:                       categoryDocumentation,
+	},
 	{
 		name:                           "Assembly",
-		extensions:                     []string{"asm", "s", "S"},
+		extensions:                     []string{"asm", "s"},
 		inlineCommentTokens:            []string{`;`}, // works for NASM, but not for every assembly out there
 		multiLineCommentStartingTokens: []string{},
 		multiLineCommentEndingTokens:   []string{},
 	},
+	{
+		// Assembly that is run through the C preprocessor (e.g. by GCC) before
+		// being assembled, so C comments are stripped too; unlike ".s", which
+		// is raw assembly. As their extensions only differ in case, they are
+		// counted as plain assembly if Options.CaseInsensitiveExtensions is
+		// set (like ".C" files are counted as C rather than C++ then).
+		name:                           "Assembly (preprocessed)",
+		extensions:                     []string{"S"},
+		inlineCommentTokens:            []string{`;`, `//`},
+		multiLineCommentStartingTokens: []string{`/*`},
+		multiLineCommentEndingTokens:   []string{`*/`},
+	},
 	{
 		name:                           "AWK",
 		extensions:                     []string{"awk"},
@@ -49,12 +158,26 @@ var allLanguages = []language{
 		multiLineCommentStartingTokens: []string{},
 		multiLineCommentEndingTokens:   []string{},
 	},
+	{
+		// `::` is actually a label that is never jumped to, commonly used as a
+		// comment. `REM` must be followed by a space (as it usually is), so
+		// that it is not confused with e.g. `REMOVE`; being case-insensitive,
+		// only its most common spellings are recognized.
+		name:                           "Batch",
+		extensions:                     []string{"bat", "cmd"},
+		inlineCommentTokens:            []string{`REM `, `rem `, `Rem `, `@REM `, `@rem `, `::`},
+		multiLineCommentStartingTokens: []string{},
+		multiLineCommentEndingTokens:   []string{},
+	},
 	{
 		name:                           "C",
 		extensions:                     []string{"c", "h"},
 		inlineCommentTokens:            []string{`//`},
 		multiLineCommentStartingTokens: []string{`/*`},
 		multiLineCommentEndingTokens:   []string{`*/`},
+		lineContinuationChar:           '\\',
+		continuedComments:              true,
+		stringDelimiters:               []string{`"`, `'`},
 	},
 	{
 		name:                           "C++",
@@ -62,6 +185,9 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{`//`},
 		multiLineCommentStartingTokens: []string{`/*`},
 		multiLineCommentEndingTokens:   []string{`*/`},
+		lineContinuationChar:           '\\',
+		continuedComments:              true,
+		stringDelimiters:               []string{`"`, `'`},
 	},
 	{
 		name:                           "C#",
@@ -69,6 +195,47 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{`//`, `///`},
 		multiLineCommentStartingTokens: []string{`/*`, `/**`},
 		multiLineCommentEndingTokens:   []string{`*/`},
+		stringDelimiters:               []string{`"`, `'`},
+		rawStringDelimiters:            []string{`@"`},
+	},
+	{
+		name:                           "Clojure",
+		extensions:                     []string{"clj", "cljs", "cljc"},
+		inlineCommentTokens:            []string{`;`, `#_`}, // only best-effort for #_, which discards the next form
+		multiLineCommentStartingTokens: []string{},
+		multiLineCommentEndingTokens:   []string{},
+	},
+	{
+		name:                           "COBOL",
+		extensions:                     []string{"cob", "cbl", "cpy"},
+		inlineCommentTokens:            []string{`*>`},
+		multiLineCommentStartingTokens: []string{},
+		multiLineCommentEndingTokens:   []string{},
+		commentIndicatorColumn:         7, // fixed format
+		commentIndicators:              "*/",
+	},
+	{
+		name:                           "Coq",
+		extensions:                     []string{}, // ".v" is Verilog, unless overridden
+		inlineCommentTokens:            []string{},
+		multiLineCommentStartingTokens: []string{`(*`}, // nesting is not supported
+		multiLineCommentEndingTokens:   []string{`*)`}, // nesting is not supported
+	},
+	{
+		name:                           "CSS",
+		extensions:                     []string{"css"},
+		inlineCommentTokens:            []string{},
+		multiLineCommentStartingTokens: []string{`/*`},
+		multiLineCommentEndingTokens:   []string{`*/`},
+		category:                       categoryMarkup,
+	},
+	{
+		name:                           "CSV",
+		extensions:                     []string{"csv", "tsv"},
+		inlineCommentTokens:            []string{},
+		multiLineCommentStartingTokens: []string{},
+		multiLineCommentEndingTokens:   []string{},
+		category:                       categoryData,
 	},
 	{
 		name:                           "D",
@@ -77,6 +244,15 @@ var allLanguages = []language{
 		multiLineCommentStartingTokens: []string{`/*`, `/+`}, // nesting is supported, missing ddoc comment tokens
 		multiLineCommentEndingTokens:   []string{`*/`, `+/`}, // nesting is supported
 	},
+	{
+		name:                           "Dart",
+		extensions:                     []string{"dart"},
+		inlineCommentTokens:            []string{`//`},
+		multiLineCommentStartingTokens: []string{`/*`},
+		multiLineCommentEndingTokens:   []string{`*/`},
+		nestedComments:                 true,
+		stringDelimiters:               []string{`"`, `'`},
+	},
 	{
 		name:                           "Delphi",
 		extensions:                     []string{"p", "pp", "pas"},
@@ -90,6 +266,7 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{`#`},
 		multiLineCommentStartingTokens: []string{},
 		multiLineCommentEndingTokens:   []string{},
+		category:                       categoryConfig,
 	},
 	{
 		name:                           "Eiffel",
@@ -101,10 +278,18 @@ var allLanguages = []language{
 	{
 		name:                           "Elixir",
 		extensions:                     []string{"ex", "exs"},
-		inlineCommentTokens:            []string{`%`},
+		inlineCommentTokens:            []string{`#`},
 		multiLineCommentStartingTokens: []string{},
 		multiLineCommentEndingTokens:   []string{},
 	},
+	{
+		name:                           "Elm",
+		extensions:                     []string{"elm"},
+		inlineCommentTokens:            []string{`--`},
+		multiLineCommentStartingTokens: []string{`{-`},
+		multiLineCommentEndingTokens:   []string{`-}`},
+		nestedComments:                 true,
+	},
 	{
 		name:                           "Erlang",
 		extensions:                     []string{"erl", "hrl"},
@@ -112,12 +297,30 @@ var allLanguages = []language{
 		multiLineCommentStartingTokens: []string{},
 		multiLineCommentEndingTokens:   []string{},
 	},
+	{
+		name:                           "F#",
+		extensions:                     []string{"fs", "fsi", "fsx"},
+		inlineCommentTokens:            []string{`//`},
+		multiLineCommentStartingTokens: []string{`(*`},
+		multiLineCommentEndingTokens:   []string{`*)`},
+		nestedComments:                 true,
+	},
 	{
 		name:                           "Go",
 		extensions:                     []string{"go"},
 		inlineCommentTokens:            []string{`//`},
 		multiLineCommentStartingTokens: []string{`/*`},
 		multiLineCommentEndingTokens:   []string{`*/`},
+		stringDelimiters:               []string{`"`, `'`},
+		rawStringDelimiters:            []string{"`"},
+	},
+	{
+		name:                           "Go template",
+		extensions:                     []string{"tpl", "tmpl", "gotmpl"},
+		inlineCommentTokens:            []string{},
+		multiLineCommentStartingTokens: []string{`{{/*`, `{{- /*`},
+		multiLineCommentEndingTokens:   []string{`*/}}`, `*/ -}}`},
+		category:                       categoryMarkup,
 	},
 	{
 		name:                           "Haskell",
@@ -126,12 +329,21 @@ var allLanguages = []language{
 		multiLineCommentStartingTokens: []string{`{-`}, // nesting is not supported
 		multiLineCommentEndingTokens:   []string{`-}`}, // nesting is not supported
 	},
+	{
+		name:                           "HCL",
+		extensions:                     []string{"hcl", "tf", "tfvars"}, // including Terraform
+		inlineCommentTokens:            []string{`#`, `//`},
+		multiLineCommentStartingTokens: []string{`/*`},
+		multiLineCommentEndingTokens:   []string{`*/`},
+		category:                       categoryConfig,
+	},
 	{
 		name:                           "HTML",
 		extensions:                     []string{"html", "htm"},
 		inlineCommentTokens:            []string{},
 		multiLineCommentStartingTokens: []string{`<!--`},
 		multiLineCommentEndingTokens:   []string{`-->`},
+		category:                       categoryMarkup,
 	},
 	{
 		name:                           "Java",
@@ -139,6 +351,7 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{`//`},
 		multiLineCommentStartingTokens: []string{`/*`, `/**`},
 		multiLineCommentEndingTokens:   []string{`*/`},
+		stringDelimiters:               []string{`"`, `'`},
 	},
 	{
 		name:                           "Javascript",
@@ -146,6 +359,7 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{`//`},
 		multiLineCommentStartingTokens: []string{`/*`},
 		multiLineCommentEndingTokens:   []string{`*/`},
+		stringDelimiters:               []string{`"`, `'`, "`"},
 	},
 	{
 		name:                           "JSON",
@@ -153,6 +367,23 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{},
 		multiLineCommentStartingTokens: []string{},
 		multiLineCommentEndingTokens:   []string{},
+		category:                       categoryData,
+	},
+	{
+		name:                           "JSON5",
+		extensions:                     []string{"json5"},
+		inlineCommentTokens:            []string{`//`},
+		multiLineCommentStartingTokens: []string{`/*`},
+		multiLineCommentEndingTokens:   []string{`*/`},
+		category:                       categoryData,
+	},
+	{
+		name:                           "JSONC",
+		extensions:                     []string{"jsonc"},
+		inlineCommentTokens:            []string{`//`},
+		multiLineCommentStartingTokens: []string{`/*`},
+		multiLineCommentEndingTokens:   []string{`*/`},
+		category:                       categoryData,
 	},
 	{
 		name:                           "Kotlin",
@@ -160,6 +391,8 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{`//`},
 		multiLineCommentStartingTokens: []string{`/*`},
 		multiLineCommentEndingTokens:   []string{`*/`},
+		stringDelimiters:               []string{`"`, `'`},
+		rawStringDelimiters:            []string{`"""`},
 	},
 	{
 		name:                           "Lisp",
@@ -168,12 +401,22 @@ var allLanguages = []language{
 		multiLineCommentStartingTokens: []string{`#|`},
 		multiLineCommentEndingTokens:   []string{`|#`},
 	},
+	{
+		name:                           "Lua",
+		extensions:                     []string{"lua"},
+		inlineCommentTokens:            []string{`--`},
+		multiLineCommentStartingTokens: []string{},
+		multiLineCommentEndingTokens:   []string{},
+		longBracketComments:            true,
+	},
 	{
 		name:                           "Makefile",
-		extensions:                     []string{"Makefile"},
+		extensions:                     []string{"Makefile", "mk", "mak"}, // including NMAKE makefiles
 		inlineCommentTokens:            []string{`#`},
 		multiLineCommentStartingTokens: []string{},
 		multiLineCommentEndingTokens:   []string{},
+		escapeChar:                     '\\',
+		lineContinuationChar:           '\\',
 	},
 	{
 		name:                           "Markdown",
@@ -181,6 +424,7 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{},
 		multiLineCommentStartingTokens: []string{},
 		multiLineCommentEndingTokens:   []string{},
+		category:                       categoryDocumentation,
 	},
 	{
 		name:                           "Matlab",
@@ -200,8 +444,10 @@ var allLanguages = []language{
 		name:                           "Perl",
 		extensions:                     []string{"pl", "pm", "t", "pod"},
 		inlineCommentTokens:            []string{`#`},
-		multiLineCommentStartingTokens: []string{`=begin`}, // __END__ is not supported
+		multiLineCommentStartingTokens: []string{`=begin`},
 		multiLineCommentEndingTokens:   []string{`=cut`},
+		lineStartComments:              true,
+		endOfCodeTokens:                []string{`__END__`, `__DATA__`},
 	},
 	{
 		name:                           "PHP",
@@ -209,13 +455,15 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{`#`, `//`},
 		multiLineCommentStartingTokens: []string{`/*`, `/**`},
 		multiLineCommentEndingTokens:   []string{`*/`},
+		stringDelimiters:               []string{`"`, `'`},
 	},
 	{
 		name:                           "PowerShell",
-		extensions:                     []string{"ps1"},
+		extensions:                     []string{"ps1", "psm1", "psd1"}, // including modules and manifests
 		inlineCommentTokens:            []string{`#`},
 		multiLineCommentStartingTokens: []string{`<#`},
 		multiLineCommentEndingTokens:   []string{`#>`},
+		escapeChar:                     '`',
 	},
 	{
 		name:                           "Protocol Buffers",
@@ -223,6 +471,7 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{`//`},
 		multiLineCommentStartingTokens: []string{`/*`},
 		multiLineCommentEndingTokens:   []string{`*/`},
+		category:                       categoryData,
 	},
 	{
 		name:                           "Python",
@@ -230,6 +479,7 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{`#`},
 		multiLineCommentStartingTokens: []string{`"""`, `'''`}, // nesting is supported
 		multiLineCommentEndingTokens:   []string{`"""`, `'''`}, // nesting is supported
+		stringDelimiters:               []string{`"`, `'`},
 	},
 	{
 		name:                           "R",
@@ -238,12 +488,23 @@ var allLanguages = []language{
 		multiLineCommentStartingTokens: []string{},
 		multiLineCommentEndingTokens:   []string{},
 	},
+	{
+		name:                           "reStructuredText",
+		extensions:                     []string{"rst"},
+		inlineCommentTokens:            []string{},
+		multiLineCommentStartingTokens: []string{},
+		multiLineCommentEndingTokens:   []string{},
+		category:                       categoryDocumentation,
+	},
 	{
 		name:                           "Ruby",
 		extensions:                     []string{"rb"},
 		inlineCommentTokens:            []string{`#`},
-		multiLineCommentStartingTokens: []string{`=begin`}, // __END__ is not supported
+		multiLineCommentStartingTokens: []string{`=begin`},
 		multiLineCommentEndingTokens:   []string{`=end`},
+		lineStartComments:              true,
+		endOfCodeTokens:                []string{`__END__`}, // __DATA__ is Perl only
+		stringDelimiters:               []string{`"`, `'`},
 	},
 	{
 		name:                           "Rust",
@@ -251,6 +512,7 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{`//`, `///`, `//!`},
 		multiLineCommentStartingTokens: []string{`/*`, `/**`, `/*!`},
 		multiLineCommentEndingTokens:   []string{`*/`},
+		stringDelimiters:               []string{`"`},
 	},
 	{
 		name:                           "Scala",
@@ -258,6 +520,8 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{`//`},
 		multiLineCommentStartingTokens: []string{`/*`},
 		multiLineCommentEndingTokens:   []string{`*/`},
+		stringDelimiters:               []string{`"`, `'`},
+		rawStringDelimiters:            []string{`"""`},
 	},
 	{
 		name:                           "Scheme",
@@ -272,6 +536,10 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{`#`},
 		multiLineCommentStartingTokens: []string{},
 		multiLineCommentEndingTokens:   []string{},
+		escapeChar:                     '\\',
+		lineContinuationChar:           '\\',
+		stringDelimiters:               []string{`"`},
+		rawStringDelimiters:            []string{`'`},
 	},
 	{
 		name:                           "SQL",
@@ -279,6 +547,7 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{`--`},
 		multiLineCommentStartingTokens: []string{},
 		multiLineCommentEndingTokens:   []string{},
+		rawStringDelimiters:            []string{`'`},
 	},
 	{
 		name:                           "Standard ML",
@@ -287,12 +556,21 @@ var allLanguages = []language{
 		multiLineCommentStartingTokens: []string{`(*`},
 		multiLineCommentEndingTokens:   []string{`*)`},
 	},
+	{
+		name:                           "SystemVerilog",
+		extensions:                     []string{"sv", "svh"},
+		inlineCommentTokens:            []string{`//`},
+		multiLineCommentStartingTokens: []string{`/*`},
+		multiLineCommentEndingTokens:   []string{`*/`},
+	},
 	{
 		name:                           "TeX",
 		extensions:                     []string{"tex"},
 		inlineCommentTokens:            []string{`%`},
-		multiLineCommentStartingTokens: []string{},
-		multiLineCommentEndingTokens:   []string{},
+		multiLineCommentStartingTokens: []string{`\begin{comment}`}, // the environment of the comment package
+		multiLineCommentEndingTokens:   []string{`\end{comment}`},
+		escapeChar:                     '\\',
+		category:                       categoryMarkup,
 	},
 	{
 		name:                           "plain text",
@@ -300,6 +578,7 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{},
 		multiLineCommentStartingTokens: []string{},
 		multiLineCommentEndingTokens:   []string{},
+		category:                       categoryDocumentation,
 	},
 	{
 		name:                           "Tcl",
@@ -307,6 +586,45 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{`#`},
 		multiLineCommentStartingTokens: []string{},
 		multiLineCommentEndingTokens:   []string{},
+		escapeChar:                     '\\',
+	},
+	{
+		name:                           "Verilog",
+		extensions:                     []string{"v", "vh"}, // ".v" is also used by Coq
+		inlineCommentTokens:            []string{`//`},
+		multiLineCommentStartingTokens: []string{`/*`},
+		multiLineCommentEndingTokens:   []string{`*/`},
+	},
+	{
+		name:                           "VHDL",
+		extensions:                     []string{"vhd", "vhdl"},
+		inlineCommentTokens:            []string{`--`},
+		multiLineCommentStartingTokens: []string{`/*`}, // since VHDL-2008
+		multiLineCommentEndingTokens:   []string{`*/`}, // since VHDL-2008
+	},
+	{
+		name:                           "Xcode config",
+		extensions:                     []string{"xcconfig"},
+		inlineCommentTokens:            []string{`//`},
+		multiLineCommentStartingTokens: []string{},
+		multiLineCommentEndingTokens:   []string{},
+		category:                       categoryConfig,
+	},
+	{
+		name:                           "Xcode project",
+		extensions:                     []string{"pbxproj"}, // old-style (ASCII) property list
+		inlineCommentTokens:            []string{`//`},
+		multiLineCommentStartingTokens: []string{`/*`},
+		multiLineCommentEndingTokens:   []string{`*/`},
+		category:                       categoryData,
+	},
+	{
+		name:                           "XML",
+		extensions:                     []string{"xml", "xsd", "xsl", "xslt", "plist"}, // XML property lists
+		inlineCommentTokens:            []string{},
+		multiLineCommentStartingTokens: []string{`<!--`},
+		multiLineCommentEndingTokens:   []string{`-->`},
+		category:                       categoryData,
 	},
 	{
 		name:                           "YAML",
@@ -314,17 +632,129 @@ var allLanguages = []language{
 		inlineCommentTokens:            []string{`#`},
 		multiLineCommentStartingTokens: []string{},
 		multiLineCommentEndingTokens:   []string{},
+		category:                       categoryConfig,
 	},
 }
 
 // Map file extensions to language structs, for fast looking up.
 var languages = map[string]language{}
 
+// Map language names to language structs, for looking up the languages that
+// extensions are explicitly overridden to.
+var languagesByName = map[string]language{}
+
+// Map lowercased file extensions to language structs, for looking up when the
+// case of the extensions is ignored and they are not registered as they are.
+// Extensions which are registered in lowercase take precedence over their
+// uppercase variants (e.g. "c" over "C").
+var languagesFolded = map[string]language{}
+
 func init() {
-	// Populate global var languages.
+	// Populate global vars languages, languagesByName and languagesFolded.
 	for _, lang := range allLanguages {
+		languagesByName[lang.name] = lang
 		for _, ext := range lang.extensions {
 			languages[ext] = lang
+
+			folded := strings.ToLower(ext)
+			if _, exists := languagesFolded[folded]; !exists || ext == folded {
+				languagesFolded[folded] = lang
+			}
+		}
+	}
+}
+
+// Returns the language that is associated with the given extension, and
+// whether such a language was found at all. If the case of the extension is
+// ignored, an extension registered exactly as given still takes precedence
+// (e.g. "S" is preprocessed Assembly, although "s" is Assembly).
+func lookupLanguage(ext string, ignoreCase bool) (language, bool) {
+	if lang, found := languages[ext]; found || !ignoreCase {
+		return lang, found
+	}
+	lang, found := languagesFolded[strings.ToLower(ext)]
+	return lang, found
+}
+
+// Returns the language that is referred to by the given alias, which may be
+// either one of its extensions or its name, ignoring case (e.g. "py" and
+// "python" both refer to Python), and whether such a language was found at
+// all.
+func languageByAlias(alias string) (language, bool) {
+	if lang, found := lookupLanguage(alias, true); found {
+		return lang, true
+	}
+	for _, lang := range allLanguages {
+		if strings.EqualFold(lang.name, alias) {
+			return lang, true
+		}
+	}
+	return language{}, false
+}
+
+// Returns an error if any of the given overrides maps an extension to a
+// language name that is neither supported nor among the given custom
+// languages. The overrides are checked in the order of their extensions, for
+// the error returned to be the same on every call.
+func validateOverrides(overrides map[string]string, custom []Language) error {
+	exts := make([]string, 0, len(overrides))
+	for ext := range overrides {
+		exts = append(exts, ext)
+	}
+	sort.Strings(exts)
+	for _, ext := range exts {
+		if name := overrides[ext]; !languageExists(name, custom) {
+			return fmt.Errorf("Cannot override extension %q to unsupported language %q.", ext, name)
 		}
 	}
+	return nil
+}
+
+// Reports whether a language with the given name is either supported or among
+// the given custom languages.
+func languageExists(name string, custom []Language) bool {
+	if _, found := languagesByName[name]; found {
+		return true
+	}
+	for _, lang := range custom {
+		if lang.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Language describes a language to be counted, in addition to (or instead of)
+// the supported ones, as configured by Options.CustomLanguages. Its lines are
+// counted using the same rules as those of the supported languages, i.e.
+// according to its comment tokens.
+type Language struct {
+	// Name is the name of the language, as reported in the results.
+	Name string `json:"name"`
+
+	// Extensions are the extensions (without the leading dot) of the
+	// files that are written in the language.
+	Extensions []string `json:"extensions"`
+
+	// InlineCommentTokens are the tokens that start comments that extend
+	// to the end of the line (e.g. "//").
+	InlineCommentTokens []string `json:"inlineCommentTokens,omitempty"`
+
+	// BlockCommentStartingTokens and BlockCommentEndingTokens are the
+	// tokens that start and end block comments (e.g. "/*" and "*/"). A
+	// starting token is closed by its reverse, if that is an ending token,
+	// or else by any of the ending tokens.
+	BlockCommentStartingTokens []string `json:"blockCommentStartingTokens,omitempty"`
+	BlockCommentEndingTokens   []string `json:"blockCommentEndingTokens,omitempty"`
+}
+
+// Returns the language struct used to count the lines of the Language.
+func (l Language) language() language {
+	return language{
+		name:                           l.Name,
+		extensions:                     l.Extensions,
+		inlineCommentTokens:            l.InlineCommentTokens,
+		multiLineCommentStartingTokens: l.BlockCommentStartingTokens,
+		multiLineCommentEndingTokens:   l.BlockCommentEndingTokens,
+	}
 }
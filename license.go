@@ -0,0 +1,115 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"io"
+	"strings"
+)
+
+// The (uppercase) names of the files, at the top level of the directory being
+// counted, that are looked for to detect its license (see
+// Options.DetectLicense), in order of preference.
+var licenseFileNames = []string{
+	"LICENSE", "LICENSE.MD", "LICENSE.TXT",
+	"LICENCE", "LICENCE.MD", "LICENCE.TXT",
+	"COPYING", "COPYING.MD", "COPYING.TXT",
+}
+
+// The number of bytes read from the beginning of a license file to identify it.
+const licensePeekLen = 8192
+
+// A signature of a license, matched against the beginning of a license file,
+// uppercased and with its whitespace collapsed; it matches if all of its
+// phrases are found, and none of its exclusions.
+type licenseSignature struct {
+	id         string
+	phrases    []string
+	exclusions []string
+}
+
+// The signatures of the licenses that can be identified, by their SPDX
+// identifiers; the first one that matches is chosen, so licenses that mention
+// others (e.g. the LGPL, which refers to the GPL) precede them.
+var licenseSignatures = []licenseSignature{
+	{id: "Apache-2.0", phrases: []string{"APACHE LICENSE", "VERSION 2.0"}},
+	{id: "MIT", phrases: []string{"PERMISSION IS HEREBY GRANTED, FREE OF CHARGE"}},
+	{id: "MPL-2.0", phrases: []string{"MOZILLA PUBLIC LICENSE", "2.0"}}, // which mentions the GNU licenses
+	{id: "AGPL-3.0", phrases: []string{"GNU AFFERO GENERAL PUBLIC LICENSE", "VERSION 3"}},
+	{id: "LGPL-3.0", phrases: []string{"GNU LESSER GENERAL PUBLIC LICENSE", "VERSION 3"}},
+	{id: "LGPL-2.1", phrases: []string{"GNU LESSER GENERAL PUBLIC LICENSE", "VERSION 2.1"}},
+	{id: "GPL-3.0", phrases: []string{"GNU GENERAL PUBLIC LICENSE", "VERSION 3"}},
+	{id: "GPL-2.0", phrases: []string{"GNU GENERAL PUBLIC LICENSE", "VERSION 2"}},
+	{id: "BSD-3-Clause", phrases: []string{"REDISTRIBUTION AND USE IN SOURCE AND BINARY FORMS", "NEITHER THE NAME"}},
+	{id: "BSD-2-Clause", phrases: []string{"REDISTRIBUTION AND USE IN SOURCE AND BINARY FORMS"}, exclusions: []string{"NEITHER THE NAME"}},
+	{id: "Unlicense", phrases: []string{"THIS IS FREE AND UNENCUMBERED SOFTWARE RELEASED INTO THE PUBLIC DOMAIN"}},
+}
+
+// Returns the SPDX identifier of the license whose text begins with the given
+// content, or an empty string if it cannot be identified.
+func identifyLicense(head []byte) string {
+	text := strings.ToUpper(strings.Join(strings.Fields(string(head)), " "))
+	for _, sig := range licenseSignatures {
+		matched := true
+		for _, phrase := range sig.phrases {
+			matched = matched && strings.Contains(text, phrase)
+		}
+		for _, exclusion := range sig.exclusions {
+			matched = matched && !strings.Contains(text, exclusion)
+		}
+		if matched {
+			return sig.id
+		}
+	}
+	return ""
+}
+
+// Looks for a license file at the top level of the directory with the given
+// path, and records its name and its license (if identified) in the given
+// DirResult of the directory (see Options.DetectLicense).
+func (t *traversal) detectLicense(dirPath string, result *DirResult) {
+	fileinfoz, err := t.readDir(dirPath)
+	if err != nil {
+		return // reported while counting the directory
+	}
+	names := make(map[string]string, len(fileinfoz))
+	for _, fileinfo := range fileinfoz {
+		if fileinfo.Mode().IsRegular() {
+			names[strings.ToUpper(fileinfo.Name())] = fileinfo.Name()
+		}
+	}
+	for _, licenseFileName := range licenseFileNames {
+		name, exists := names[licenseFileName]
+		if !exists {
+			continue
+		}
+		file, err := t.open(t.join(dirPath, name))
+		if err != nil {
+			result.addError(err)
+			return
+		}
+		defer file.Close()
+		head := make([]byte, licensePeekLen)
+		n, err := io.ReadFull(file, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			result.addError(err)
+			return
+		}
+		result.LicenseFile = name
+		result.License = identifyLicense(head[:n])
+		logger.Printf("INFO License of %q: %q, according to %q.\n", dirPath, result.License, name)
+		return
+	}
+}
@@ -17,16 +17,55 @@ package glocc
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strings"
 	"unicode/utf8"
 )
 
+// LineState is the classification of a line by the LocCounter, as passed to
+// Options.CountLineFunc.
+type LineState int
+
+const (
+	// LineCode is a line that contains code, possibly along with comments.
+	LineCode LineState = iota
+	// LineComment is a line that only contains inline comments (or that is
+	// marked as a comment as a whole, in fixed format languages).
+	LineComment
+	// LineBlock is a line that only contains block comments, or parts of
+	// them, possibly along with inline comments.
+	LineBlock
+	// LineBlank is a line that only contains whitespace.
+	LineBlank
+	// LineData is a line that follows an end of code token (e.g. Perl's
+	// __END__), or is such a token itself.
+	LineData
+)
+
+// Returns the name of the LineState, in lowercase (e.g. "code").
+func (s LineState) String() string {
+	switch s {
+	case LineCode:
+		return "code"
+	case LineComment:
+		return "comment"
+	case LineBlock:
+		return "block"
+	case LineBlank:
+		return "blank"
+	case LineData:
+		return "data"
+	}
+	return fmt.Sprintf("LineState(%d)", int(s))
+}
+
 // These states don't need to exist per LocCounter, as they don't carry any
 // LocCounter-specific data.
 var (
 	globalStateInitial = &stateInitial{}
 	globalStateCode    = &stateCode{}
+	globalStateData    = &stateData{}
 )
 
 // LocCounter is the core entity of the package, which initiates and later
@@ -35,63 +74,431 @@ var (
 // goroutine that is assigned to count the file.
 type LocCounter struct {
 	language language
+	opts     *Options
 	loc      int
+	excluded int
 
-	file            *os.File
+	// Only non-nil if duplicate lines of code should be detected.
+	seenLines  *lineSet
+	duplicates int
+
+	blank      int
+	comments   int
+	directives int
+	markers    int
+	// Only non-nil if branches should be counted (see Options.CountBranches).
+	branchKeywords []string
+	branches       int
+	// Whether statements should be counted (see Options.CountStatements).
+	countsStatements bool
+	statements       int
+	// Whether the standard header of generated files was found (only if
+	// Options.SeparateGenerated is set).
+	generated bool
+	// Blank lines that are not counted yet, in case they turn out to be
+	// trailing (only if Options.IgnoreEdgeBlankLines is set).
+	pendingBlank int
+	nonBlankSeen bool
+
+	name   string
+	reader io.Reader
+	// The current line, exactly as read, before any trimming; unlike
+	// currLine, it is never modified while the line is being processed.
+	rawLine string
+	// The part of the current line that remains to be processed by the
+	// states, with its leading whitespace trimmed (see trimLeft).
 	currLine        string
 	currLineCounted bool
-	fileLinesCnt    int
+	// Whether the current line is (even partially) in a block comment.
+	currLineInBlock bool
+	// Whether a comment that contains a marker was found in the current line.
+	currLineMarked bool
+	// The number of physical lines that the current line spans, if it is
+	// continued on the following ones (see continueLine).
+	currLinePhysical int
+	fileLinesCnt     int
 
 	state                 loccState
 	stateMultiLineComment *stateMultiLineComment
+
+	// The first bytes of the string delimiters and comment tokens of the
+	// language, to quickly skip to the next possible string literal, and
+	// the last line masked by codeOfLine, along with the result.
+	literalStarts      string
+	lastLine, lastCode string
+
+	// Only non-nil if the classification of each line should be reported
+	// (see ExplainFile).
+	explain func(LineExplanation)
 }
 
 // NewLocCounter returns a new LocCounter, properly initialized to count the
 // lines of code in a specific file of a specific language.
 // Returns an error if a supported language cannot be detected.
 func NewLocCounter(file *os.File, ext string) (lc *LocCounter, err error) {
-	if lang, valid := languages[ext]; !valid {
+	if lang, valid := lookupLanguage(ext, false); !valid {
 		err = fmt.Errorf("Cannot deduce a supported language from extension %q.", ext)
 	} else {
-		lc = &LocCounter{
-			language: lang,
-			file:     file,
-			state:    globalStateInitial,
-			stateMultiLineComment: &stateMultiLineComment{},
-		}
+		lc = newLocCounter(file, file.Name(), lang, &Options{})
 	}
 	return
 }
 
+// Returns a new LocCounter, properly initialized to count the lines of code in
+// the content read from r, which is already known to be written in the given
+// language, configured by the given Options. The name is only used for
+// logging.
+// The content is decoded to UTF-8 before being counted (see newTextReader).
+func newLocCounter(r io.Reader, name string, lang language, opts *Options) *LocCounter {
+	return &LocCounter{
+		language:              lang,
+		opts:                  opts,
+		name:                  name,
+		reader:                newTextReader(r, opts.FallbackEncoding),
+		state:                 globalStateInitial,
+		stateMultiLineComment: &stateMultiLineComment{},
+		literalStarts:         literalStarts(lang),
+	}
+}
+
+// Returns the first bytes of the string delimiters of the given language, and
+// of its comment tokens (since these end the search for string literals),
+// or an empty string if it has no string delimiters.
+func literalStarts(lang language) string {
+	if len(lang.stringDelimiters) == 0 && len(lang.rawStringDelimiters) == 0 {
+		return ""
+	}
+	var starts strings.Builder
+	for _, tokens := range [][]string{lang.stringDelimiters, lang.rawStringDelimiters, lang.inlineCommentTokens, lang.multiLineCommentStartingTokens} {
+		for _, t := range tokens {
+			if t != "" && strings.IndexByte(starts.String(), t[0]) == -1 {
+				starts.WriteByte(t[0])
+			}
+		}
+	}
+	return starts.String()
+}
+
 // Count is the only exported method of LocCounter. It basically reads (line by
 // line) the content of the file associated with the LocCounter, and performs
 // the counting. It is implemented using the State design pattern.
 func (lc *LocCounter) Count() (int, error) {
-	logger.Printf("DEBUG LocCounter.Count() for file %q: Starting...\n", lc.file.Name())
-	fsc := bufio.NewScanner(lc.file)
+	logger.Printf("DEBUG LocCounter.Count() for file %q: Starting...\n", lc.name)
+	fsc := newLineScanner(lc.reader, lc.opts)
 	for fsc.Scan() {
 		lc.fileLinesCnt++
-		lc.currLine = fsc.Text()
-		lc.currLine = strings.TrimLeft(lc.currLine, " \t") // trim leading whitespace
+		lineNumber := lc.fileLinesCnt
+		lc.rawLine = lc.continueLine(fsc)
+		lc.currLinePhysical = lc.fileLinesCnt - lineNumber + 1
+		lc.currLine = lc.trimLeft(lc.rawLine)
 		lc.currLineCounted = false
-		for !lc.state.process(lc) {
+		lc.currLineInBlock = lc.state == lc.stateMultiLineComment
+		lc.currLineMarked = false
+		trimmedLine, isBlank := lc.currLine, lc.lineIsEmpty()
+		if !lc.generated && lc.lineIsGeneratedHeader() {
+			logger.Printf("DEBUG Generated file header found at %q:%d\n", lc.name, lc.fileLinesCnt)
+			lc.generated = true
+		}
+		// The blank lines of the data after an end of code token are not
+		// counted either.
+		for i := 0; lc.state != globalStateData && i < lc.currLinePhysical; i++ {
+			lc.countBlank(isBlank)
+		}
+		if lc.state != lc.stateMultiLineComment && lc.lineIsEndOfCode() {
+			logger.Printf("DEBUG End of code found at %q:%d\n", lc.name, lc.fileLinesCnt)
+			lc.setState(globalStateData)
 		}
-		if lc.currLineCounted {
-			logger.Printf("DEBUG %q:%d --> Counted\n", lc.file.Name(), lc.fileLinesCnt)
-			lc.loc++
+		if lc.lineIsIndicatedComment() {
+			logger.Printf("DEBUG Comment indicator found at %q:%d\n", lc.name, lc.fileLinesCnt)
+			lc.checkMarkers(lc.rawLine[lc.language.commentIndicatorColumn-1:])
 		} else {
-			logger.Printf("DEBUG %q:%d --> Discarded\n", lc.file.Name(), lc.fileLinesCnt)
+			// A state returns false only after consuming part of the
+			// line or changing the state, so that a single line may go
+			// through any number of transitions; e.g. "*/ code /* more"
+			// closes a comment, is counted, and opens another one.
+			for !lc.state.process(lc) {
+			}
+		}
+		if lc.currLineMarked {
+			logger.Printf("DEBUG %q:%d --> Marker\n", lc.name, lc.fileLinesCnt)
+			lc.markers++
+		}
+		counted := lc.currLineCounted
+		if lc.opts.CountLineFunc != nil {
+			counted = lc.opts.CountLineFunc(trimmedLine, lc.lineState(isBlank))
+		}
+		explanation := LineExplanation{Number: lineNumber, Line: lc.rawLine, State: lc.lineState(isBlank)}
+		if counted && lc.lineIsExcluded(lc.rawLine) {
+			logger.Printf("DEBUG %q:%d --> Excluded\n", lc.name, lc.fileLinesCnt)
+			lc.excluded += lc.currLinePhysical
+			explanation.Excluded = true
+		} else if counted {
+			logger.Printf("DEBUG %q:%d --> Counted\n", lc.name, lc.fileLinesCnt)
+			lc.loc += lc.currLinePhysical
+			if lc.seenLines != nil && !lc.seenLines.add(lc.rawLine) {
+				lc.duplicates++
+			}
+			explanation.Counted = true
+		} else if !isBlank && lc.lineIsDirective(trimmedLine) {
+			logger.Printf("DEBUG %q:%d --> Directive\n", lc.name, lc.fileLinesCnt)
+			lc.directives += lc.currLinePhysical
+			explanation.Directive = true
+		} else {
+			logger.Printf("DEBUG %q:%d --> Discarded\n", lc.name, lc.fileLinesCnt)
+			if state := lc.lineState(isBlank); state == LineComment || state == LineBlock {
+				lc.comments += lc.currLinePhysical
+			}
+		}
+		if lc.explain != nil {
+			lc.explain(explanation)
 		}
 	}
-	if err := fsc.Err(); err != nil {
+	if err := lineScannerErr(fsc, lc.fileLinesCnt, lc.opts); err != nil {
 		logger.Println("ERROR", err)
 		return lc.loc, err
 	}
+	if lc.state == lc.stateMultiLineComment {
+		// All lines up to the end of the content are commented out.
+		logger.Printf("DEBUG Unterminated multi-line comment at the end of %q\n", lc.name)
+	}
 
-	logger.Printf("DEBUG LocCounter.Count() for file %q: Finished.\n", lc.file.Name())
+	logger.Printf("DEBUG LocCounter.Count() for file %q: Finished.\n", lc.name)
 	return lc.loc, nil
 }
 
+// Returns the line just scanned by fsc, joined with as many of the following
+// lines as it is continued on, if the language has a line continuation
+// character; e.g. a C macro defined across several lines is returned as a
+// single line, without the characters that continue it. Unless the language
+// has continuedComments, a line that ends in an inline comment is not
+// continued.
+func (lc *LocCounter) continueLine(fsc *bufio.Scanner) string {
+	cont := lc.language.lineContinuationChar
+	line := fsc.Text()
+	if cont == 0 || !lc.continues(line) {
+		return line
+	}
+	var joined strings.Builder
+	for lc.continues(joined.String() + line) {
+		joined.WriteString(line[:len(line)-1])
+		if !fsc.Scan() {
+			// The last line of the file is continued on nothing.
+			return joined.String()
+		}
+		lc.fileLinesCnt++
+		line = fsc.Text()
+	}
+	joined.WriteString(line)
+	return joined.String()
+}
+
+// Reports whether the given (possibly already joined) line is continued on the
+// next one, i.e. whether it ends with the line continuation character of the
+// language, which is not in an inline comment, unless the language has
+// continuedComments. Block comments are not taken into account.
+func (lc *LocCounter) continues(line string) bool {
+	if !endsWithContinuation(line, lc.language.lineContinuationChar, lc.language.escapeChar) {
+		return false
+	}
+	if lc.language.continuedComments || lc.state == lc.stateMultiLineComment {
+		return true
+	}
+	idx, _ := firstTokenIndex(lc.maskLiterals(line), lc.language.inlineCommentTokens, lc.language.escapeChar, true)
+	return idx == len(line)
+}
+
+// Reports whether the given line ends with the given continuation character,
+// unless that is escaped by the given escape character (e.g. a doubled
+// backslash in the shell).
+func endsWithContinuation(line string, cont, escape byte) bool {
+	n := len(line)
+	return n > 0 && line[n-1] == cont && !isEscaped(line, n-1, escape)
+}
+
+// Performs the counting, and packages its results in a FileResult with the
+// given name. Even if an error occurs, the results counted so far are
+// returned.
+func (lc *LocCounter) fileResult(name string) (FileResult, error) {
+	loc, err := lc.Count()
+	fr := FileResult{
+		Name: name,
+		Loc: map[string]int{
+			lc.language.name: loc,
+		},
+		Blank:      lc.Blank(),
+		Comment:    lc.Comments(),
+		Excluded:   lc.Excluded(),
+		Duplicates: lc.Duplicates(),
+		Directives: lc.Directives(),
+		Lines: LineCounts{
+			lc.language.name: {Code: loc, Comment: lc.Comments(), Blank: lc.Blank()},
+		},
+	}
+	if markers := lc.Markers(); markers > 0 {
+		fr.Markers = map[string]int{lc.language.name: markers}
+	}
+	if branches := lc.Branches(); branches > 0 {
+		fr.Branches = map[string]int{lc.language.name: branches}
+	}
+	if lc.countsStatements {
+		// Even if zero, unlike for languages whose statements are not
+		// counted at all.
+		fr.Statements = map[string]int{lc.language.name: lc.Statements()}
+	}
+	if lc.generated {
+		fr.separateGenerated()
+	}
+	return fr, err
+}
+
+// Accounts for the current line in the count of blank lines, depending on
+// whether it is blank or not. If Options.IgnoreEdgeBlankLines is set, blank
+// lines are only counted once a subsequent non-blank line confirms that they
+// are not trailing, and never if no non-blank line has preceded them.
+func (lc *LocCounter) countBlank(isBlank bool) {
+	switch {
+	case !lc.opts.IgnoreEdgeBlankLines:
+		if isBlank {
+			lc.blank++
+		}
+	case isBlank:
+		if lc.nonBlankSeen {
+			lc.pendingBlank++
+		}
+	default:
+		lc.nonBlankSeen = true
+		lc.blank += lc.pendingBlank
+		lc.pendingBlank = 0
+	}
+}
+
+// Blank returns the number of blank lines (i.e. empty lines, or lines that
+// contain nothing but whitespace). It is only meaningful after Count has
+// returned.
+func (lc *LocCounter) Blank() int {
+	return lc.blank
+}
+
+// Comments returns the number of comment lines (i.e. non-blank lines that were
+// not counted, because they are commented out), excluding those counted as
+// directives. The lines of a block comment that is never closed are comment
+// lines up to the end of the content. It is only meaningful after Count has
+// returned.
+func (lc *LocCounter) Comments() int {
+	return lc.comments
+}
+
+// Excluded returns the number of lines that would have been counted as lines
+// of code, but were excluded because they matched Options.ExcludeLinePattern.
+// It is only meaningful after Count has returned.
+func (lc *LocCounter) Excluded() int {
+	return lc.excluded
+}
+
+// Duplicates returns the number of lines of code that were found to be exact
+// duplicates of lines of code seen elsewhere, if duplicate detection is
+// enabled. It is only meaningful after Count has returned.
+func (lc *LocCounter) Duplicates() int {
+	return lc.duplicates
+}
+
+// Directives returns the number of commented-out lines that were classified as
+// directives, because they matched the pattern in Options.DirectivePatterns
+// for the language of the LocCounter. It is only meaningful after Count has
+// returned.
+func (lc *LocCounter) Directives() int {
+	return lc.directives
+}
+
+// Markers returns the number of comment lines that contain any of the markers
+// in Options.Markers. It is only meaningful after Count has returned.
+func (lc *LocCounter) Markers() int {
+	return lc.markers
+}
+
+// Branches returns the number of occurrences of branching keywords and
+// operators (e.g. `if` or `&&`) in the code, if Options.CountBranches is set.
+// It is only meaningful after Count has returned.
+func (lc *LocCounter) Branches() int {
+	return lc.branches
+}
+
+// Counts the branches in the given code, found in the current line.
+func (lc *LocCounter) countBranches(code string) {
+	if lc.branchKeywords != nil {
+		lc.branches += countBranches(code, lc.branchKeywords)
+	}
+}
+
+// Statements returns the number of statements (i.e. of semicolons) in the
+// code, if Options.CountStatements is set and the language terminates its
+// statements with semicolons. It is only meaningful after Count has returned.
+func (lc *LocCounter) Statements() int {
+	return lc.statements
+}
+
+// Counts the statements in the code of the current line, up to the given
+// index of its part that remains to be processed.
+func (lc *LocCounter) countStatements(end int) {
+	if lc.countsStatements {
+		lc.statements += countStatements(lc.codeOfLine()[:end])
+	}
+}
+
+// Marks the current line if the given comment text, found in it, contains any
+// of the markers in Options.Markers.
+func (lc *LocCounter) checkMarkers(comment string) {
+	if lc.currLineMarked {
+		return
+	}
+	for _, marker := range lc.opts.Markers {
+		if marker != "" && strings.Contains(comment, marker) {
+			lc.currLineMarked = true
+			return
+		}
+	}
+}
+
+// Returns true if the given (commented-out, leading whitespace trimmed) line
+// matches the directive pattern for the language of the LocCounter, if any;
+// false otherwise.
+func (lc *LocCounter) lineIsDirective(line string) bool {
+	pattern := lc.opts.DirectivePatterns[lc.language.name]
+	return pattern != nil && pattern.MatchString(line)
+}
+
+// Returns true if the given line matches the pattern of lines to be excluded
+// from the count, if any; false otherwise.
+func (lc *LocCounter) lineIsExcluded(line string) bool {
+	return lc.opts.ExcludeLinePattern != nil && lc.opts.ExcludeLinePattern.MatchString(line)
+}
+
+// Returns s with its leading whitespace trimmed. It is the only place where
+// whitespace is trimmed, as a separate step of processing each line, so that
+// the states only ever see the (trimmed) part of the line that remains to be
+// processed, while the original line remains available in rawLine.
+func (lc *LocCounter) trimLeft(s string) string {
+	return strings.TrimLeft(s, " \t")
+}
+
+// Returns the leading whitespace of the current line, as read (e.g. for rules
+// of languages where indentation is significant).
+func (lc *LocCounter) indentation() string {
+	return lc.rawLine[:len(lc.rawLine)-len(strings.TrimLeft(lc.rawLine, " \t"))]
+}
+
+// Reports whether the given index of the part of the current line that remains
+// to be processed is the very beginning of the line, as read.
+func (lc *LocCounter) atLineStart(idx int) bool {
+	return len(lc.rawLine)-len(lc.currLine)+idx == 0
+}
+
+// Skips the first n bytes of the part of the current line that remains to be
+// processed, along with any whitespace following them.
+func (lc *LocCounter) advance(n int) {
+	lc.currLine = lc.trimLeft(lc.currLine[n:])
+}
+
 // Change the state of the LocCounter.
 func (lc *LocCounter) setState(state loccState) {
 	lc.state = state
@@ -105,20 +512,199 @@ func (lc *LocCounter) lineIsEmpty() bool {
 	return false
 }
 
-// Returns the index of the first inline comment token that was found in
-// current line, or the length of current line if none was found.
-func (lc *LocCounter) inlineCommentIndex() int {
-	firstInlineCommTokenIdx := len(lc.currLine)
-	for _, t := range lc.language.inlineCommentTokens {
-		ilcIdx := strings.Index(lc.currLine, t)
-		if ilcIdx != -1 && ilcIdx < firstInlineCommTokenIdx {
-			firstInlineCommTokenIdx = ilcIdx
+// Returns true if the current line consists of nothing but an end of code
+// token (at its very beginning); false otherwise.
+func (lc *LocCounter) lineIsEndOfCode() bool {
+	line := strings.TrimRight(lc.rawLine, " \t\r")
+	for _, token := range lc.language.endOfCodeTokens {
+		if line == token {
+			return true
 		}
 	}
+	return false
+}
+
+// Returns true if the current line is marked as a comment by an indicator in
+// the indicator column of its (fixed format) language; false otherwise. The
+// column is that of the line as read, before any whitespace is trimmed.
+func (lc *LocCounter) lineIsIndicatedComment() bool {
+	col := lc.language.commentIndicatorColumn
+	return col > 0 && len(lc.rawLine) >= col && strings.IndexByte(lc.language.commentIndicators, lc.rawLine[col-1]) != -1
+}
+
+// Returns the classification of the current line, once it has been processed,
+// given whether it is blank.
+func (lc *LocCounter) lineState(isBlank bool) LineState {
+	switch {
+	case lc.state == globalStateData:
+		return LineData
+	case isBlank:
+		return LineBlank
+	case lc.currLineCounted:
+		return LineCode
+	case lc.currLineInBlock:
+		return LineBlock
+	default:
+		return LineComment
+	}
+}
+
+// Returns the index of the first inline comment token that was found in
+// current line, along with the token itself, or the length of current line and
+// an empty string if none was found. Among tokens found at the same index, the
+// longest one is returned (e.g. `///` rather than `//`).
+func (lc *LocCounter) inlineCommentIndex() (int, string) {
+	firstInlineCommTokenIdx, firstInlineCommToken := firstTokenIndex(lc.codeOfLine(), lc.language.inlineCommentTokens, lc.language.escapeChar, true)
 	if firstInlineCommTokenIdx < len(lc.currLine) {
-		logger.Printf("DEBUG Inline comment token found at %q:%d\n", lc.file.Name(), lc.fileLinesCnt)
+		logger.Printf("DEBUG Inline comment token found at %q:%d\n", lc.name, lc.fileLinesCnt)
+	}
+	return firstInlineCommTokenIdx, firstInlineCommToken
+}
+
+// Reports whether the multi-line comment starting token found at blockIdx
+// takes precedence over the inline comment token found at inlineIdx (either of
+// which may be missing, i.e. an empty string): either it comes first, or both
+// are at the same index and it is at least as long (e.g. Lua's `--[[` over
+// `--`), so that no token is ever mistaken for a prefix of another.
+func blockCommentFirst(blockIdx int, blockToken string, inlineIdx int, inlineToken string) bool {
+	if blockToken == "" {
+		return false
 	}
-	return firstInlineCommTokenIdx
+	return blockIdx < inlineIdx || blockIdx == inlineIdx && len(blockToken) >= len(inlineToken)
+}
+
+// Returns the index of the first multi-line comment starting token that was
+// found in current line, along with the token itself, or the length of current
+// line and an empty string if none was found. Among tokens found at the same
+// index, the shortest one is returned, so that the rest of any longer one may
+// still close the comment (e.g. `/**/` is opened by `/*` rather than `/**`,
+// and is closed by `*/`). For languages with long bracket comments, the token
+// is the whole long bracket (e.g. `--[==[`).
+func (lc *LocCounter) multiLineCommentIndex() (int, string) {
+	code := lc.codeOfLine()
+	idx, token := firstTokenIndex(code, lc.language.multiLineCommentStartingTokens, lc.language.escapeChar, false)
+	if lc.language.lineStartComments && token != "" && !lc.atLineStart(idx) {
+		return len(lc.currLine), ""
+	}
+	if !lc.language.longBracketComments {
+		return idx, token
+	}
+	for from := 0; from < idx; {
+		i := strings.Index(code[from:idx], "--[")
+		if i == -1 {
+			break
+		}
+		i += from
+		level := len(lc.currLine[i+3:]) - len(strings.TrimLeft(lc.currLine[i+3:], "="))
+		if end := i + 3 + level; end < len(lc.currLine) && lc.currLine[end] == '[' {
+			return i, lc.currLine[i : end+1]
+		}
+		from = i + 1
+	}
+	return idx, token
+}
+
+// Returns the part of the current line that remains to be processed, with the
+// contents of its string literals (see the stringDelimiters of language) up to
+// its first comment token replaced by NUL bytes, so that the comment tokens in
+// them are not found. The indices of the rest of the line are preserved.
+func (lc *LocCounter) codeOfLine() string {
+	line := lc.currLine
+	if lc.literalStarts == "" {
+		return line
+	}
+	if line == lc.lastLine {
+		return lc.lastCode
+	}
+	lc.lastLine, lc.lastCode = line, lc.maskLiterals(line)
+	return lc.lastCode
+}
+
+// Returns the given line, with the contents of its string literals up to its
+// first comment token replaced by NUL bytes, like codeOfLine does for the
+// current line.
+func (lc *LocCounter) maskLiterals(line string) string {
+	if lc.literalStarts == "" {
+		return line
+	}
+	var masked []byte // only allocated if there are any string literals
+	for i := 0; i < len(line); {
+		next := strings.IndexAny(line[i:], lc.literalStarts)
+		if next == -1 {
+			break
+		}
+		if i += next; lc.commentTokenAt(line, i) {
+			break
+		}
+		delim, raw := lc.stringDelimiterAt(line, i)
+		if delim == "" {
+			i++
+			continue
+		}
+		start := i + len(delim)
+		end := stringLiteralEnd(line, start, delim, raw)
+		if masked == nil {
+			masked = []byte(line)
+		}
+		for j := start; j < end; j++ {
+			masked[j] = 0
+		}
+		i = end + len(delim)
+	}
+	if masked == nil {
+		return line
+	}
+	return string(masked)
+}
+
+// Reports whether any (unescaped) comment token, either inline or starting a
+// block comment, begins at the given index of line.
+func (lc *LocCounter) commentTokenAt(line string, idx int) bool {
+	for _, tokens := range [][]string{lc.language.inlineCommentTokens, lc.language.multiLineCommentStartingTokens} {
+		for _, t := range tokens {
+			if t != "" && strings.HasPrefix(line[idx:], t) && !isEscaped(line, idx, lc.language.escapeChar) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the delimiter of the string literal that begins at the given index of
+// line, and whether it is a raw one, or an empty string if none does.
+func (lc *LocCounter) stringDelimiterAt(line string, idx int) (string, bool) {
+	for _, delim := range lc.language.rawStringDelimiters {
+		if strings.HasPrefix(line[idx:], delim) {
+			return delim, true
+		}
+	}
+	for _, delim := range lc.language.stringDelimiters {
+		if strings.HasPrefix(line[idx:], delim) {
+			return delim, false
+		}
+	}
+	return "", false
+}
+
+// Returns the index of the delimiter that closes the string literal whose
+// content begins at the given index of line, skipping over any characters
+// escaped by a backslash unless it is raw, or the length of line if it is not
+// closed in it.
+func stringLiteralEnd(line string, start int, delim string, raw bool) int {
+	if raw {
+		if i := strings.Index(line[start:], delim); i != -1 {
+			return start + i
+		}
+		return len(line)
+	}
+	for i := start; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+		} else if strings.HasPrefix(line[i:], delim) {
+			return i
+		}
+	}
+	return len(line)
 }
 
 // The current state of a LocCounter. It may change from zero to multiple times
@@ -135,32 +721,21 @@ type stateInitial struct{}
 
 // Line processing method for state stateInitial.
 func (s *stateInitial) process(lc *LocCounter) bool {
-	firstInlineCommTokenIdx := lc.inlineCommentIndex()
-	if lc.lineIsEmpty() || firstInlineCommTokenIdx == 0 {
+	firstInlineCommTokenIdx, firstInlineCommToken := lc.inlineCommentIndex()
+	// Find the first occurrence of a multi-line comment starting token, if any.
+	firstMultiLineCommTokenIdx, firstMultiLineCommToken := lc.multiLineCommentIndex()
+	blockFirst := blockCommentFirst(firstMultiLineCommTokenIdx, firstMultiLineCommToken, firstInlineCommTokenIdx, firstInlineCommToken)
+	if lc.lineIsEmpty() || (firstInlineCommTokenIdx == 0 && !blockFirst) {
+		lc.checkMarkers(lc.currLine)
 		return true
 	}
 	// On the first non-empty and non-inline-commented-out line, the state is changing.
-	// Find the first occurrence of a multi-line comment starting token, if any.
-	firstMultiLineCommTokenIdx, firstMultiLineCommToken := len(lc.currLine), ""
-	for _, t := range lc.language.multiLineCommentStartingTokens {
-		mlcIdx := strings.Index(lc.currLine, t)
-		if mlcIdx != -1 && mlcIdx < firstMultiLineCommTokenIdx {
-			firstMultiLineCommTokenIdx = mlcIdx
-			firstMultiLineCommToken = t
-		}
-	}
-	// If a multi-line comment starting token was found before the first inline comment token
-	if firstMultiLineCommTokenIdx < firstInlineCommTokenIdx {
-		logger.Printf("DEBUG Multi-line comment starting at %q:%d\n", lc.file.Name(), lc.fileLinesCnt)
-		// If it wasn't in the beginning of the line
-		if firstMultiLineCommTokenIdx > 0 {
-			lc.currLineCounted = true
-		}
-		// Immediately continue processing the rest of the line in stateMultiLineComment,
-		// as the state may change again within the same line.
-		lc.currLine = strings.TrimLeft(lc.currLine[(firstMultiLineCommTokenIdx+len(firstMultiLineCommToken)):], " \t")
-		lc.stateMultiLineComment.setToken(firstMultiLineCommToken)
-		lc.setState(lc.stateMultiLineComment)
+	// If a multi-line comment starting token takes precedence over the
+	// first inline comment token (see blockCommentFirst)
+	if blockFirst {
+		lc.countBranches(lc.currLine[:firstMultiLineCommTokenIdx])
+		lc.countStatements(firstMultiLineCommTokenIdx)
+		lc.enterMultiLineComment(firstMultiLineCommTokenIdx, firstMultiLineCommToken)
 	} else {
 		// If no multi-line comment starting token was found before the first inline comment token
 		lc.setState(globalStateCode)
@@ -169,6 +744,27 @@ func (s *stateInitial) process(lc *LocCounter) bool {
 	return false
 }
 
+// Hands the rest of the current line, following the multi-line comment starting
+// token found at the given index, over to stateMultiLineComment; it is meant to
+// be called by the other states, which must then return false to continue
+// processing the line immediately, since the comment may also be closed (and
+// even be followed by code, or by more comments) within the same line.
+//
+// Whether the line is counted depends only on what precedes and follows the
+// comment: e.g. neither "/* comment */" nor "/* a */ /* b */" are counted,
+// while both "code /* comment */" and "/* comment */ code" are.
+func (lc *LocCounter) enterMultiLineComment(idx int, token string) {
+	logger.Printf("DEBUG Multi-line comment starting at %q:%d\n", lc.name, lc.fileLinesCnt)
+	// If it wasn't in the beginning of the line
+	if idx > 0 {
+		lc.currLineCounted = true
+	}
+	lc.currLineInBlock = true
+	lc.advance(idx + len(token))
+	lc.stateMultiLineComment.setToken(token)
+	lc.setState(lc.stateMultiLineComment)
+}
+
 // The state of the LocCounter currently processing multi-line commented code.
 type stateMultiLineComment struct {
 	// Needed for Python (or any other language that I may not know of,
@@ -176,6 +772,9 @@ type stateMultiLineComment struct {
 	// `'''` in a `"""` multi-line comment, and of `"""` in a `'''`
 	// multi-line comment.
 	token string
+	// The number of block comments opened, and not closed yet, within the
+	// outermost one (only for languages where block comments nest).
+	depth int
 }
 
 // Line processing method for state stateMultiLineComment.
@@ -192,30 +791,51 @@ func (s *stateMultiLineComment) process(lc *LocCounter) bool {
 			break
 		}
 	}
-	if reversedTokenIsValid {
+	switch {
+	case lc.language.longBracketComments && strings.HasPrefix(s.token, "--["):
+		// The ending long bracket must be of the same level.
+		tokens = append(tokens, "]"+strings.Repeat("=", len(s.token)-len("--[["))+"]")
+	case reversedTokenIsValid:
 		tokens = append(tokens, reversedToken)
-	} else {
+	default:
 		tokens = append(tokens, lc.language.multiLineCommentEndingTokens...)
 	}
 
 	// Find the first occurrence of a multi-line comment ending token, if any
-	firstMultiLineCommTokenIdx, firstMultiLineCommToken := len(lc.currLine), ""
-	for _, t := range tokens {
-		mlcIdx := strings.Index(lc.currLine, t)
-		if mlcIdx != -1 && mlcIdx < firstMultiLineCommTokenIdx {
-			firstMultiLineCommTokenIdx = mlcIdx
-			firstMultiLineCommToken = t
+	firstMultiLineCommTokenIdx, firstMultiLineCommToken := firstTokenIndex(lc.currLine, tokens, lc.language.escapeChar, false)
+	if lc.language.lineStartComments && !lc.atLineStart(firstMultiLineCommTokenIdx) {
+		firstMultiLineCommTokenIdx = len(lc.currLine)
+	}
+	if lc.language.nestedComments {
+		// If a nested multi-line comment starts before the first ending token
+		if nestedIdx, _ := firstTokenIndex(lc.currLine, []string{s.token}, lc.language.escapeChar, false); nestedIdx < firstMultiLineCommTokenIdx {
+			lc.checkMarkers(lc.currLine[:nestedIdx])
+			s.depth++
+			lc.advance(nestedIdx + len(s.token))
+			return false
 		}
 	}
 	// If a multi-line comment ending token was found
 	if firstMultiLineCommTokenIdx < len(lc.currLine) {
-		logger.Printf("DEBUG Multi-line comment ending at %q:%d\n", lc.file.Name(), lc.fileLinesCnt)
+		lc.checkMarkers(lc.currLine[:firstMultiLineCommTokenIdx])
+		if s.depth > 0 {
+			// It closes a nested multi-line comment.
+			s.depth--
+			lc.advance(firstMultiLineCommTokenIdx + len(firstMultiLineCommToken))
+			return false
+		}
+		logger.Printf("DEBUG Multi-line comment ending at %q:%d\n", lc.name, lc.fileLinesCnt)
 		s.token = ""
-		lc.currLine = strings.TrimLeft(lc.currLine[(firstMultiLineCommTokenIdx+len(firstMultiLineCommToken)):], " \t")
+		lc.advance(firstMultiLineCommTokenIdx + len(firstMultiLineCommToken))
 		lc.setState(globalStateCode)
+		if lc.language.lineStartComments {
+			lc.checkMarkers(lc.currLine)
+			return true
+		}
 		return false
 	}
 	// If no multi-line comment ending token was found
+	lc.checkMarkers(lc.currLine)
 	return true
 }
 
@@ -231,37 +851,93 @@ type stateCode struct{}
 
 // Line processing method for state stateCode.
 func (s *stateCode) process(lc *LocCounter) bool {
-	firstInlineCommTokenIdx := lc.inlineCommentIndex()
-	if lc.lineIsEmpty() || firstInlineCommTokenIdx == 0 {
+	firstInlineCommTokenIdx, firstInlineCommToken := lc.inlineCommentIndex()
+	// Find the first occurrence of a multi-line comment starting token, if any.
+	firstMultiLineCommTokenIdx, firstMultiLineCommToken := lc.multiLineCommentIndex()
+	blockFirst := blockCommentFirst(firstMultiLineCommTokenIdx, firstMultiLineCommToken, firstInlineCommTokenIdx, firstInlineCommToken)
+	if lc.lineIsEmpty() || (firstInlineCommTokenIdx == 0 && !blockFirst) {
+		lc.checkMarkers(lc.currLine)
 		return true
 	}
-	// Find the first occurrence of a multi-line comment starting token, if any.
-	firstMultiLineCommTokenIdx, firstMultiLineCommToken := len(lc.currLine), ""
-	for _, t := range lc.language.multiLineCommentStartingTokens {
-		mlcIdx := strings.Index(lc.currLine, t)
-		if mlcIdx != -1 && mlcIdx < firstMultiLineCommTokenIdx {
-			firstMultiLineCommTokenIdx = mlcIdx
-			firstMultiLineCommToken = t
-		}
-	}
-	// If a multi-line comment starting token was found before the first occurrence of an inline comment token
-	if firstMultiLineCommTokenIdx < firstInlineCommTokenIdx {
-		logger.Printf("DEBUG Multi-line comment start found at %q:%d\n", lc.file.Name(), lc.fileLinesCnt)
-		// If it wasn't in the beginning of the line
-		if firstMultiLineCommTokenIdx > 0 {
-			lc.currLineCounted = true
-		}
-		// Immediately continue processing the rest of the line in stateMultiLineComment,
-		// as the state may change again within the same line.
-		lc.currLine = strings.TrimLeft(lc.currLine[(firstMultiLineCommTokenIdx+len(firstMultiLineCommToken)):], " \t")
-		lc.stateMultiLineComment.setToken(firstMultiLineCommToken)
-		lc.setState(lc.stateMultiLineComment)
+	// If a multi-line comment starting token takes precedence over the first
+	// inline comment token (see blockCommentFirst)
+	if blockFirst {
+		lc.countBranches(lc.currLine[:firstMultiLineCommTokenIdx])
+		lc.countStatements(firstMultiLineCommTokenIdx)
+		lc.enterMultiLineComment(firstMultiLineCommTokenIdx, firstMultiLineCommToken)
 		return false
 	}
+	// Anything after an inline comment token is commented out.
+	lc.checkMarkers(lc.currLine[firstInlineCommTokenIdx:])
+	lc.countBranches(lc.currLine[:firstInlineCommTokenIdx])
+	lc.countStatements(firstInlineCommTokenIdx)
 	lc.currLineCounted = true
 	return true
 }
 
+// The terminal state of a LocCounter, after an end of code token has been
+// found; the rest of the content is data, so nothing is ever counted again.
+type stateData struct{}
+
+// Line processing method for state stateData.
+func (s *stateData) process(lc *LocCounter) bool {
+	return true
+}
+
+// Returns the index of the first occurrence of any of the given tokens in
+// line, along with the token itself, or the length of line and an empty string
+// if none of them occurs. Empty tokens are ignored, as they would otherwise
+// match at the beginning of every line, and so are occurrences that are escaped
+// by the given escape character (i.e. preceded by an odd number of them); a
+// zero escape character escapes nothing. Among tokens that occur at the same
+// index, the longest one is returned if longest is true, or the shortest one
+// otherwise, regardless of their order in tokens.
+func firstTokenIndex(line string, tokens []string, escape byte, longest bool) (int, string) {
+	firstIdx, firstToken := len(line), ""
+	for _, t := range tokens {
+		if t == "" {
+			continue
+		}
+		for from := 0; from <= firstIdx && from < len(line); {
+			idx := strings.Index(line[from:], t)
+			if idx == -1 {
+				break
+			}
+			idx += from
+			if !isEscaped(line, idx, escape) {
+				if idx < firstIdx || idx == firstIdx && preferToken(t, firstToken, longest) {
+					firstIdx, firstToken = idx, t
+				}
+				break
+			}
+			from = idx + 1
+		}
+	}
+	return firstIdx, firstToken
+}
+
+// Reports whether token t is preferred over token other, found at the same
+// index, i.e. whether it is longer (or shorter, if longest is false).
+func preferToken(t, other string, longest bool) bool {
+	if longest {
+		return len(t) > len(other)
+	}
+	return len(t) < len(other)
+}
+
+// Reports whether the byte at the given index of line is preceded by an odd
+// number of the given escape character.
+func isEscaped(line string, idx int, escape byte) bool {
+	if escape == 0 {
+		return false
+	}
+	n := 0
+	for i := idx - 1; i >= 0 && line[i] == escape; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
 // Returns the input string reversed.
 func reversed(s string) string {
 	size := len(s)
@@ -0,0 +1,247 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import "testing"
+
+func TestBlockCommentsOnOneLine(t *testing.T) {
+	runLineCountTests(t, []lineCountTest{
+		{"close, code and reopen", "c", "/* a\n*/ int x; /* b\nc */\n", 1, 2, 0},
+		{"close and reopen without code", "c", "/* a\n*/ /* b\n*/\n", 0, 3, 0},
+		{"close, code, open and close", "c", "/* a\n*/ int x; /* b */ int y; /* c\n*/\n", 1, 2, 0},
+		{"many comments around code", "c", "/* a */ int x; /* b */ /* c */ int y; /* d */\n", 1, 0, 0},
+		{"close and reopen, code after", "c", "/* a\n*/ /* b */ int x;\n", 1, 1, 0},
+		{"close, then inline comment", "go", "/* a\n*/ x := 1 // b\n", 1, 1, 0},
+		{"close, code and reopen, in Java", "java", "/** a\n*/ int x; /* b\n*/\n", 1, 2, 0},
+		{"close, code and reopen, in OCaml", "ml", "(* a\n*) let x = 1 (* b\nc *)\n", 1, 2, 0},
+		{"close and reopen, in OCaml", "ml", "(* a\n*) (* b\n*)\n", 0, 3, 0},
+		{"close, code and reopen, in Haskell", "hs", "{- a\n-} x = 1 {- b\n-}\n", 1, 2, 0},
+		{"close, code and reopen, in HTML", "html", "<!-- a\n--> <p> <!-- b\n-->\n", 1, 2, 0},
+		{"close, code and reopen, in Lisp", "lisp", "#| a\n|# (x) #| b\n|#\n", 1, 2, 0},
+		{"close, code and reopen, in Python", "py", "\"\"\" a\n\"\"\" x = 1 \"\"\" b\n\"\"\"\n", 1, 2, 0},
+	})
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	runLineCountTests(t, []lineCountTest{
+		{"C, trailing newline", "c", "int x;\n/* a\nb\n", 1, 2, 0},
+		{"C, no trailing newline", "c", "int x;\n/* a\nb", 1, 2, 0},
+		{"C, opened after code", "c", "int x; /* a\nb\n", 1, 1, 0},
+		{"C, opened after code, no trailing newline", "c", "int x; /* a", 1, 0, 0},
+		{"C, only the opening token", "c", "/*", 0, 1, 0},
+		{"C, blank lines inside", "c", "/* a\n\nb\n\n", 0, 2, 2},
+		{"Python, trailing newline", "py", "x = 1\n\"\"\"\na\n", 1, 2, 0},
+		{"Python, no trailing newline", "py", "x = 1\n\"\"\"\na", 1, 2, 0},
+		{"OCaml, trailing newline", "ml", "let x = 1\n(* a\nb\n", 1, 2, 0},
+		{"OCaml, no trailing newline", "ml", "let x = 1\n(* a\nb", 1, 2, 0},
+		{"HTML, trailing newline", "html", "<p>\n<!-- a\nb\n", 1, 2, 0},
+		{"HTML, no trailing newline", "html", "<p>\n<!-- a\nb", 1, 2, 0},
+		{"Haskell, trailing newline", "hs", "x = 1\n{- a\nb\n", 1, 2, 0},
+		{"Haskell, no trailing newline", "hs", "x = 1\n{- a\nb", 1, 2, 0},
+		{"Lua, no trailing newline", "lua", "x = 1\n--[[ a\nb", 1, 2, 0},
+	})
+}
+
+func TestCommentSyntaxes(t *testing.T) {
+	runLineCountTests(t, []lineCountTest{
+		// Block comments only.
+		{"OCaml", "ml", "(* a *)\nlet x = 1\n(* b\nc *)\n\nlet y = 2 (* d *)\n", 2, 3, 1},
+		{"OCaml, comment closed and code", "ml", "(* a *) let x = 1\n", 1, 0, 0},
+		{"OCaml, no inline comments", "ml", "let x = \"a\" // b\n-- c\n", 2, 0, 0},
+		{"Standard ML", "sml", "(* a *)\nval x = 1\n(* b\nc *)\n", 1, 3, 0},
+		{"Standard ML, comment closed and code", "sml", "(* a *) val x = 1\n", 1, 0, 0},
+		{"CSS", "css", "/* a */\np { }\n", 1, 1, 0},
+		{"HTML", "html", "<!-- a -->\n<p>\n<!-- b\nc -->\n", 1, 3, 0},
+		{"HTML, comment and code on one line", "html", "<!-- a --> <p>\n<p> <!-- b -->\n", 2, 0, 0},
+		{"HTML, no inline comments", "html", "// a\n# b\n", 2, 0, 0},
+		// Inline comments only.
+		{"Ada", "adb", "-- a\nX := 1; -- b\n\n", 1, 1, 1},
+		{"Ada, no block comments", "adb", "/* a\nb */\n", 2, 0, 0},
+		{"Shell", "sh", "# a\necho a # b\n", 1, 1, 0},
+		{"Shell, no block comments", "sh", "/* a\nb */\n", 2, 0, 0},
+		// No comments at all.
+		{"JSON", "json", "{\n\n  \"a\": 1\n}\n", 3, 0, 1},
+		{"JSON, no comment tokens", "json", "// a\n/* b */\n# c\n", 3, 0, 0},
+	})
+}
+
+func TestBlockCommentStates(t *testing.T) {
+	runLineCountTests(t, []lineCountTest{
+		// Entered from the initial state of a line.
+		{"comment alone", "c", "/* a */\n", 0, 1, 0},
+		{"comment, then code", "c", "/* a */ int x;\n", 1, 0, 0},
+		{"comment, then spaces", "c", "  /* a */  \n", 0, 1, 0},
+		{"comment opened alone", "c", "/* a\nb */\nint x;\n", 1, 2, 0},
+		{"comment opened, then code on closing line", "c", "/* a\nb */ int x;\n", 1, 1, 0},
+		// Entered from the code state of a line.
+		{"code, then comment", "c", "int x; /* a */\n", 1, 0, 0},
+		{"code, then comment opened", "c", "int x; /* a\nb */\nint y;\n", 2, 1, 0},
+		{"code, comment and code", "c", "int x; /* a */ int y;\n", 1, 0, 0},
+		{"Haskell, comment, then code", "hs", "{- a -} x = 1\n", 1, 0, 0},
+		{"Haskell, code, then comment opened", "hs", "x = 1 {- a\nb -}\n", 1, 1, 0},
+	})
+}
+
+func TestFirstTokenIndex(t *testing.T) {
+	tests := []struct {
+		line      string
+		tokens    []string
+		escape    byte
+		wantIdx   int
+		wantToken string
+	}{
+		{`a % b`, []string{`%`}, 0, 2, `%`},
+		{`a \% b`, []string{`%`}, 0, 3, `%`},
+		{`a \% b`, []string{`%`}, '\\', 6, ``},
+		{`a \% b % c`, []string{`%`}, '\\', 7, `%`},
+		{`a \\% b`, []string{`%`}, '\\', 4, `%`},
+		{`a \\\% b`, []string{`%`}, '\\', 8, ``},
+		{`\# a`, []string{`#`}, '\\', 4, ``},
+		{"`<# a", []string{`<#`}, '`', 5, ``},
+		{`a /* b`, []string{``, `/*`}, 0, 2, `/*`},
+	}
+	for _, test := range tests {
+		idx, token := firstTokenIndex(test.line, test.tokens, test.escape, true)
+		if idx != test.wantIdx || token != test.wantToken {
+			t.Errorf("firstTokenIndex(%q, %q, %q) = %d, %q; want %d, %q", test.line, test.tokens, test.escape, idx, token, test.wantIdx, test.wantToken)
+		}
+	}
+}
+
+func TestEscapedCommentTokens(t *testing.T) {
+	runLineCountTests(t, []lineCountTest{
+		{"TeX, escaped", "tex", "\\% a\n50\\%\n", 2, 0, 0},
+		{"TeX, escaped escape char", "tex", "\\\\% a\n% b\n", 1, 1, 0},
+		{"TeX, escaped, then comment", "tex", "\\% a % b\n", 1, 0, 0},
+		{"Shell, escaped", "sh", "\\# a\necho \\#\n", 2, 0, 0},
+		{"Shell, in a string", "sh", "\"# a\"\necho \"a # b\"\n", 2, 0, 0},
+		{"Shell, in a raw string", "sh", "'# a'\n", 1, 0, 0},
+		{"Shell, comment", "sh", "# a\n  # b\n", 0, 2, 0},
+		{"Makefile, escaped", "mk", "\\# a\n", 1, 0, 0},
+		{"PowerShell, escaped block comment", "ps1", "`<# a\nb\n", 2, 0, 0},
+		{"PowerShell, escaped end of block comment", "ps1", "<# a\n`#> b\n#>\n", 0, 3, 0},
+		{"C, in a string", "c", "\"/* a\";\nint x;\n", 2, 0, 0},
+	})
+}
+
+func TestDocCommentTokens(t *testing.T) {
+	runLineCountTests(t, []lineCountTest{
+		{"C, empty comment", "c", "/**/\nint x;\n", 1, 1, 0},
+		{"C, empty comment, then code", "c", "/**/ int x;\n", 1, 0, 0},
+		{"Java, empty comment", "java", "/**/\nint x;\n", 1, 1, 0},
+		{"Java, doc comment", "java", "/** a\n * b\n */\nint x;\n", 1, 3, 0},
+		{"Java, doc comment on one line", "java", "/** a */\nint x;\n", 1, 1, 0},
+		{"C#, empty comment", "cs", "/**/\nint x;\n", 1, 1, 0},
+		{"C#, empty comment, then code", "cs", "/**/ int x;\n", 1, 0, 0},
+		{"C#, doc comment", "cs", "/// a\n/// b\nint x; /// c\n", 1, 2, 0},
+		{"C#, block doc comment", "cs", "/** a\n*/\nint x;\n", 1, 2, 0},
+		{"Rust, empty comment", "rs", "/**/\nlet x = 1;\n", 1, 1, 0},
+		{"Rust, doc comments", "rs", "/// a\n//! b\nlet x = 1;\n", 1, 2, 0},
+		{"Rust, inner block doc comment", "rs", "/*! a\nb */\nlet x = 1;\n", 1, 2, 0},
+		{"Rust, inner block doc comment on one line", "rs", "/*! a */ let x = 1;\n", 1, 0, 0},
+		{"Rust, empty inner block doc comment", "rs", "/*!*/\nlet x = 1;\n", 1, 1, 0},
+		{"Rust, outer block doc comment", "rs", "/** a\n*/\nlet x = 1;\n", 1, 2, 0},
+	})
+}
+
+func TestCommentTokensInStrings(t *testing.T) {
+	runLineCountTests(t, []lineCountTest{
+		{"Go", "go", "x := \"// not a comment\"\n", 1, 0, 0},
+		{"Go, block comment token", "go", "x := \"/* not a comment\"\ny := 1\n", 2, 0, 0},
+		{"Go, escaped quote", "go", "x := \"\\\" /* not a comment\"\ny := 1\n", 2, 0, 0},
+		{"Go, raw string", "go", "x := `/* not a comment`\ny := 1\n", 2, 0, 0},
+		{"Go, comment after a string", "go", "x := \"a\" /* b\nc */\n", 1, 1, 0},
+		{"Go, string alone", "go", "\"// not a comment\"\n", 1, 0, 0},
+		{"C", "c", "char *s = \"// not a comment\";\n", 1, 0, 0},
+		{"C, character", "c", "char c = '\"'; /* a\nb */\n", 1, 1, 0},
+		{"C, block comment token", "c", "char *s = \"/* not a comment\";\nint x;\n", 2, 0, 0},
+		{"Javascript", "js", "s = '// not a comment';\n", 1, 0, 0},
+		{"Javascript, template literal", "js", "s = `/* not a comment`;\nx = 1;\n", 2, 0, 0},
+		{"Python", "py", "s = \"# not a comment\"\n", 1, 0, 0},
+		{"Python, docstring token", "py", "s = '\"\"\" not a comment'\nx = 1\n", 2, 0, 0},
+	})
+}
+
+func TestLineStartBlockComments(t *testing.T) {
+	runLineCountTests(t, []lineCountTest{
+		{"Ruby", "rb", "=begin\na\n=end\nx = 1\n", 1, 3, 0},
+		{"Ruby, rest of the lines", "rb", "=begin a\nb\n=end c\nx = 1\n", 1, 3, 0},
+		{"Ruby, indented begin", "rb", "  =begin\nx = 1\n  =end\n", 3, 0, 0},
+		{"Ruby, tab-indented begin", "rb", "\t=begin\nx = 1\n", 2, 0, 0},
+		{"Ruby, begin after code", "rb", "x = 1 =begin\ny = 2\n", 2, 0, 0},
+		{"Ruby, indented end", "rb", "=begin\n  =end\na\n=end\nx = 1\n", 1, 4, 0},
+		{"Perl", "pl", "=begin\na\n=cut\nmy $x = 1;\n", 1, 3, 0},
+		{"Perl, indented begin", "pl", "  =begin\nmy $x = 1;\n  =cut\n", 3, 0, 0},
+		{"Perl, indented cut", "pl", "=begin\n  =cut\na\n=cut\nmy $x = 1;\n", 1, 4, 0},
+		{"Elixir", "ex", "# a\nx = 1 # b\n", 1, 1, 0},
+	})
+}
+
+func TestLineContinuation(t *testing.T) {
+	runLineCountTests(t, []lineCountTest{
+		{"C, macro", "c", "#define X \\\n  1\nint x;\n", 3, 0, 0},
+		{"C, continued comment", "c", "// a \\\nint x;\nint y;\n", 1, 2, 0},
+		{"C, in a block comment", "c", "/* a \\\nb */\nint x;\n", 1, 2, 0},
+		{"C, continued blank line", "c", "\\\n\nint x;\n", 1, 0, 2},
+		{"C, continued at the end", "c", "int x; \\", 1, 0, 0},
+		{"Shell, command", "sh", "echo a \\\n  b\necho c\n", 3, 0, 0},
+		{"Shell, comment", "sh", "# a \\\necho hi\n", 1, 1, 0},
+		{"Shell, code and comment", "sh", "echo a # b \\\necho c\n", 2, 0, 0},
+		{"Shell, comment token in a string", "sh", "echo \"a # b\" \\\n  c\n# d\n", 2, 1, 0},
+		{"Shell, escaped backslash", "sh", "echo a \\\\\n# b\n", 1, 1, 0},
+		{"Makefile, comment", "mk", "# a \\\nall:\n", 1, 1, 0},
+		{"Makefile, recipe", "mk", "all:\n\techo a \\\n\t  b\n", 3, 0, 0},
+	})
+}
+
+func TestEndOfCode(t *testing.T) {
+	runLineCountTests(t, []lineCountTest{
+		{"Perl __END__", "pl", "print 1;\n\n__END__\nsome data\n\n\nmore\n", 1, 0, 1},
+		{"Perl __DATA__", "pl", "print 1;\n__DATA__\n\n# not a comment\n", 1, 0, 0},
+		{"Ruby __END__", "rb", "puts 1\n__END__\n\n", 1, 0, 0},
+		{"Ruby __DATA__ is code", "rb", "puts 1\n__DATA__\nputs 2\n", 3, 0, 0},
+	})
+}
+
+func TestCommentIndicators(t *testing.T) {
+	runLineCountTests(t, []lineCountTest{
+		{"COBOL, asterisk", "cob", "000100* a comment\n000200 IDENTIFICATION DIVISION.\n", 1, 1, 0},
+		{"COBOL, slash", "cob", "000100/ a comment\n000200 PROGRAM-ID. A.\n", 1, 1, 0},
+		{"COBOL, short sequence area", "cob", "      * a\n       DISPLAY 'A'.\n", 1, 1, 0},
+		{"COBOL, indicator in another column", "cob", "       * a\n     / b\n", 2, 0, 0},
+		{"COBOL, inline comment", "cob", "       DISPLAY 'A'. *> a\n       *> b\n", 1, 1, 0},
+		{"COBOL, short line", "cob", "0001\n\n", 1, 0, 1},
+	})
+}
+
+func TestNestedComments(t *testing.T) {
+	runLineCountTests(t, []lineCountTest{
+		{"Dart, nested", "dart", "/* a /* b */ c */\nvar x = 1;\n", 1, 1, 0},
+		{"Dart, nested on several lines", "dart", "/* a\n/* b */\nc */\nvar x = 1;\n", 1, 3, 0},
+		{"Dart, nested, then code", "dart", "/* a /* b */ */ var x = 1;\n", 1, 0, 0},
+		{"Dart, unbalanced", "dart", "/* a /* b */\nvar x = 1;\n", 0, 2, 0},
+		{"C, not nested", "c", "/* a /* b */\nint x;\n", 1, 1, 0},
+	})
+}
+
+func TestLongBracketComments(t *testing.T) {
+	runLineCountTests(t, []lineCountTest{
+		{"Lua, level 0", "lua", "--[[ a\nb ]]\nx = 1\n", 1, 2, 0},
+		{"Lua, level 2", "lua", "--[==[ a\nb ]==]\nx = 1\n", 1, 2, 0},
+		{"Lua, other level inside", "lua", "--[==[ a ]]\nb ]=] c\n]==] x = 1\n", 1, 2, 0},
+		{"Lua, level 2, then code", "lua", "--[==[ a ]] ]==] x = 1\n", 1, 0, 0},
+		{"Lua, inline comment", "lua", "-- [[ a\nx = 1\n", 1, 1, 0},
+	})
+}
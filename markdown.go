@@ -0,0 +1,95 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"io"
+	"strings"
+)
+
+// A contiguous part of a file that embeds code of other languages: e.g. of a
+// Markdown file, either prose (including the fences themselves), or the
+// content of a fenced code block.
+type fileSegment struct {
+	lang  language
+	lines strings.Builder
+}
+
+// Counts the lines of a Markdown file read from r, attributing the lines inside
+// fenced code blocks to the language of each block (as declared by the info
+// string following the opening fence), and the rest of them to Markdown.
+// Fenced code blocks of unknown (or undeclared) languages are counted as
+// Markdown.
+func (t *traversal) countMarkdown(r io.Reader, filename, baseName string) (FileResult, error) {
+	markdown := languagesByName["Markdown"]
+	result := FileResult{Name: baseName, Loc: make(map[string]int)}
+	segment := &fileSegment{lang: markdown}
+	fence := ""
+
+	flush := func() error {
+		fr, err := t.newLocCounter(strings.NewReader(segment.lines.String()), filename, segment.lang).fileResult(baseName)
+		result.add(fr)
+		return err
+	}
+
+	fsc := newLineScanner(newTextReader(r, t.opts.FallbackEncoding), &t.opts)
+	lines := 0
+	for fsc.Scan() {
+		lines++
+		line := fsc.Text()
+		lineFence, info := parseFence(strings.TrimLeft(line, " "))
+		switch {
+		case fence == "" && lineFence != "":
+			// Opening fence; the info string may declare the language.
+			fence = lineFence
+			segment.lines.WriteString(line + "\n")
+			if fields := strings.Fields(info); len(fields) > 0 {
+				if lang, found := languageByAlias(fields[0]); found {
+					if err := flush(); err != nil {
+						return result, err
+					}
+					segment = &fileSegment{lang: lang}
+				}
+			}
+		case fence != "" && lineFence != "" && info == "" && lineFence[:1] == fence[:1] && len(lineFence) >= len(fence):
+			// Closing fence.
+			fence = ""
+			if segment.lang.name != markdown.name {
+				if err := flush(); err != nil {
+					return result, err
+				}
+				segment = &fileSegment{lang: markdown}
+			}
+			segment.lines.WriteString(line + "\n")
+		default:
+			segment.lines.WriteString(line + "\n")
+		}
+	}
+	if err := lineScannerErr(fsc, lines, &t.opts); err != nil {
+		return result, err
+	}
+	return result, flush()
+}
+
+// Returns the fence (i.e. the run of at least three backticks or tildes) that
+// the given line, with its leading spaces trimmed, starts with, along with the
+// rest of the line, trimmed. An empty fence is returned if there is none.
+func parseFence(line string) (fence, rest string) {
+	if !strings.HasPrefix(line, "```") && !strings.HasPrefix(line, "~~~") {
+		return "", ""
+	}
+	n := len(line) - len(strings.TrimLeft(line, line[:1]))
+	return line[:n], strings.TrimSpace(line[n:])
+}
@@ -0,0 +1,73 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import "path/filepath"
+
+// MergeResults returns a new DirResult with the given name, whose Subdirs are
+// the given DirResults, and whose Summary and other counts are their totals.
+// It is meant to combine the results of counting different trees, or different
+// parts of the same tree (e.g. on different machines, in which case their
+// DirResults may be saved as JSON, and loaded for merging).
+//
+// Unlike those of a directory and its subdirectories, the Highlights of the
+// merged DirResult are the largest file among all of them, and the deepest
+// directory at the depth of the DirResult it was found under, while
+// Unrecognized contains the paths of all of them, prefixed by the names of the
+// DirResults they were found under (unless a single file was counted). The
+// errors of the given DirResults are not included, since they are retained in
+// Subdirs.
+func MergeResults(name string, results ...DirResult) DirResult {
+	merged := DirResult{
+		Name:    name,
+		Subdirs: make(DirResults, 0, len(results)),
+		Summary: make(map[string]int),
+	}
+	for _, result := range results {
+		merged.Subdirs = append(merged.Subdirs, result)
+		merged.mergeTotals(result)
+		if result.Histogram != nil {
+			if merged.Histogram == nil {
+				merged.Histogram = make(Histogram)
+			}
+			merged.Histogram.merge(result.Histogram)
+		}
+		if h := result.Highlights; h != nil {
+			if merged.Highlights == nil {
+				merged.Highlights = &Highlights{}
+			}
+			if h.LargestFile != "" {
+				merged.Highlights.considerFile(h.LargestFile, h.LargestFileLoc)
+			}
+			if m := merged.Highlights; h.DeepestDir != "" && (m.DeepestDir == "" || h.DeepestDirDepth > m.DeepestDirDepth ||
+				h.DeepestDirDepth == m.DeepestDirDepth && h.DeepestDir < m.DeepestDir) {
+				m.DeepestDir, m.DeepestDirDepth = h.DeepestDir, h.DeepestDirDepth
+			}
+		}
+		if result.TopFiles != nil {
+			if merged.TopFiles == nil {
+				merged.TopFiles = newTopFiles(result.TopFiles.Limit)
+			}
+			merged.TopFiles.merge(result.TopFiles)
+		}
+		for _, path := range result.Unrecognized {
+			if path != result.Name {
+				path = filepath.Join(result.Name, path)
+			}
+			merged.Unrecognized = append(merged.Unrecognized, path)
+		}
+	}
+	return merged
+}
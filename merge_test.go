@@ -0,0 +1,76 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMergeResults(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"p/a.go":     "package a\n\n// A is a.\nfunc A() {}\n",
+		"p/b.c":      "int b;\n",
+		"p/x.foo":    "unsupported\n",
+		"q/c.go":     "package c\n",
+		"q/sub/d.py": "x = 1\ny = 2\n\n# z\n",
+	})
+	opts := Options{
+		Highlights:       true,
+		Histogram:        true,
+		SourceExtensions: []string{"foo"},
+	}
+	p, err := CountLocWithOptions(filepath.Join(dir, "p"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := CountLocWithOptions(filepath.Join(dir, "q"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Errors = []string{"an error"}
+
+	merged := MergeResults("TOTAL", p, q)
+	if merged.Name != "TOTAL" || !reflect.DeepEqual(merged.Subdirs, DirResults{p, q}) {
+		t.Errorf("MergeResults() = %+v; want TOTAL, with both results as its Subdirs", merged)
+	}
+	if want := map[string]int{"Go": 3, "C": 1, "Python": 2}; !reflect.DeepEqual(merged.Summary, want) {
+		t.Errorf("MergeResults().Summary = %v; want %v", merged.Summary, want)
+	}
+	if want := map[string]int{"Go": 2, "C": 1, "Python": 1}; !reflect.DeepEqual(merged.FileCounts, want) {
+		t.Errorf("MergeResults().FileCounts = %v; want %v", merged.FileCounts, want)
+	}
+	if merged.Blank != 2 || merged.Comment != 2 {
+		t.Errorf("MergeResults() has %d blank and %d comment lines; want 2 and 2", merged.Blank, merged.Comment)
+	}
+	if want := (LineCount{Code: 2, Comment: 1, Blank: 1}); merged.Lines["Python"] != want {
+		t.Errorf("MergeResults().Lines[Python] = %+v; want %+v", merged.Lines["Python"], want)
+	}
+	if total := merged.Histogram.Total(); total[0] != 4 {
+		t.Errorf("MergeResults().Histogram has %d files in its first bucket; want 4", total[0])
+	}
+	// The errors are only retained in the Subdirs.
+	if merged.Errors != nil {
+		t.Errorf("MergeResults().Errors = %q; want none", merged.Errors)
+	}
+	if h := merged.Highlights; h == nil || h.LargestFile != filepath.Join(dir, "p", "a.go") || h.LargestFileLoc != 2 {
+		t.Errorf("MergeResults().Highlights = %+v; want %s, with 2 lines of code", h, filepath.Join(dir, "p", "a.go"))
+	}
+	if want := []string{filepath.Join(p.Name, "x.foo")}; !reflect.DeepEqual(merged.Unrecognized, want) {
+		t.Errorf("MergeResults().Unrecognized = %q; want %q", merged.Unrecognized, want)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// The part of the names of minified files (e.g. "jquery.min.js") that one of
+// their suffixes starts with (see suffixChain).
+const minifiedSuffix = ".min."
+
+// The number of bytes at the beginning of a file that are examined to detect
+// whether it is minified, according to its average line length.
+const minifiedSniffLen = 8192
+
+// Reports whether the file with the given base name is minified, according to
+// its name.
+func isMinifiedName(baseName string) bool {
+	for _, suffix := range suffixChain(baseName) {
+		if strings.HasPrefix(suffix, minifiedSuffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the content read from r looks minified, i.e. whether the
+// average length of the lines at its beginning exceeds maxLineLength. Along
+// with the outcome, it returns a reader that yields the whole content of r,
+// including the bytes that were examined.
+func sniffMinified(r io.Reader, maxLineLength int) (bool, io.Reader, error) {
+	head := make([]byte, minifiedSniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, r, err
+	}
+	head = head[:n]
+	lines := bytes.Count(head, []byte{'\n'})
+	if n > 0 && head[n-1] != '\n' {
+		lines++ // the last (possibly partial) line
+	}
+	minified := lines > 0 && n/lines > maxLineLength
+	return minified, io.MultiReader(bytes.NewReader(head), r), nil
+}
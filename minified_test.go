@@ -0,0 +1,40 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import "testing"
+
+func TestIsMinifiedName(t *testing.T) {
+	tests := []struct {
+		baseName string
+		want     bool
+	}{
+		{"a.min.js", true},
+		{"a.min.css", true},
+		{"jquery.3.min.js", true},
+		{"a.min.map.js", true},
+		{"a.js", false},
+		{"min.js", false},
+		{".min.js", false},
+		{"a.minimal.js", false},
+		{"admin.js", false},
+		{"a.min", false},
+	}
+	for _, test := range tests {
+		if got := isMinifiedName(test.baseName); got != test.want {
+			t.Errorf("isMinifiedName(%q) = %t; want %t", test.baseName, got, test.want)
+		}
+	}
+}
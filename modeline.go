@@ -0,0 +1,151 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// The number of lines at the beginning and at the end of a file that are
+// searched for modelines (the same as vim's default).
+const modelineLines = 5
+
+// The maximum number of bytes read at the beginning and at the end of a file,
+// while searching for modelines.
+const modelineScope = 4096
+
+var (
+	// e.g. "vim: set ft=c:", "vi: filetype=python", "ex:syntax=sh"
+	vimModeline = regexp.MustCompile(`(?:^|\s)(?:vim?|ex):.*\b(?:ft|filetype|syntax)=([\w+#.-]+)`)
+	// e.g. "-*- mode: python -*-", "-*- coding: utf-8; mode: ruby -*-", "-*- c++ -*-"
+	emacsModeline     = regexp.MustCompile(`-\*-\s*(.*?)\s*-\*-`)
+	emacsModeVariable = regexp.MustCompile(`(?:^|;)\s*mode:\s*([\w+#.-]+)`)
+)
+
+// The names used by vim and emacs for some languages, that are neither the
+// name nor one of the extensions of the corresponding language.
+var modelineAliases = map[string]string{
+	"cperl":        "Perl",
+	"elisp":        "Lisp",
+	"emacs-lisp":   "Lisp",
+	"latex":        "TeX",
+	"make":         "Makefile",
+	"plaintex":     "TeX",
+	"shell-script": "Shell",
+	"text":         "plain text",
+}
+
+// Searches the first and last few lines of the content read from r for an
+// editor modeline that declares a supported language. Along with the language
+// found (if any) and a human-readable reason, it returns a reader that yields
+// the whole content of r, from the beginning.
+func readModeline(r io.Reader) (language, string, bool, io.Reader, error) {
+	var head, tail []byte
+	if rs, ok := r.(io.ReadSeeker); ok {
+		// Avoid reading the whole content, if possible.
+		var err error
+		if head, tail, err = readEnds(rs); err != nil {
+			return language{}, "", false, r, err
+		}
+	} else {
+		content, err := io.ReadAll(r)
+		r = bytes.NewReader(content)
+		if err != nil {
+			return language{}, "", false, r, err
+		}
+		head, tail = content, content
+		if len(content) > modelineScope {
+			head, tail = content[:modelineScope], content[len(content)-modelineScope:]
+		}
+	}
+
+	headLines := strings.Split(string(head), "\n")
+	if len(headLines) > modelineLines {
+		headLines = headLines[:modelineLines]
+	}
+	tailLines := strings.Split(strings.TrimRight(string(tail), "\n"), "\n")
+	if len(tailLines) > modelineLines {
+		tailLines = tailLines[len(tailLines)-modelineLines:]
+	}
+	for _, line := range append(headLines, tailLines...) {
+		if name, found := parseModeline(line); found {
+			if lang, found := modelineLanguage(name); found {
+				return lang, fmt.Sprintf("modeline declares %q, which is %s", name, lang.name), true, r, nil
+			}
+			return language{}, fmt.Sprintf("modeline declares unsupported language %q", name), false, r, nil
+		}
+	}
+	return language{}, "no modeline found", false, r, nil
+}
+
+// Reads up to modelineScope bytes at the beginning and at the end of the
+// content of rs, and then rewinds it.
+func readEnds(rs io.ReadSeeker) (head, tail []byte, err error) {
+	head = make([]byte, modelineScope)
+	n, err := io.ReadFull(rs, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, nil, err
+	}
+	head, tail = head[:n], head[:n]
+	if n == modelineScope {
+		size, err := rs.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, nil, err
+		}
+		if size > modelineScope {
+			if _, err := rs.Seek(size-modelineScope, io.SeekStart); err != nil {
+				return nil, nil, err
+			}
+			tail = make([]byte, modelineScope)
+			if n, err = io.ReadFull(rs, tail); err != nil && err != io.ErrUnexpectedEOF {
+				return nil, nil, err
+			}
+			tail = tail[:n]
+		}
+	}
+	_, err = rs.Seek(0, io.SeekStart)
+	return head, tail, err
+}
+
+// Returns the language name declared by a vim or emacs modeline in the given
+// line, if any.
+func parseModeline(line string) (string, bool) {
+	if m := vimModeline.FindStringSubmatch(line); m != nil {
+		return m[1], true
+	}
+	if m := emacsModeline.FindStringSubmatch(line); m != nil {
+		if !strings.Contains(m[1], ":") {
+			return m[1], m[1] != ""
+		}
+		if v := emacsModeVariable.FindStringSubmatch(m[1]); v != nil {
+			return v[1], true
+		}
+	}
+	return "", false
+}
+
+// Returns the supported language referred to by the given name, as used in a
+// modeline, if any.
+func modelineLanguage(name string) (language, bool) {
+	name = strings.ToLower(strings.TrimSuffix(name, "-mode"))
+	if alias, found := modelineAliases[name]; found {
+		name = alias
+	}
+	return languageByAlias(name)
+}
@@ -0,0 +1,80 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestParseModeline(t *testing.T) {
+	tests := []struct {
+		line  string
+		want  string
+		found bool
+	}{
+		{"/* vim: set ft=c: */", "c", true},
+		{"# vi: filetype=python", "python", true},
+		{"# ex:syntax=sh", "sh", true},
+		{"# -*- mode: python -*-", "python", true},
+		{";; -*- coding: utf-8; mode: emacs-lisp -*-", "emacs-lisp", true},
+		{"// -*- c++ -*-", "c++", true},
+		{"// -*- coding: utf-8 -*-", "", false},
+		{"evim: ft=c", "", false},
+		{"int x;", "", false},
+	}
+	for _, test := range tests {
+		if got, found := parseModeline(test.line); got != test.want || found != test.found {
+			t.Errorf("parseModeline(%q) = %q, %t; want %q, %t", test.line, got, found, test.want, test.found)
+		}
+	}
+}
+
+func TestDetectModelines(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a.txt": "/* vim: set ft=c: */\nint x;\n",
+		"b.txt": "x = 1\n\n# -*- mode: python -*-\n",
+		"c.txt": "# vim: ft=klingon\nqapla'\n",
+		"d.txt": "no modeline\n",
+	})
+	checkSummary(t, root, Options{DetectModelines: true},
+		map[string]int{"C": 1, "Python": 1, "plain text": 3})
+	checkSummary(t, root, Options{}, map[string]int{"plain text": 7})
+}
+
+func TestReadModelineRewinds(t *testing.T) {
+	content := "#!/bin/sh\n" + strings.Repeat("echo\n", 2*modelineScope) + "# vim: ft=python\n"
+	for _, r := range []io.Reader{
+		strings.NewReader(content),
+		struct{ io.Reader }{strings.NewReader(content)}, // not an io.Seeker
+	} {
+		lang, _, found, rewound, err := readModeline(r)
+		if err != nil {
+			t.Fatalf("readModeline: %v", err)
+		}
+		if !found || lang.name != "Python" {
+			t.Errorf("readModeline found %q, %t; want %q, true", lang.name, found, "Python")
+		}
+		got, err := io.ReadAll(rewound)
+		if err != nil {
+			t.Fatalf("reading the rewound content: %v", err)
+		}
+		if string(got) != content {
+			t.Errorf("readModeline did not rewind the content (read %d bytes; want %d)", len(got), len(content))
+		}
+	}
+}
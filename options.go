@@ -0,0 +1,628 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Options configures the counting performed by CountLocWithOptions.
+//
+// The zero value of Options is ready to use, and results in exactly the same
+// behaviour as CountLoc.
+type Options struct {
+	// CaseInsensitiveExtensions makes the detection of a file's language
+	// ignore the case of its extension (and of the special file names,
+	// like Makefile and Dockerfile).
+	//
+	// By default, extensions are matched case-sensitively, which is needed
+	// to tell apart C++ (".C", ".H") from C (".c", ".h"). When extensions
+	// are matched case-insensitively, an extension that is registered as it
+	// is still takes precedence, so that e.g. "foo.C" is counted as C++ and
+	// "foo.S" as preprocessed Assembly; any other extension is matched
+	// against the registered ones ignoring case, with those registered in
+	// lowercase taking precedence, so that e.g. "foo.PY" is counted as
+	// Python.
+	CaseInsensitiveExtensions bool
+
+	// SummaryOnly makes the counting only accumulate the summary of the
+	// lines of code per language, without retaining the results of each
+	// subdirectory and file in the returned DirResult (i.e. its Subdirs and
+	// Files fields are left nil). This saves a lot of memory when counting
+	// large trees, if only the summary is needed anyway.
+	SummaryOnly bool
+
+	// SubdirSummaries retains the DirResults of the immediate
+	// subdirectories of the root in its Subdirs even if SummaryOnly is set
+	// (while their own Subdirs and Files are left nil), e.g. to report the
+	// lines of code per top-level directory of a monorepo.
+	SubdirSummaries bool
+
+	// CountFilesOnly makes the counting only tally the files of each
+	// language (see DirResult.FileCounts), without opening them at all, so
+	// that nothing but the directories is read; the lines of code of all
+	// languages are reported as zero. Since their content is not read, the
+	// language of each file is only detected by its name (i.e. modelines,
+	// content sniffing and validation are ignored, and the files without a
+	// known extension are skipped).
+	CountFilesOnly bool
+
+	// ExcludeLinePattern, if not nil, excludes from the count any line that
+	// would otherwise be counted as a line of code, but matches it (e.g.
+	// `nolint` directives, or license headers). The pattern is matched
+	// against the whole line, as read from the file. The number of lines
+	// excluded is reported separately, in the Excluded fields of FileResult
+	// and DirResult.
+	ExcludeLinePattern *regexp.Regexp
+
+	// DetectDuplicates enables tracking how many of the counted lines of
+	// code are exact duplicates (ignoring leading and trailing whitespace)
+	// of lines of code seen elsewhere during the same counting, as a crude
+	// metric of code duplication. The first occurrence of a line is not
+	// considered a duplicate. The results are reported in the Duplicates
+	// fields of FileResult and DirResult.
+	DetectDuplicates bool
+
+	// Duplicates, if not nil, is a DuplicateTracker against which lines of
+	// code are detected to be duplicates, as with DetectDuplicates (which
+	// is implied then), but shared among all countings that use it; i.e.
+	// the first occurrence of a line in any of them is not considered a
+	// duplicate, while all others are.
+	Duplicates *DuplicateTracker
+
+	// DedupHardLinks makes the hard links of the same file (i.e. of the same
+	// inode of the same device) count once per counting, no matter how
+	// many of them are found; the rest are skipped. Unlike DetectDuplicates,
+	// it is cheap, and catches hard links exactly. It is only supported on
+	// Unix-like systems, and only when counting in the filesystem of the
+	// operating system (e.g. not with CountLocFS).
+	DedupHardLinks bool
+
+	// FollowSymlinks enables following symbolic links to files and
+	// directories, which are skipped by default. Each file or directory
+	// reached through symbolic links is counted once, under the path of the
+	// first link found to it, while links to anything under the directory
+	// being counted (which is counted anyway), or under a directory that
+	// has already been reached through another link, are skipped with a
+	// warning; thus cycles of links are never followed. So are links to
+	// directories that contain the directory being counted, or anything
+	// already reached through another link. Which of several links to the
+	// same target is found first depends on the order of the concurrent
+	// traversal, unless Sequential is set. It is only supported when
+	// counting in the filesystem of the operating system (e.g. not with
+	// CountLocFS).
+	FollowSymlinks bool
+
+	// FallbackEncoding is the Encoding used to decode the bytes of files
+	// that are not valid UTF-8. By default, such bytes are left as they
+	// are. Regardless of this option, UTF-8 byte order marks are always
+	// stripped, and files starting with a UTF-16 byte order mark are
+	// always transcoded to UTF-8, before counting.
+	FallbackEncoding Encoding
+
+	// ExtensionOverrides maps file extensions (without the leading dot) to
+	// the names of the languages that files with these extensions should be
+	// counted as, overriding the default detection. This is useful for
+	// extensions that are ambiguous; e.g. ".v" files are counted as Verilog
+	// by default, but the override {"v": "Coq"} counts them as Coq instead.
+	// Overrides are always matched case-sensitively.
+	ExtensionOverrides map[string]string
+
+	// CustomLanguages are languages to be counted in addition to the
+	// supported ones, e.g. a single virtual language for several custom
+	// extensions. Their extensions take precedence over those of the
+	// supported languages, and their names can be used in
+	// ExtensionOverrides and DirectivePatterns too. They are only detected
+	// by extension (i.e. neither by modelines, nor in .gitattributes files,
+	// nor in fenced code blocks of Markdown files).
+	CustomLanguages []Language
+
+	// IgnoreEdgeBlankLines excludes the runs of blank lines at the very
+	// beginning and at the very end of each file from the count of blank
+	// lines, so that only the interior blank lines are counted.
+	IgnoreEdgeBlankLines bool
+
+	// DirectivePatterns maps language names to patterns of commented-out
+	// lines that are semantically meaningful directives, rather than plain
+	// comments (e.g. build constraints, or linter and editor directives).
+	// Commented-out lines that match the pattern of their language (with
+	// their leading whitespace trimmed) are counted separately, in the
+	// Directives fields of FileResult and DirResult. Languages that are not
+	// present in the map have no directives. DefaultDirectivePatterns
+	// returns a set of patterns for some common directives.
+	DirectivePatterns map[string]*regexp.Regexp
+
+	// CountMarkdownFences makes the lines inside fenced code blocks of
+	// Markdown files be counted as lines of the language declared by each
+	// block's info string (e.g. "```go"), using that language's comment
+	// rules, rather than as Markdown. The rest of the lines (prose, as well
+	// as the fences themselves) are still counted as Markdown. Blocks of
+	// unknown or undeclared languages are counted as Markdown too.
+	CountMarkdownFences bool
+
+	// CountHTMLEmbeddedCode makes the lines inside <script> and <style>
+	// elements of HTML files be counted as lines of Javascript and CSS,
+	// respectively, using their comment rules, rather than as HTML.
+	CountHTMLEmbeddedCode bool
+
+	// SeparateDocumentation makes the lines of documentation languages
+	// (i.e. Markdown, reStructuredText, AsciiDoc and plain text) be counted
+	// separately from code, in the Documentation fields of FileResult and
+	// DirResult, rather than in their Loc and Summary, respectively. Code
+	// blocks counted because of CountMarkdownFences are still code.
+	SeparateDocumentation bool
+
+	// DataExtensions are the extensions of data files (e.g. "json" or
+	// "csv"), whose lines are counted separately from code, in the Data
+	// fields of FileResult and DirResult, rather than in their Loc and
+	// Summary, respectively, regardless of their language. Like all lists
+	// of extensions in Options, they may be compound (e.g. "pb.go").
+	// DefaultDataExtensions returns a set of common ones.
+	DataExtensions []string
+
+	// SeparateGenerated makes the lines of generated files be counted
+	// separately from hand-written code, in the Generated fields of
+	// FileResult and DirResult, rather than in their Loc and Summary,
+	// respectively. Generated files are detected either by their names,
+	// if they match any of GeneratedPatterns, or, for Go, by the standard
+	// `// Code generated ... DO NOT EDIT.` header.
+	SeparateGenerated bool
+
+	// GeneratedPatterns are patterns of the names of generated files (e.g.
+	// "*.pb.go"), if SeparateGenerated is set. They are matched against
+	// each file's base name, using the syntax of filepath.Match.
+	// DefaultGeneratedPatterns returns a set of common ones for Go.
+	GeneratedPatterns []string
+
+	// SourceExtensions are the extensions of files that are expected to be
+	// source code (e.g. "swift" or "ts"). Files with any of them whose
+	// language cannot be detected are not counted, but their paths are
+	// reported in the Unrecognized field of DirResult, to surface the gaps
+	// in the coverage of the counting. DefaultSourceExtensions returns a
+	// set of common ones.
+	SourceExtensions []string
+
+	// RawCountExtensions, if not empty, makes the counting bypass language
+	// detection altogether, and only count the files with any of these
+	// extensions (without the leading dot), e.g. of proprietary formats, as
+	// plain text (i.e. each non-blank line is a line of code). Their lines
+	// are reported under the extension that matched, with the leading dot
+	// (e.g. ".xyz", or ".tar.gz" rather than ".gz" for a compound one), in
+	// place of a language.
+	RawCountExtensions []string
+
+	// CountLockFiles disables skipping lock files and similar generated
+	// manifests (e.g. "package-lock.json", "go.sum" or "Cargo.lock"),
+	// which are skipped by default, as if their language was unsupported.
+	CountLockFiles bool
+
+	// SkipFilePatterns are patterns of file names to skip, regardless of
+	// their language, in addition to lock files. They are matched against
+	// each file's base name, using the syntax of filepath.Match.
+	SkipFilePatterns []string
+
+	// SkipDirPatterns are patterns of directory names to skip (e.g.
+	// "vendor" or "node_modules"), along with everything under them. They
+	// are matched against each directory's base name, using the syntax of
+	// filepath.Match; the directory being counted is never skipped.
+	SkipDirPatterns []string
+
+	// MaxDepth, if positive, limits how deep below the directory being
+	// counted the traversal descends: with 1, only the files directly in it
+	// are counted; with 2, also those of its immediate subdirectories, and
+	// so on.
+	MaxDepth int
+
+	// Languages, if not nil, are the names of the only languages to be
+	// counted (among the supported and the custom ones, e.g. "Go" or
+	// "C++"); the files of any other language are skipped. Similarly,
+	// ExcludeLanguages are the names of the languages whose files are
+	// skipped. Each file is skipped (or not) according to the language it
+	// is detected to be written in, regardless of any code of other
+	// languages embedded in it (see CountMarkdownFences).
+	Languages        []string
+	ExcludeLanguages []string
+
+	// OnlyPaths, if not nil, is an allowlist of the paths of the files to be
+	// counted (e.g. those tracked by git, as listed by `git ls-files`),
+	// relative to the directory being counted; any other file is skipped,
+	// and so are the directories that contain none of them. It is ignored
+	// when counting a single file.
+	OnlyPaths []string
+
+	// CountGitDirs disables skipping directories named ".git", which are
+	// skipped by default, along with everything under them.
+	CountGitDirs bool
+
+	// CountGitIgnored disables skipping the files and directories ignored
+	// by .gitignore files, which are skipped by default, the way git does:
+	// the .gitignore files of each directory and of its ancestors, up to
+	// the root of its git repository, are taken into account, with the
+	// patterns of deeper ones (and later ones) taking precedence, so that
+	// negated patterns (e.g. "!keep.txt") re-include paths. As in git,
+	// paths under an ignored directory cannot be re-included. Outside of
+	// any git repository, only the .gitignore files under the directory
+	// being counted are taken into account. CountDiff does not take
+	// .gitignore files into account.
+	CountGitIgnored bool
+
+	// SkipHidden enables skipping hidden directories (i.e. those whose names
+	// start with a dot, like ".cache" or ".venv"), along with everything
+	// under them; hidden files are still counted, and so is the directory
+	// being counted, even if hidden itself.
+	//
+	// HiddenAllowlist are the names of hidden directories (e.g. ".github")
+	// that are exempt from SkipHidden, and are counted like any other
+	// directory. It only overrides SkipHidden: directories named ".git" are
+	// still skipped unless CountGitDirs is set, and those that contain none
+	// of OnlyPaths are still skipped too.
+	SkipHidden      bool
+	HiddenAllowlist []string
+
+	// Markers are strings (e.g. "TODO" or "FIXME") to look for in comments.
+	// The comment lines that contain any of them are counted per language,
+	// in the Markers fields of FileResult and DirResult, as a crude
+	// tech-debt metric. Markers are only looked for in the parts of lines
+	// that are commented out. DefaultMarkers returns a set of common ones.
+	Markers []string
+
+	// CountBranches enables counting the occurrences of branching keywords
+	// and operators (e.g. `if`, `for`, `while`, `case`, `catch`, `&&` and
+	// `||`, depending on the language) in the parts of lines that are code,
+	// in the Branches fields of FileResult and DirResult, as a rough
+	// complexity metric. This is a heuristic rather than a parser; e.g.
+	// keywords in string literals are counted too.
+	CountBranches bool
+
+	// CountStatements enables counting the statements in the code (i.e. the
+	// semicolons outside of string literals and comments) of the languages
+	// that terminate their statements with semicolons (e.g. C or Java), in
+	// the Statements fields of FileResult and DirResult; their ratio to the
+	// lines of code (see FileResult.StatementDensity) is a crude metric of
+	// how compact the code is.
+	CountStatements bool
+
+	// SniffContent enables sniffing the content of files without an
+	// extension whose language cannot be detected by their names, so that
+	// those that look like plain text (as detected by
+	// http.DetectContentType) are counted as such, rather than skipped.
+	// Regardless of this option, common plain text files without an
+	// extension (like README, LICENSE or AUTHORS) are always counted as
+	// plain text.
+	SniffContent bool
+
+	// Histogram enables collecting the distribution of the sizes of the
+	// files counted (in lines of code), per language, in the Histogram
+	// field of DirResult.
+	Histogram bool
+
+	// Highlights enables tracking the file with the most lines of code and
+	// the most deeply nested directory, in the Highlights field of
+	// DirResult.
+	Highlights bool
+
+	// TopFiles, if positive, enables tracking up to that many of the files
+	// with the most lines of code of each language, along with their paths,
+	// in the TopFiles field of DirResult.
+	TopFiles int
+
+	// DetectLicense enables looking for a license file (e.g. "LICENSE" or
+	// "COPYING") at the top level of the directory counted, and identifying
+	// its license (e.g. MIT, Apache-2.0, GPL or BSD) by its first few
+	// lines, in the LicenseFile and License fields of its DirResult.
+	DetectLicense bool
+
+	// FileTimeout, if positive, is the maximum duration of counting a
+	// single file. Files that take longer than that (e.g. pathological
+	// inputs, or files on unresponsive filesystems) are abandoned and
+	// skipped, and a corresponding error is recorded in the Errors field of
+	// the DirResult of their directory. Their lines are not taken into
+	// account when detecting duplicates (see DetectDuplicates) either.
+	FileTimeout time.Duration
+
+	// DetectModelines enables searching the first and last few lines of
+	// each file for a vim or emacs modeline (e.g. "vim: set ft=c:" or
+	// "-*- mode: python -*-"). If one is found that declares a supported
+	// language, the file is counted as written in that language, regardless
+	// of its extension.
+	DetectModelines bool
+
+	// ContentSniffer, if not nil, is the primary method of detecting the
+	// language of each file: it is called with the beginning of the file
+	// (up to its first 8 KiB), and returns the name of the language it is
+	// written in (among the supported and custom ones), regardless of its
+	// name, or an empty string if the other methods (i.e. its extension,
+	// and DetectModelines or SniffContent) should be used instead. It must
+	// be safe for concurrent use; ShebangSniffer is one such function.
+	// Languages of files overridden in .gitattributes (see
+	// UseGitAttributes) take precedence.
+	ContentSniffer func(head []byte) string
+
+	// UseGitAttributes enables taking into account the linguist attributes
+	// set in .gitattributes files, the same way as GitHub does: files
+	// marked as linguist-vendored, linguist-generated or
+	// linguist-documentation are skipped, and the language of files marked
+	// with linguist-language is overridden (taking precedence over both
+	// extensions and modelines). The .gitattributes files of the directory
+	// of each file, and of its ancestors up to the root of its git
+	// repository, are taken into account.
+	UseGitAttributes bool
+
+	// IncludeFileInfo makes the FileResult of each file also carry its size
+	// and modification time, as found while traversing its directory.
+	IncludeFileInfo bool
+
+	// DirWorkers, if positive, is the maximum number of directories being
+	// read concurrently, which mostly bounds the number of file descriptors
+	// used for directories. Directories are still traversed concurrently,
+	// but wait for their turn to be read.
+	//
+	// FileWorkers, if positive, is the maximum number of files being opened
+	// and counted concurrently, which bounds both the number of file
+	// descriptors used for files and the CPU used to count them.
+	//
+	// By default, neither is limited, i.e. every file and directory is
+	// processed as soon as it is found. Sensible limits are a few times the
+	// number of CPUs (e.g. 4 * runtime.NumCPU()) for FileWorkers, since
+	// counting is mostly CPU-bound, and a few dozens for DirWorkers, or
+	// lower on slow or remote filesystems.
+	//
+	// The limits apply to each counting separately (e.g. to each call of
+	// CountLocWithOptions); to share them among several countings, e.g. of
+	// many roots counted concurrently, use Workers instead.
+	DirWorkers, FileWorkers int
+
+	// Workers, if not nil, is a WorkerPool that limits the directories
+	// read and the files counted concurrently, as DirWorkers and
+	// FileWorkers do (which are ignored then), but shared among all
+	// countings that use it.
+	Workers *WorkerPool
+
+	// Context, if not nil, allows cancelling the counting: once it is done,
+	// no more directories are read and files are abandoned as soon as
+	// possible, while the results gathered so far are still returned,
+	// along with the error of the Context.
+	Context context.Context
+
+	// SkipMinified enables skipping minified files, according to their names
+	// (i.e. "*.min.*", like "jquery.min.js" or "style.min.css").
+	//
+	// MinifiedLineLength, if positive, enables skipping files that look
+	// minified, i.e. whose lines at the beginning (examined cheaply, in the
+	// first few kilobytes) are longer than that on average (e.g. 500).
+	//
+	// Minified files that are skipped are not counted, but are reported in
+	// the Minified fields of FileResult and DirResult.
+	SkipMinified       bool
+	MinifiedLineLength int
+
+	// ScanBufferBytes is the maximum length of a line, in bytes; files
+	// with any longer lines (e.g. generated or minified ones) are only
+	// counted up to them, and reported with an error naming the line. If
+	// zero, DefaultScanBufferBytes is used.
+	ScanBufferBytes int
+
+	// ValidateContent enables validating the beginning of the content of
+	// each file against the language detected by its extension, logging a
+	// warning if it strongly suggests another language instead (e.g. a
+	// ".txt" file that is valid JSON, a ".h" file that is clearly C++, or
+	// a plain text file with a shebang line). ReclassifyContent implies
+	// ValidateContent, and also counts such files as the language that
+	// their content suggests.
+	ValidateContent   bool
+	ReclassifyContent bool
+
+	// ReaderDecorators transform the content of the files they apply to
+	// (e.g. GzipDecorator, for gzip-compressed files) before it is counted,
+	// in order.
+	ReaderDecorators []ReaderDecorator
+
+	// CountLineFunc, if not nil, decides whether each line is counted as a
+	// line of code, instead of the default rule (i.e. that lines of code
+	// are those classified as LineCode), given the line with its leading
+	// whitespace trimmed and its classification. It allows implementing
+	// custom metrics; e.g. counting comments instead of code. It must be
+	// safe for concurrent use, since files are counted concurrently. Blank
+	// lines are counted as such regardless of it.
+	CountLineFunc func(line string, state LineState) bool
+
+	// PostProcess, if not nil, is called once on the DirResult of the root,
+	// after all counting and aggregation is complete (even if interrupted
+	// through Context), right before it is returned; e.g. to filter or
+	// enrich the results, or to anonymize their paths. The whole tree may be
+	// modified in place. With CountLocDirStream, it is only called on the
+	// DirResult of the root, which is sent last.
+	PostProcess func(*DirResult)
+
+	// Sequential makes the counting deterministic, for debugging (and
+	// testing): the entries of each directory are counted one at a time,
+	// sorted by name, without spawning any goroutines, so that e.g. the
+	// order of the results, and which of the duplicate lines are considered
+	// seen first, no longer depend on scheduling. It is much slower.
+	Sequential bool
+
+	// MaxFilesPerDir, if positive, is the maximum number of FileResults
+	// retained in the Files of each DirResult (unless SummaryOnly is set),
+	// so that counting huge directories cannot exhaust memory. The rest of
+	// the files are counted all the same, but only their number is
+	// retained, in the ElidedFiles field of the DirResult.
+	MaxFilesPerDir int
+}
+
+// DefaultMarkers returns a new slice of some common markers of comments,
+// suitable for use as Options.Markers.
+func DefaultMarkers() []string {
+	return []string{"TODO", "FIXME", "HACK", "XXX"}
+}
+
+// DefaultDataExtensions returns a new slice of the extensions of some common
+// data files, suitable for use as Options.DataExtensions.
+func DefaultDataExtensions() []string {
+	return []string{"json", "csv", "tsv", "xml", "yaml", "yml"}
+}
+
+// DefaultSourceExtensions returns a new slice of the extensions of some common
+// source files, suitable for use as Options.SourceExtensions.
+func DefaultSourceExtensions() []string {
+	return []string{
+		"bat", "c", "cc", "cpp", "cr", "cs", "f", "f90", "go", "groovy",
+		"h", "hpp", "java", "jl", "js", "jsx", "kt", "less", "m", "mm",
+		"nim", "php", "pl", "py", "rb", "rkt", "rs", "sass", "scala",
+		"scss", "sh", "sol", "svelte", "swift", "ts", "tsx", "vb", "vue",
+		"zig",
+	}
+}
+
+// DefaultDirectivePatterns returns a new map of language names to patterns of
+// some common directives, suitable for use as Options.DirectivePatterns.
+func DefaultDirectivePatterns() map[string]*regexp.Regexp {
+	return map[string]*regexp.Regexp{
+		"C":      regexp.MustCompile(`^//\s*(NOLINT|clang-format )`),
+		"C++":    regexp.MustCompile(`^//\s*(NOLINT|clang-format )`),
+		"Go":     regexp.MustCompile(`^//(go:[a-z]+|\s*\+build |line |export |nolint)`),
+		"Python": regexp.MustCompile(`^#(!|\s*-\*-|\s*(type|noqa|pylint|fmt):)`),
+		"Rust":   regexp.MustCompile(`^//\s*rustfmt::`),
+		"Shell":  regexp.MustCompile(`^#(!|\s*shellcheck )`),
+	}
+}
+
+// Validate checks the Options for errors, like extensions overridden to
+// unsupported languages, or missing patterns, and returns the first one found.
+// CountLocWithOptions validates its Options before counting anything.
+func (o Options) Validate() error {
+	for _, lang := range o.CustomLanguages {
+		if lang.Name == "" {
+			return fmt.Errorf("Invalid custom language without a name, for extensions %q.", lang.Extensions)
+		}
+	}
+	if err := validateOverrides(o.ExtensionOverrides, o.CustomLanguages); err != nil {
+		return err
+	}
+	// The map is checked in the order of its keys, for the error returned to
+	// be the same on every call.
+	names := make([]string, 0, len(o.DirectivePatterns))
+	for name := range o.DirectivePatterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		pattern := o.DirectivePatterns[name]
+		if pattern == nil {
+			return fmt.Errorf("Missing directive pattern for language %q.", name)
+		}
+		if !languageExists(name, o.CustomLanguages) {
+			return fmt.Errorf("Cannot use directive pattern %q for unsupported language %q.", pattern, name)
+		}
+	}
+	for _, pattern := range o.SkipFilePatterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid skip pattern %q: %w.", pattern, err)
+		}
+	}
+	for _, pattern := range o.SkipDirPatterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid directory skip pattern %q: %w.", pattern, err)
+		}
+	}
+	if o.MaxDepth < 0 {
+		return fmt.Errorf("Invalid maximum depth %d.", o.MaxDepth)
+	}
+	for _, name := range o.Languages {
+		if !languageExists(name, o.CustomLanguages) {
+			return fmt.Errorf("Cannot count unsupported language %q.", name)
+		}
+	}
+	for _, name := range o.ExcludeLanguages {
+		if !languageExists(name, o.CustomLanguages) {
+			return fmt.Errorf("Cannot exclude unsupported language %q.", name)
+		}
+	}
+	for _, pattern := range o.GeneratedPatterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid generated file pattern %q: %w.", pattern, err)
+		}
+	}
+	if o.TopFiles < 0 {
+		return fmt.Errorf("Invalid number of top files %d.", o.TopFiles)
+	}
+	if o.ScanBufferBytes < 0 {
+		return fmt.Errorf("Invalid scan buffer size %d.", o.ScanBufferBytes)
+	}
+	if o.MinifiedLineLength < 0 {
+		return fmt.Errorf("Invalid minified line length %d.", o.MinifiedLineLength)
+	}
+	for _, d := range o.ReaderDecorators {
+		if d.Decorate == nil {
+			return fmt.Errorf("Invalid reader decorator for suffix %q, without a Decorate function.", d.Suffix)
+		}
+	}
+	if o.MaxFilesPerDir < 0 {
+		return fmt.Errorf("Invalid maximum number of files per directory %d.", o.MaxFilesPerDir)
+	}
+	if o.DirWorkers < 0 || o.FileWorkers < 0 {
+		return fmt.Errorf("Invalid number of workers (%d for directories, %d for files).", o.DirWorkers, o.FileWorkers)
+	}
+	if o.FallbackEncoding < NoFallbackEncoding || o.FallbackEncoding > Windows1252 {
+		return fmt.Errorf("Unknown fallback encoding %d.", o.FallbackEncoding)
+	}
+	return nil
+}
+
+// Preview reports whether the file or directory at the given path would be
+// counted by CountLocWithOptions using the Options, along with a
+// human-readable reason, without actually counting anything. It is meant to
+// help debug the filtering behaviour of the Options.
+//
+// The decision on each file is the very one that the counting makes (e.g. for
+// RawCountExtensions and CountFilesOnly too). Only the path itself is checked,
+// not its parent directories, and without any other path seen, so all hard
+// links of a file are reported as counted even if DedupHardLinks is set (which
+// the reason mentions). Note also that a directory that would be counted may
+// still contain files and subdirectories that would not.
+func (o Options) Preview(path string) (bool, string) {
+	fileinfo, err := os.Lstat(path)
+	if err != nil {
+		return false, err.Error()
+	}
+	t := newTraversal(o, nil)
+	if fileinfo.IsDir() {
+		if reason := t.skipDir(path); reason != "" {
+			return false, reason
+		}
+		return true, "directory"
+	} else if !fileinfo.Mode().IsRegular() {
+		return false, "not a regular file or directory"
+	}
+	d, err := t.decideFile(path, fileinfo)
+	if d.file != nil {
+		d.file.Close()
+	}
+	if err != nil {
+		return false, err.Error()
+	}
+	if d.verdict < fileListed {
+		return false, d.reason
+	}
+	if _, linked := hardLinkIDOf(fileinfo); linked && t.seenHardLinks != nil {
+		return true, d.reason + ", unless another hard link of it is counted first"
+	}
+	return true, d.reason
+}
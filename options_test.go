@@ -0,0 +1,152 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+func TestTraversalFilters(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a.go":                 "package a\n",
+		"a.py":                 "a = 1\n",
+		"sub/b.go":             "package b\n",
+		"sub/deep/c.go":        "package c\n",
+		"vendor/v.go":          "package v\n",
+		"node_modules/m/m.js":  "var m;\n",
+		"sub/node_modules/n.c": "int n;\n",
+	})
+	tests := []struct {
+		name string
+		opts Options
+		want map[string]int
+	}{
+		{"none", Options{}, map[string]int{"Go": 4, "Python": 1, "Javascript": 1, "C": 1}},
+		{"Languages", Options{Languages: []string{"Go"}}, map[string]int{"Go": 4}},
+		{"ExcludeLanguages", Options{ExcludeLanguages: []string{"Go", "C"}}, map[string]int{"Python": 1, "Javascript": 1}},
+		{"MaxDepth 1", Options{MaxDepth: 1}, map[string]int{"Go": 1, "Python": 1}},
+		{"MaxDepth 2", Options{MaxDepth: 2}, map[string]int{"Go": 3, "Python": 1}},
+		{"SkipDirPatterns", Options{SkipDirPatterns: []string{"vendor", "node_*"}}, map[string]int{"Go": 3, "Python": 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkSummary(t, root, test.opts, test.want)
+		})
+	}
+}
+
+func TestValidateLanguages(t *testing.T) {
+	for _, opts := range []Options{
+		{Languages: []string{"NoSuchLanguage"}},
+		{ExcludeLanguages: []string{"go"}}, // names are case-sensitive
+		{MaxDepth: -1},
+		{SkipDirPatterns: []string{"["}},
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("Validate() of %+v succeeded; want an error", opts)
+		}
+	}
+	opts := Options{
+		Languages:       []string{"Foo"},
+		CustomLanguages: []Language{{Name: "Foo", Extensions: []string{"foo"}}},
+	}
+	if err := opts.Validate(); err != nil {
+		t.Errorf("Validate() with a custom language: %v", err)
+	}
+}
+
+func TestPreviewAgreesWithCounting(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"a.go":     "package a\n",
+		"b.c":      "int b;\n",
+		"c.min.js": "x=1;\n",
+		"d.rec":    "record\n",
+		"e.txt":    "text\n",
+		"f.swift":  "let f = 1\n",
+		"g":        "#!/bin/sh\necho g\n",
+	})
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"default", Options{}},
+		{"raw", Options{RawCountExtensions: []string{"rec", "go"}}},
+		{"files only", Options{CountFilesOnly: true}},
+		{"minified", Options{SkipMinified: true}},
+		{"languages", Options{Languages: []string{"Go", "Shell"}, ContentSniffer: ShebangSniffer}},
+		{"excluded languages", Options{ExcludeLanguages: []string{"C"}, SniffContent: true}},
+		{"source extensions", Options{SourceExtensions: []string{"swift"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := CountLocWithOptions(root, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			counted := make(map[string]bool)
+			for _, fr := range result.Files {
+				counted[fr.Name] = !fr.Minified && !fr.Unrecognized
+			}
+			entries, err := os.ReadDir(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				got, reason := test.opts.Preview(filepath.Join(root, entry.Name()))
+				if want := counted[entry.Name()]; got != want {
+					t.Errorf("Preview(%q) = %t (%s); counted: %t", entry.Name(), got, reason, want)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateFirstError(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{
+			"overrides",
+			Options{ExtensionOverrides: map[string]string{"d": "NoSuch4", "b": "NoSuch2", "a": "NoSuch1", "c": "NoSuch3"}},
+			`Cannot override extension "a" to unsupported language "NoSuch1".`,
+		},
+		{
+			"directive patterns",
+			Options{DirectivePatterns: map[string]*regexp.Regexp{"NoSuch2": nil, "NoSuch1": nil, "NoSuch3": nil}},
+			`Missing directive pattern for language "NoSuch1".`,
+		},
+	}
+	for _, test := range tests {
+		// Maps are iterated in a random order, so check a few times.
+		for i := 0; i < 10; i++ {
+			if err := test.opts.Validate(); err == nil || err.Error() != test.want {
+				t.Fatalf("%s: Validate returned %v; want %q", test.name, err, test.want)
+			}
+		}
+	}
+
+	opts := Options{SkipFilePatterns: []string{"["}}
+	if err := opts.Validate(); !errors.Is(err, filepath.ErrBadPattern) {
+		t.Errorf("Validate returned %v; want an error wrapping %v", err, filepath.ErrBadPattern)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// NewLocCounterFromReader is like NewLocCounter, but the LocCounter returned
+// counts the lines of code in the content read from r, instead of a file.
+// Returns an error if a supported language cannot be detected.
+func NewLocCounterFromReader(r io.Reader, ext string) (lc *LocCounter, err error) {
+	if lang, valid := lookupLanguage(ext, false); !valid {
+		err = fmt.Errorf("Cannot deduce a supported language from extension %q.", ext)
+	} else {
+		lc = newLocCounter(r, "<reader>", lang, &Options{})
+	}
+	return
+}
+
+// CountReader counts the lines of code in the content read from r, which is
+// written in the language associated with the given extension (without the
+// leading dot). It returns a FileResult that contains the results of the
+// counting, with an empty Name.
+// Returns an error if a supported language cannot be detected, or if reading
+// from r fails; in the latter case, the lines counted so far are returned.
+func CountReader(r io.Reader, ext string) (FileResult, error) {
+	lc, err := NewLocCounterFromReader(r, ext)
+	if err != nil {
+		return FileResult{}, err
+	}
+	return lc.fileResult("")
+}
+
+// NamedReader is an input of CountReaders: content to be counted, read from R,
+// as that of a file with the given Name and extension (without the leading
+// dot). If Ext is empty, the language is detected from the Name instead, the
+// same way as for files.
+type NamedReader struct {
+	Name string
+	Ext  string
+	R    io.Reader
+}
+
+// CountReaders counts the lines of code in the content of each of the given
+// inputs concurrently, configured by the given Options (the same way as
+// CountLocWithOptions, except for those that only make sense for files in a
+// filesystem), without any filesystem involved. It returns a DirResult with
+// one FileResult per input (unless Options.SummaryOnly is set), named after
+// it, while inputs of unsupported languages are skipped. Errors (including
+// invalid Options) are recorded in the Errors field of the DirResult.
+func CountReaders(inputs []NamedReader, opts Options) DirResult {
+	result := DirResult{
+		Name:    "<readers>",
+		Summary: make(map[string]int),
+	}
+	if !opts.SummaryOnly {
+		result.Files = make([]FileResult, 0, len(inputs))
+	}
+	if opts.Histogram {
+		result.Histogram = make(Histogram)
+	}
+	if err := opts.Validate(); err != nil {
+		result.addError(err)
+		return result
+	}
+	t := newTraversal(opts, nil)
+
+	// Keep the results in the order of the inputs, rather than in order of
+	// completion.
+	outcomes := make([]fileOutcome, len(inputs))
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		if opts.Sequential {
+			fr, err := t.countReader(input)
+			outcomes[i] = fileOutcome{fr, err}
+			continue
+		}
+		wg.Add(1)
+		go func(i int, input NamedReader) {
+			defer wg.Done()
+			t.fileWorkers.acquire()
+			fr, err := t.countReader(input)
+			t.fileWorkers.release()
+			outcomes[i] = fileOutcome{fr, err}
+		}(i, input)
+	}
+	wg.Wait()
+	for _, fo := range outcomes {
+		t.addFileOutcome(&result, fo)
+	}
+	return result
+}
+
+// Counts a single input of CountReaders, as part of the traversal.
+func (t *traversal) countReader(input NamedReader) (*FileResult, error) {
+	var lang language
+	var found bool
+	var reason string
+	name, decorators := t.decorators(input.Name)
+	if input.Ext != "" {
+		lang, found = t.resolveLanguage(input.Ext)
+		reason = fmt.Sprintf("cannot deduce a supported language from extension %q", input.Ext)
+	} else {
+		lang, reason, found = t.detectLanguage(name)
+	}
+	if !found {
+		logger.Printf("INFO Skipping %q: %s.\n", input.Name, reason)
+		return nil, nil
+	}
+	r, err := decorate(input.Name, input.R, decorators)
+	if err != nil {
+		return nil, err
+	}
+	if t.opts.ValidateContent || t.opts.ReclassifyContent {
+		if lang, r, err = t.validateContent(r, input.Name, lang); err != nil {
+			return nil, fmt.Errorf("%s: %w", input.Name, err)
+		}
+	}
+	if reason := t.skipLanguage(lang.name); reason != "" {
+		logger.Printf("INFO Skipping %q: %s.\n", input.Name, reason)
+		return nil, nil
+	}
+	return t.countContent(r, input.Name, input.Name, lang)
+}
@@ -0,0 +1,50 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCountReadersLanguages(t *testing.T) {
+	inputs := func() []NamedReader {
+		return []NamedReader{
+			{Name: "a.go", R: strings.NewReader("package a\n")},
+			{Name: "b.c", R: strings.NewReader("int b;\n")},
+			{Name: "c", Ext: "py", R: strings.NewReader("c = 1\n")},
+		}
+	}
+	tests := []struct {
+		opts Options
+		want map[string]int
+	}{
+		{Options{}, map[string]int{"Go": 1, "C": 1, "Python": 1}},
+		{Options{Languages: []string{"Go", "Python"}}, map[string]int{"Go": 1, "Python": 1}},
+		{Options{ExcludeLanguages: []string{"Python"}}, map[string]int{"Go": 1, "C": 1}},
+		{Options{Languages: []string{"Go", "C"}, ExcludeLanguages: []string{"C"}}, map[string]int{"Go": 1}},
+	}
+	for _, test := range tests {
+		result := CountReaders(inputs(), test.opts)
+		if len(result.Errors) > 0 {
+			t.Errorf("CountReaders(%+v): %v", test.opts, result.Errors)
+		}
+		if !reflect.DeepEqual(result.Summary, test.want) {
+			t.Errorf("CountReaders(Languages: %q, ExcludeLanguages: %q).Summary = %v; want %v",
+				test.opts.Languages, test.opts.ExcludeLanguages, result.Summary, test.want)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// ReportOptions configures the Report produced by DirResult.Report.
+//
+// The zero value of ReportOptions produces a Report of all languages, sorted by
+// lines of code in descending order, without any files.
+type ReportOptions struct {
+	// SortByName sorts the languages of the Report by name, instead of by
+	// lines of code.
+	SortByName bool
+
+	// MaxLanguages, if positive, is the maximum number of languages in the
+	// Report; the rest of them are omitted, after sorting. The totals and
+	// percentages of the Report always account for all languages.
+	MaxLanguages int
+
+	// TopFiles is the number of files with the most lines of code to include
+	// in the Report. It requires the files to have been retained in the
+	// DirResult (i.e. counted without Options.SummaryOnly set).
+	TopFiles int
+}
+
+// Report is a ready-to-render summary of a DirResult, as produced by
+// DirResult.Report.
+type Report struct {
+	Name      string           `json:"name" yaml:"Name"`
+	Languages []LanguageReport `json:"languages" yaml:"Languages"`
+	TopFiles  []FileReport     `json:"topFiles,omitempty" yaml:"TopFiles,omitempty"`
+	Total     int              `json:"total" yaml:"Total"`
+	Blank     int              `json:"blank,omitempty" yaml:"Blank,omitempty"`
+}
+
+// LanguageReport represents the lines of code of a single language in a
+// Report, along with their percentage of the Report's Total.
+type LanguageReport struct {
+	Name       string  `json:"name" yaml:"Name"`
+	Loc        int     `json:"loc" yaml:"Loc"`
+	Percentage float64 `json:"percentage" yaml:"Percentage"`
+}
+
+// FileReport represents a single file in a Report, by its full path and its
+// total lines of code (in all languages).
+type FileReport struct {
+	Path string `json:"path" yaml:"Path"`
+	Loc  int    `json:"loc" yaml:"Loc"`
+}
+
+// Report returns a ready-to-render summary of the DirResult, as configured by
+// the given ReportOptions, so that consumers do not have to sort and total the
+// Summary (and its files) themselves.
+func (d DirResult) Report(opts ReportOptions) Report {
+	report := Report{
+		Name:      d.Name,
+		Languages: make([]LanguageReport, 0, len(d.Summary)),
+		Blank:     d.Blank,
+	}
+	for lang, loc := range d.Summary {
+		report.Languages = append(report.Languages, LanguageReport{Name: lang, Loc: loc})
+		report.Total += loc
+	}
+	for i := range report.Languages {
+		if report.Total > 0 {
+			report.Languages[i].Percentage = 100 * float64(report.Languages[i].Loc) / float64(report.Total)
+		}
+	}
+	sort.Slice(report.Languages, func(i, j int) bool {
+		li, lj := report.Languages[i], report.Languages[j]
+		if !opts.SortByName && li.Loc != lj.Loc {
+			return li.Loc > lj.Loc
+		}
+		return li.Name < lj.Name
+	})
+	if opts.MaxLanguages > 0 && len(report.Languages) > opts.MaxLanguages {
+		report.Languages = report.Languages[:opts.MaxLanguages]
+	}
+
+	if opts.TopFiles > 0 {
+		report.TopFiles = d.fileReports(nil)
+		sort.SliceStable(report.TopFiles, func(i, j int) bool {
+			return report.TopFiles[i].Loc > report.TopFiles[j].Loc
+		})
+		if len(report.TopFiles) > opts.TopFiles {
+			report.TopFiles = report.TopFiles[:opts.TopFiles]
+		}
+	}
+	return report
+}
+
+// Appends a FileReport for each of the files of the DirResult, and of all of
+// its subdirectories, recursively, to files.
+func (d DirResult) fileReports(files []FileReport) []FileReport {
+	for _, fr := range d.Files {
+		loc := 0
+		for _, n := range fr.Loc {
+			loc += n
+		}
+		filePath := filepath.Join(d.Name, fr.Name)
+		if d.Subdirs == nil && d.Name == fr.Name {
+			// A single file, counted as the root.
+			filePath = fr.Name
+		}
+		files = append(files, FileReport{Path: filePath, Loc: loc})
+	}
+	for _, sub := range d.Subdirs {
+		files = sub.fileReports(files)
+	}
+	return files
+}
+
+// LanguageSummary represents the lines of code of a single language in a
+// DirResult, along with the number of files that contain them, and their
+// average lines of code per file, as returned by DirResult.DetailedSummary.
+type LanguageSummary struct {
+	Files   int     `json:"files" yaml:"files"`
+	Code    int     `json:"code" yaml:"code"`
+	Comment int     `json:"comment" yaml:"comment"`
+	Blank   int     `json:"blank" yaml:"blank"`
+	Average float64 `json:"avg" yaml:"avg"`
+}
+
+// DetailedSummary returns the Summary of the DirResult, enriched with the
+// number of files of each language (see FileCounts), their comment and blank
+// lines (see Lines), and their average lines of code per file.
+func (d DirResult) DetailedSummary() map[string]LanguageSummary {
+	summary := make(map[string]LanguageSummary, len(d.Summary))
+	for lang, loc := range d.Summary {
+		ls := LanguageSummary{Files: d.FileCounts[lang], Code: loc, Comment: d.Lines[lang].Comment, Blank: d.Lines[lang].Blank}
+		if ls.Files > 0 {
+			ls.Average = float64(loc) / float64(ls.Files)
+		}
+		summary[lang] = ls
+	}
+	return summary
+}
+
+// Categories returns the lines of code of the DirResult rolled up per category
+// of languages: "Programming", "Markup" (e.g. HTML), "Data" (e.g. JSON),
+// "Config" (e.g. YAML) and "Documentation" (e.g. Markdown). The lines counted
+// separately because of Options.SeparateDocumentation and DataExtensions are
+// included too.
+func (d DirResult) Categories() map[string]int {
+	categories := make(map[string]int)
+	for _, counts := range []map[string]int{d.Summary, d.Documentation, d.Data} {
+		for lang, loc := range counts {
+			categories[languagesByName[lang].category.String()] += loc
+		}
+	}
+	return categories
+}
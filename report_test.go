@@ -0,0 +1,93 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+	result := DirResult{
+		Name:    "root",
+		Summary: map[string]int{"Go": 50, "C": 30, "Rust": 10, "Python": 10},
+		Blank:   7,
+		Files:   []FileResult{{Name: "a.go", Loc: map[string]int{"Go": 20}}, {Name: "b.c", Loc: map[string]int{"C": 30}}},
+		Subdirs: DirResults{{
+			Name:  "root/sub",
+			Files: []FileResult{{Name: "c.go", Loc: map[string]int{"Go": 30}}, {Name: "d.rs", Loc: map[string]int{"Rust": 10}}, {Name: "e.py", Loc: map[string]int{"Python": 10}}},
+		}},
+	}
+	names := func(r Report) []string {
+		var names []string
+		for _, lang := range r.Languages {
+			names = append(names, lang.Name)
+		}
+		return names
+	}
+
+	report := result.Report(ReportOptions{})
+	if want := []string{"Go", "C", "Python", "Rust"}; !reflect.DeepEqual(names(report), want) {
+		t.Errorf("Languages sorted by lines of code are %q; want %q (ties sorted by name)", names(report), want)
+	}
+	if report.Name != "root" || report.Total != 100 || report.Blank != 7 || report.TopFiles != nil {
+		t.Errorf("Report(ReportOptions{}) = %+v", report)
+	}
+	if report.Languages[0].Percentage != 50 || report.Languages[3].Percentage != 10 {
+		t.Errorf("Percentages are %v and %v; want 50 and 10", report.Languages[0].Percentage, report.Languages[3].Percentage)
+	}
+
+	report = result.Report(ReportOptions{SortByName: true})
+	if want := []string{"C", "Go", "Python", "Rust"}; !reflect.DeepEqual(names(report), want) {
+		t.Errorf("Languages sorted by name are %q; want %q", names(report), want)
+	}
+
+	// The totals and percentages account for the omitted languages too.
+	report = result.Report(ReportOptions{MaxLanguages: 2})
+	if want := []string{"Go", "C"}; !reflect.DeepEqual(names(report), want) {
+		t.Errorf("At most 2 languages are %q; want %q", names(report), want)
+	}
+	if report.Total != 100 || report.Languages[1].Percentage != 30 {
+		t.Errorf("At most 2 languages, total %d and percentage of C %v; want 100 and 30", report.Total, report.Languages[1].Percentage)
+	}
+	if report := result.Report(ReportOptions{MaxLanguages: 10}); len(report.Languages) != 4 {
+		t.Errorf("At most 10 languages are %q; want all 4", names(report))
+	}
+
+	// Files with as many lines of code keep the order they were found in.
+	report = result.Report(ReportOptions{TopFiles: 3})
+	want := []FileReport{{"root/b.c", 30}, {"root/sub/c.go", 30}, {"root/a.go", 20}}
+	if !reflect.DeepEqual(report.TopFiles, want) {
+		t.Errorf("Top 3 files are %v; want %v", report.TopFiles, want)
+	}
+	if report := result.Report(ReportOptions{TopFiles: 10}); len(report.TopFiles) != 5 {
+		t.Errorf("Top 10 files are %v; want all 5", report.TopFiles)
+	}
+}
+
+func TestReportSingleFile(t *testing.T) {
+	result := DirResult{
+		Name:    "a.go",
+		Summary: map[string]int{"Go": 3},
+		Files:   []FileResult{{Name: "a.go", Loc: map[string]int{"Go": 3}}},
+	}
+	report := result.Report(ReportOptions{TopFiles: 1})
+	if want := []FileReport{{"a.go", 3}}; !reflect.DeepEqual(report.TopFiles, want) {
+		t.Errorf("Top files of a single file are %v; want %v", report.TopFiles, want)
+	}
+	if report := (DirResult{}).Report(ReportOptions{}); report.Total != 0 || len(report.Languages) != 0 {
+		t.Errorf("Report of an empty DirResult = %+v", report)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// The names of common files without an extension that are plain text.
+var textFileNames = []string{
+	"AUTHORS",
+	"CHANGELOG",
+	"CHANGES",
+	"CONTRIBUTORS",
+	"COPYING",
+	"HISTORY",
+	"INSTALL",
+	"LICENSE",
+	"NEWS",
+	"NOTICE",
+	"README",
+	"THANKS",
+	"TODO",
+}
+
+// Reports whether the given base name is the name of a common plain text file
+// without an extension, optionally ignoring case.
+func isTextFileName(baseName string, ignoreCase bool) bool {
+	for _, name := range textFileNames {
+		if baseName == name || ignoreCase && strings.EqualFold(baseName, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// The maximum number of bytes taken into account by http.DetectContentType.
+const sniffLen = 512
+
+// Reports whether the content of the file with the given name should be sniffed
+// to detect whether it is plain text, since its language could not be detected
+// by its name.
+func (t *traversal) shouldSniff(filename string) bool {
+	return t.opts.SniffContent && filepath.Ext(filename) == ""
+}
+
+// Sniffs the beginning of the content read from r, to detect whether it is
+// plain text. Along with the outcome and a human-readable reason for it, it
+// returns a reader that yields the whole content of r, including the bytes
+// that were sniffed.
+func sniffText(r io.Reader) (bool, string, io.Reader, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, "", r, err
+	}
+	head = head[:n]
+	if n == 0 {
+		return false, "no extension, and empty", r, nil
+	}
+	contentType := http.DetectContentType(head)
+	reason := fmt.Sprintf("no extension, and content sniffed as %q", contentType)
+	return strings.HasPrefix(contentType, "text/plain"), reason, io.MultiReader(bytes.NewReader(head), r), nil
+}
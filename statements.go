@@ -0,0 +1,73 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import "strings"
+
+// The languages whose statements are terminated (or separated) by semicolons,
+// and are thus counted if Options.CountStatements is set. Statements are not
+// counted for any other language (e.g. Go or Python, where semicolons are
+// rare), since their counts would be meaningless.
+var semicolonLanguages = map[string]bool{
+	"Ada":           true,
+	"C":             true,
+	"C++":           true,
+	"C#":            true,
+	"D":             true,
+	"Dart":          true,
+	"Delphi":        true,
+	"Java":          true,
+	"Javascript":    true,
+	"Perl":          true,
+	"PHP":           true,
+	"Rust":          true,
+	"SQL":           true,
+	"SystemVerilog": true,
+	"Verilog":       true,
+	"VHDL":          true,
+}
+
+// Returns the number of statements in the given code, i.e. of the semicolons
+// in it, with the contents of its string literals already masked. This is
+// merely a heuristic: e.g. the header of a C for loop counts as two statements.
+func countStatements(code string) int {
+	return strings.Count(code, ";")
+}
+
+// StatementDensity returns the number of statements per line of code of each
+// language of the file, if Options.CountStatements was set; languages whose
+// statements are not counted (e.g. those without semicolons) are omitted, as
+// are those without any lines of code.
+func (f FileResult) StatementDensity() map[string]float64 {
+	return statementDensity(f.Statements, f.Loc)
+}
+
+// StatementDensity returns the number of statements per line of code of each
+// language under the directory, like FileResult.StatementDensity.
+func (d DirResult) StatementDensity() map[string]float64 {
+	return statementDensity(d.Statements, d.Summary)
+}
+
+// Returns the ratio of the given statements to the given lines of code, per
+// language.
+func statementDensity(statements, loc map[string]int) map[string]float64 {
+	density := make(map[string]float64, len(statements))
+	for lang, n := range statements {
+		if loc[lang] > 0 {
+			density[lang] = float64(n) / float64(loc[lang])
+		}
+	}
+	return density
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+// CountLocDirStream is like CountLoc, but streams the results per directory:
+// it returns a channel on which the DirResult of each directory under root is
+// sent as soon as the directory (i.e. all of its files and subdirectories) has
+// been counted. Thus, the DirResults of the subdirectories of a directory are
+// always sent before its own, and the DirResult of root is sent last, after
+// which the channel is closed.
+//
+// It is equivalent to calling CountLocDirStreamWithOptions with the zero value
+// of Options.
+func CountLocDirStream(root string) <-chan DirResult {
+	return CountLocDirStreamWithOptions(root, Options{})
+}
+
+// CountLocDirStreamWithOptions is like CountLocDirStream, but the counting is
+// configured by the given Options. If root could not be counted at all, a
+// single DirResult is sent, with the error in its Errors.
+//
+// The channel must be drained, unless the counting is cancelled through
+// Options.Context; once cancelled, no more DirResults are sent (not even that
+// of root), and the channel is closed as soon as the traversal returns.
+func CountLocDirStreamWithOptions(root string, opts Options) <-chan DirResult {
+	results := make(chan DirResult)
+	var done <-chan struct{}
+	if opts.Context != nil {
+		done = opts.Context.Done()
+	}
+	send := func(result DirResult) {
+		select {
+		case results <- result:
+		case <-done:
+		}
+	}
+	go func() {
+		defer close(results)
+		result, err := countLoc(root, opts, send)
+		if opts.Context != nil && opts.Context.Err() != nil {
+			return
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+		send(result)
+	}()
+	return results
+}
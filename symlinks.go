@@ -0,0 +1,91 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// The real paths (i.e. with all symbolic links resolved) of the files and
+// directories reached through symbolic links during a traversal, which are
+// only counted once (see Options.FollowSymlinks). It is safe for concurrent
+// use.
+type symlinkTargets struct {
+	mu      sync.Mutex
+	root    string // the real path of the root of the traversal
+	targets []string
+}
+
+// Resolves the symbolic link with the given path, returning information about
+// the file or directory it points to, if it should be counted; otherwise, a
+// reason why it should be skipped is returned. Links whose targets lie under
+// the root of the traversal are skipped, since their targets are counted
+// anyway, and so are links whose targets have already been counted through
+// another link (or lie under a directory that has), which also breaks cycles.
+// Links to directories that contain the root, or a target already counted,
+// are skipped too, so that nothing is counted twice.
+//
+// The first link resolved to a target wins, so which one that is depends on
+// the order in which the links are found; unless Options.Sequential is set,
+// that is the order in which the concurrent goroutines of the traversal
+// happen to reach them.
+func (t *traversal) resolveSymlink(linkPath string) (os.FileInfo, string) {
+	realPath, err := filepath.EvalSymlinks(linkPath)
+	if err != nil {
+		return nil, err.Error()
+	}
+	fileinfo, err := os.Stat(realPath)
+	if err != nil {
+		return nil, err.Error()
+	}
+	if !fileinfo.IsDir() && !fileinfo.Mode().IsRegular() {
+		return nil, "target is not a regular file or directory"
+	}
+
+	s := t.symlinks
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.root == "" && t.root != "" {
+		if s.root, err = filepath.EvalSymlinks(t.root); err != nil {
+			s.root = t.root
+		}
+	}
+	if s.root != "" && isUnder(realPath, s.root) {
+		return nil, "target is already counted under the root"
+	}
+	if s.root != "" && isUnder(s.root, realPath) {
+		return nil, "target contains the root"
+	}
+	for _, target := range s.targets {
+		if isUnder(realPath, target) {
+			return nil, "target " + target + " is already counted through another link"
+		}
+		if isUnder(target, realPath) {
+			return nil, "target contains " + target + ", which is already counted through another link"
+		}
+	}
+	s.targets = append(s.targets, realPath)
+	return fileinfo, ""
+}
+
+// Reports whether the given path is the same as, or lies under, the given
+// directory; both must be clean, absolute paths.
+func isUnder(name, dir string) bool {
+	rel, err := filepath.Rel(dir, name)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,42 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFollowSymlinksOverlappingTargets(t *testing.T) {
+	outer := t.TempDir()
+	writeTree(t, outer, map[string]string{
+		"x/a.go":     "package x\n",
+		"x/sub/b.go": "package sub\n",
+		"root/c.go":  "package root\n",
+	})
+	root := filepath.Join(outer, "root")
+	for link, target := range map[string]string{
+		"l1": filepath.Join(outer, "x", "sub"),
+		"l2": filepath.Join(outer, "x"), // contains the target of l1
+		"l3": outer,                     // contains the root
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skipf("Cannot create symbolic links: %v", err)
+		}
+	}
+	// The links are found in the order of their names.
+	checkSummary(t, root, Options{FollowSymlinks: true, Sequential: true}, map[string]int{"Go": 2})
+}
@@ -0,0 +1,204 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+)
+
+// TarFS is a read-only fs.FS backed by the contents of a tar archive, which
+// allows counting the lines of code of source tarballs (e.g. using CountLocFS)
+// without extracting them to disk. The whole archive is read in memory.
+//
+// Symbolic and hard links are reported as symbolic links (thus they are not
+// counted), and the directories that are missing from the archive are
+// reconstructed from the paths of their entries.
+type TarFS struct {
+	nodes map[string]*tarNode
+}
+
+// A file or directory in a TarFS.
+type tarNode struct {
+	name     string
+	mode     fs.FileMode
+	modTime  time.Time
+	content  []byte
+	children []*tarNode
+}
+
+// The magic numbers of the compression formats of the archives that a TarFS
+// can be read from, or that are detected to be reported as unsupported.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// NewTarFS returns a new TarFS with the contents of the tar archive read from
+// r, which may be compressed using gzip (e.g. .tar.gz or .tgz files), as
+// detected from its first bytes. Archives compressed otherwise (e.g. using
+// Zstandard) are not supported, and must be decompressed first.
+func NewTarFS(r io.Reader) (*TarFS, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(zstdMagic))
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return readTarFS(zr)
+	case bytes.HasPrefix(magic, zstdMagic):
+		return nil, errors.New("Zstandard-compressed tar archives are not supported; they must be decompressed first.")
+	}
+	return readTarFS(br)
+}
+
+// Reads all entries of the (uncompressed) tar archive read from r into a new
+// TarFS.
+func readTarFS(r io.Reader) (*TarFS, error) {
+	t := &TarFS{nodes: map[string]*tarNode{
+		".": {name: ".", mode: fs.ModeDir | 0555},
+	}}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return t, nil
+		} else if err != nil {
+			return nil, err
+		}
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if name == "." || !fs.ValidPath(name) {
+			continue
+		}
+		var node *tarNode
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			node = t.mkdirAll(name)
+		case tar.TypeReg, tar.TypeRegA:
+			node = t.add(name, 0444)
+			if node.content, err = io.ReadAll(tr); err != nil {
+				return nil, err
+			}
+		case tar.TypeSymlink, tar.TypeLink:
+			node = t.add(name, fs.ModeSymlink|0777)
+		default:
+			continue // devices, FIFOs, extended headers etc.
+		}
+		node.modTime = hdr.ModTime
+	}
+}
+
+// Returns the directory with the given path, adding it (and any missing parent
+// directories) if it does not exist yet.
+func (t *TarFS) mkdirAll(name string) *tarNode {
+	if node, exists := t.nodes[name]; exists && node.mode.IsDir() {
+		return node
+	}
+	return t.add(name, fs.ModeDir|0555)
+}
+
+// Adds a new node with the given path and mode, replacing any existing one,
+// along with any missing parent directories.
+func (t *TarFS) add(name string, mode fs.FileMode) *tarNode {
+	node := &tarNode{name: path.Base(name), mode: mode}
+	parent := t.mkdirAll(path.Dir(name))
+	if old, exists := t.nodes[name]; exists {
+		// Entries that appear again in an archive replace the earlier ones.
+		for i, child := range parent.children {
+			if child == old {
+				parent.children = append(parent.children[:i], parent.children[i+1:]...)
+				break
+			}
+		}
+	}
+	t.nodes[name] = node
+	parent.children = append(parent.children, node)
+	return node
+}
+
+// Open opens the named file or directory of the archive, implementing fs.FS.
+func (t *TarFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	node, exists := t.nodes[name]
+	if !exists {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if node.mode.IsDir() {
+		return &tarDir{node: node}, nil
+	}
+	return &tarFile{node: node, Reader: bytes.NewReader(node.content)}, nil
+}
+
+// Implements fs.FileInfo for a tarNode.
+type tarFileInfo struct{ node *tarNode }
+
+func (fi tarFileInfo) Name() string       { return fi.node.name }
+func (fi tarFileInfo) Size() int64        { return int64(len(fi.node.content)) }
+func (fi tarFileInfo) Mode() fs.FileMode  { return fi.node.mode }
+func (fi tarFileInfo) ModTime() time.Time { return fi.node.modTime }
+func (fi tarFileInfo) IsDir() bool        { return fi.node.mode.IsDir() }
+func (fi tarFileInfo) Sys() interface{}   { return nil }
+
+// An open file of a TarFS.
+type tarFile struct {
+	node *tarNode
+	*bytes.Reader
+}
+
+func (f *tarFile) Stat() (fs.FileInfo, error) { return tarFileInfo{f.node}, nil }
+func (f *tarFile) Close() error               { return nil }
+
+// An open directory of a TarFS.
+type tarDir struct {
+	node   *tarNode
+	offset int
+}
+
+func (d *tarDir) Stat() (fs.FileInfo, error) { return tarFileInfo{d.node}, nil }
+func (d *tarDir) Close() error               { return nil }
+
+func (d *tarDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.node.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *tarDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	children := d.node.children[d.offset:]
+	if n > 0 && len(children) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(children) {
+		children = children[:n]
+	}
+	entries := make([]fs.DirEntry, len(children))
+	for i, child := range children {
+		entries[i] = fs.FileInfoToDirEntry(tarFileInfo{child})
+	}
+	d.offset += len(children)
+	return entries, nil
+}
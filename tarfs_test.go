@@ -0,0 +1,122 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/fs"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+// An entry of a tar archive built by a test.
+type tarEntry struct {
+	name     string
+	typeflag byte
+	content  string
+	linkname string
+}
+
+// Returns a tar archive of the given entries, compressed using gzip if
+// requested.
+func buildTar(t *testing.T, entries []tarEntry, compress bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.Writer = &buf
+	var gw *gzip.Writer
+	if compress {
+		gw = gzip.NewWriter(&buf)
+		w = gw
+	}
+	tw := tar.NewWriter(w)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Typeflag: e.typeflag, Mode: 0644, Size: int64(len(e.content)), Linkname: e.linkname}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gw != nil {
+		if err := gw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestTarFS(t *testing.T) {
+	entries := []tarEntry{
+		{name: "p/", typeflag: tar.TypeDir},
+		{name: "p/a.go", typeflag: tar.TypeReg, content: "package a\n"},
+		// Its parent directories are missing from the archive.
+		{name: "q/r/b.go", typeflag: tar.TypeReg, content: "package b\n"},
+		{name: "p/link.go", typeflag: tar.TypeSymlink, linkname: "a.go"},
+		{name: "p/hard.go", typeflag: tar.TypeLink, linkname: "p/a.go"},
+		// It replaces the earlier entry.
+		{name: "p/a.go", typeflag: tar.TypeReg, content: "package a\n\nfunc A() {}\n"},
+	}
+	for _, compress := range []bool{false, true} {
+		tfs, err := NewTarFS(bytes.NewReader(buildTar(t, entries, compress)))
+		if err != nil {
+			t.Fatalf("NewTarFS(compress=%t): %v", compress, err)
+		}
+		if err := fstest.TestFS(tfs, "p/a.go", "p/link.go", "p/hard.go", "q/r/b.go"); err != nil {
+			t.Errorf("TestFS(compress=%t): %v", compress, err)
+		}
+		if content, err := fs.ReadFile(tfs, "p/a.go"); err != nil || string(content) != entries[5].content {
+			t.Errorf("ReadFile(p/a.go) = %q, %v; want %q", content, err, entries[5].content)
+		}
+		dirEntries, err := fs.ReadDir(tfs, "p")
+		if err != nil {
+			t.Fatal(err)
+		}
+		modes := make(map[string]fs.FileMode)
+		for _, de := range dirEntries {
+			modes[de.Name()] = de.Type()
+		}
+		want := map[string]fs.FileMode{"a.go": 0, "link.go": fs.ModeSymlink, "hard.go": fs.ModeSymlink}
+		if !reflect.DeepEqual(modes, want) {
+			t.Errorf("ReadDir(p) = %v; want %v", modes, want)
+		}
+		for _, dir := range []string{"q", "q/r"} {
+			if fi, err := fs.Stat(tfs, dir); err != nil || !fi.IsDir() {
+				t.Errorf("Stat(%s) of a missing parent directory = %v, %v; want a directory", dir, fi, err)
+			}
+		}
+
+		result, err := CountLocFS(tfs, ".", Options{})
+		if err != nil {
+			t.Fatalf("CountLocFS(compress=%t): %v", compress, err)
+		}
+		if want := map[string]int{"Go": 3}; !reflect.DeepEqual(result.Summary, want) {
+			t.Errorf("CountLocFS(compress=%t).Summary = %v; want %v", compress, result.Summary, want)
+		}
+	}
+}
+
+func TestTarFSZstd(t *testing.T) {
+	if _, err := NewTarFS(bytes.NewReader([]byte{0x28, 0xb5, 0x2f, 0xfd, 0})); err == nil {
+		t.Error("NewTarFS() of a Zstandard-compressed archive succeeded; want an error")
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Creates the given files (with the given contents) under dir, along with any
+// missing parent directories. Names ending with a slash are created as empty
+// directories.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if name[len(name)-1] == '/' {
+			if err := os.MkdirAll(path, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Counts root using the given Options, failing the test on error, and checks
+// the summary of the result against want.
+func checkSummary(t *testing.T, root string, opts Options, want map[string]int) DirResult {
+	t.Helper()
+	result, err := CountLocWithOptions(root, opts)
+	if err != nil {
+		t.Fatalf("CountLocWithOptions(%q): %v", root, err)
+	}
+	if !reflect.DeepEqual(result.Summary, want) {
+		t.Errorf("CountLocWithOptions(%q).Summary = %v; want %v", root, result.Summary, want)
+	}
+	return result
+}
+
+// A test case of the counting of the lines of some content, written in the
+// language of the given extension.
+type lineCountTest struct {
+	name    string
+	ext     string
+	content string
+	loc     int // lines of code
+	comment int // comment lines
+	blank   int // blank lines
+}
+
+// Counts the content of each of the given test cases using CountReader, and
+// checks the lines of code, comment and blank lines counted.
+func runLineCountTests(t *testing.T, tests []lineCountTest) {
+	t.Helper()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lang, found := lookupLanguage(test.ext, false)
+			if !found {
+				t.Fatalf("Unsupported extension %q", test.ext)
+			}
+			fr, err := CountReader(strings.NewReader(test.content), test.ext)
+			if err != nil {
+				t.Fatalf("CountReader(%q): %v", test.content, err)
+			}
+			if got := fr.Loc[lang.name]; got != test.loc {
+				t.Errorf("CountReader(%q) counted %d lines of code; want %d", test.content, got, test.loc)
+			}
+			if fr.Comment != test.comment {
+				t.Errorf("CountReader(%q) counted %d comment lines; want %d", test.content, fr.Comment, test.comment)
+			}
+			if fr.Blank != test.blank {
+				t.Errorf("CountReader(%q) counted %d blank lines; want %d", test.content, fr.Blank, test.blank)
+			}
+		})
+	}
+}
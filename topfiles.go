@@ -0,0 +1,88 @@
+// Copyright 2018 Christos Katsakioris
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package glocc
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// TopFiles are the largest files of each language of a counted tree, e.g. to
+// find candidates for refactoring.
+//
+// Limit is the maximum number of files retained per language (see
+// Options.TopFiles), and Files are the largest files (by their lines of code
+// of each language) per language, sorted from the largest one. Among files
+// that tie, those with the lexicographically smallest paths come first, so that
+// the TopFiles do not depend on the order in which files are counted.
+type TopFiles struct {
+	Limit int                       `json:"limit" yaml:"limit"`
+	Files map[string][]FileLocation `json:"files,omitempty" yaml:"files,omitempty"`
+}
+
+// FileLocation is the path of a file, along with its lines of code of a
+// single language.
+type FileLocation struct {
+	Path string `json:"path" yaml:"path"`
+	Loc  int    `json:"loc" yaml:"loc"`
+}
+
+// Returns new, empty TopFiles, retaining up to the given number of files per
+// language.
+func newTopFiles(limit int) *TopFiles {
+	return &TopFiles{Limit: limit, Files: make(map[string][]FileLocation)}
+}
+
+// Accounts for the given file, found in the given directory, in the TopFiles.
+func (tf *TopFiles) addFile(dir string, fr FileResult) {
+	if fr.Minified || fr.Unrecognized {
+		return
+	}
+	path := filepath.Join(dir, fr.Name)
+	for lang, loc := range fr.Loc {
+		tf.consider(lang, FileLocation{Path: path, Loc: loc})
+	}
+}
+
+// Merges the TopFiles of a subdirectory (or of any other tree) into the
+// TopFiles.
+func (tf *TopFiles) merge(other *TopFiles) {
+	if other == nil {
+		return
+	}
+	for lang, files := range other.Files {
+		for _, fl := range files {
+			tf.consider(lang, fl)
+		}
+	}
+}
+
+// Inserts the given file in its position among the largest files of the given
+// language, unless there are already Limit larger ones.
+func (tf *TopFiles) consider(lang string, fl FileLocation) {
+	files := tf.Files[lang]
+	i := sort.Search(len(files), func(i int) bool {
+		return fl.Loc > files[i].Loc || fl.Loc == files[i].Loc && fl.Path < files[i].Path
+	})
+	if i >= tf.Limit {
+		return
+	}
+	if len(files) < tf.Limit {
+		files = append(files, FileLocation{})
+	}
+	copy(files[i+1:], files[i:])
+	files[i] = fl
+	tf.Files[lang] = files
+}